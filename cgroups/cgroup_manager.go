@@ -1,10 +1,16 @@
 package cgroups
 
 import (
+	"path"
+
 	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// cgroupRoot 所有容器cgroup的父目录，每个容器使用单独的子cgroup
+const cgroupRoot = "tiny-docker"
+
 type CgroupManager struct {
 	// cgroup在hierarchy中的路径 相当于创建的cgroup目录相对于root cgroup目录的路径
 	Path string
@@ -18,12 +24,16 @@ func NewCgroupManager(path string) *CgroupManager {
 	}
 }
 
+// NewContainerCgroupManager 创建容器对应的 cgroup 管理器，路径为 tiny-docker/{containerId}
+func NewContainerCgroupManager(containerId string) *CgroupManager {
+	return NewCgroupManager(path.Join(cgroupRoot, containerId))
+}
+
 // Apply 将进程pid加入到这个cgroup中
 func (c *CgroupManager) Apply(pid int, res *subsystem.ResourceConfig) error {
 	for _, subSysIns := range subsystem.SubsystemsIns {
-		err := subSysIns.Apply(c.Path, pid, res)
-		if err != nil {
-			logrus.Errorf("apply subsystem:%s err:%s", subSysIns.Name(), err)
+		if err := subSysIns.Apply(c.Path, pid, res); err != nil {
+			return errors.WithMessagef(err, "apply subsystem %s failed", subSysIns.Name())
 		}
 	}
 	return nil
@@ -32,21 +42,96 @@ func (c *CgroupManager) Apply(pid int, res *subsystem.ResourceConfig) error {
 // Set 设置cgroup资源限制
 func (c *CgroupManager) Set(res *subsystem.ResourceConfig) error {
 	for _, subSysIns := range subsystem.SubsystemsIns {
-		err := subSysIns.Set(c.Path, res)
-		if err != nil {
-			logrus.Errorf("apply subsystem:%s err:%s", subSysIns.Name(), err)
+		if err := subSysIns.Set(c.Path, res); err != nil {
+			return errors.WithMessagef(err, "set subsystem %s failed", subSysIns.Name())
 		}
 	}
 	return nil
 }
 
-// Destroy 释放cgroup
+// Destroy 释放cgroup，没有挂载的Subsystem会被跳过
 func (c *CgroupManager) Destroy() error {
 	for _, subSysIns := range subsystem.SubsystemsIns {
 		if err := subSysIns.Remove(c.Path); err != nil {
+			if errors.Is(err, subsystem.ErrNotMounted) {
+				continue
+			}
 			logrus.Warnf("remove cgroup fail %v", err)
 		}
 		logrus.Infof("Delete %s cgroup success", subSysIns.Name())
 	}
 	return nil
 }
+
+// Freeze 暂停cgroup中的所有进程
+func (c *CgroupManager) Freeze() error {
+	return subsystem.Freezer.Freeze(c.Path)
+}
+
+// Thaw 恢复cgroup中的所有进程
+func (c *CgroupManager) Thaw() error {
+	return subsystem.Freezer.Thaw(c.Path)
+}
+
+// GetStats 读取cgroup的资源使用情况，未挂载的Subsystem会被跳过
+// 读取失败时仍然返回其他Subsystem的统计信息，以及第一个读取错误
+func (c *CgroupManager) GetStats() (*subsystem.Stats, error) {
+	stats := &subsystem.Stats{}
+	var firstErr error
+	for _, subSysIns := range subsystem.SubsystemsIns {
+		collector, ok := subSysIns.(subsystem.StatsCollector)
+		if !ok {
+			continue
+		}
+		err := collector.Stats(c.Path, stats)
+		if err == nil || errors.Is(err, subsystem.ErrNotMounted) {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = errors.WithMessagef(err, "get subsystem %s stats failed", subSysIns.Name())
+		}
+	}
+	return stats, firstErr
+}
+
+// CgroupInfo cgroup 在各个Subsystem中的路径以及当前生效的资源限制
+type CgroupInfo struct {
+	Path   string            `json:"path"`
+	Paths  map[string]string `json:"paths"`  // Subsystem名称到cgroup绝对路径
+	Limits map[string]string `json:"limits"` // 资源限制文件名到文件内容，e.g. memory.limit_in_bytes
+}
+
+// Inspect 读取cgroup在各个Subsystem中的路径以及资源限制，cgroup已经被删除的Subsystem会被跳过
+func (c *CgroupManager) Inspect() *CgroupInfo {
+	info := &CgroupInfo{
+		Path:   c.Path,
+		Paths:  make(map[string]string),
+		Limits: make(map[string]string),
+	}
+	for _, subSysIns := range subsystem.SubsystemsIns {
+		subsysCgroupPath, limits := subsystem.Inspect(subSysIns, c.Path)
+		if subsysCgroupPath == "" {
+			continue
+		}
+		info.Paths[subSysIns.Name()] = subsysCgroupPath
+		for file, value := range limits {
+			info.Limits[file] = value
+		}
+	}
+	return info
+}
+
+// NotifyOOM 监听cgroup的 OOM 事件
+func (c *CgroupManager) NotifyOOM() (<-chan struct{}, error) {
+	return subsystem.Memory.NotifyOOM(c.Path)
+}
+
+// OOMKilled 判断cgroup中是否有进程被 OOM killer 杀死
+func (c *CgroupManager) OOMKilled() bool {
+	count, err := subsystem.Memory.OOMKillCount(c.Path)
+	if err != nil {
+		logrus.Debugf("get oom kill count err:%s", err)
+		return false
+	}
+	return count > 0
+}
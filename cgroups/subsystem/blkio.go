@@ -0,0 +1,167 @@
+package subsystem
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"golang.org/x/sys/unix"
+)
+
+// BlkioSubsystem 限制和统计cgroup的块设备读写
+type BlkioSubsystem struct {
+}
+
+func (s *BlkioSubsystem) Name() string {
+	return "blkio"
+}
+
+// Set 设置cgroupPath 对应的cgroup块设备权重和读写速率限制
+func (s *BlkioSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	throttles := map[string][]string{
+		"blkio.throttle.read_bps_device":   res.DeviceReadBps,
+		"blkio.throttle.write_bps_device":  res.DeviceWriteBps,
+		"blkio.throttle.read_iops_device":  res.DeviceReadIOps,
+		"blkio.throttle.write_iops_device": res.DeviceWriteIOps,
+	}
+	hasThrottle := false
+	for _, devices := range throttles {
+		hasThrottle = hasThrottle || len(devices) > 0
+	}
+	if res.BlkioWeight == 0 && !hasThrottle {
+		return nil
+	}
+
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if res.BlkioWeight != 0 {
+		if err = s.setWeight(subsysCgroupPath, res.BlkioWeight); err != nil {
+			return err
+		}
+	}
+	for file, devices := range throttles {
+		for _, device := range devices {
+			// 每次写入一个设备的限制，格式为 major:minor value
+			rule, err := parseThrottleDevice(device)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(path.Join(subsysCgroupPath, file), []byte(rule), constant.Perm0644)
+			if err != nil {
+				return fmt.Errorf("set cgroup %s fail %v", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setWeight 设置块设备权重，CFQ 调度器使用 blkio.weight，BFQ 调度器使用 blkio.bfq.weight
+func (s *BlkioSubsystem) setWeight(subsysCgroupPath string, weight int) error {
+	for _, file := range []string{"blkio.weight", "blkio.bfq.weight"} {
+		weightFile := path.Join(subsysCgroupPath, file)
+		if _, err := os.Stat(weightFile); err != nil {
+			continue
+		}
+		if err := os.WriteFile(weightFile, []byte(strconv.Itoa(weight)), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup %s fail %v", file, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("blkio weight is not supported by current io scheduler")
+}
+
+// parseThrottleDevice 将 /dev/sda:1048576 转换为 cgroup 需要的 8:0 1048576
+func parseThrottleDevice(device string) (string, error) {
+	idx := strings.LastIndex(device, ":")
+	if idx <= 0 {
+		return "", fmt.Errorf("invalid device limit %s, must be path:value", device)
+	}
+	devicePath, value := device[:idx], device[idx+1:]
+	if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid device limit value %s", value)
+	}
+	var stat unix.Stat_t
+	if err := unix.Stat(devicePath, &stat); err != nil {
+		return "", fmt.Errorf("stat device %s fail %v", devicePath, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("%s is not a block device", devicePath)
+	}
+	return fmt.Sprintf("%d:%d %s", unix.Major(stat.Rdev), unix.Minor(stat.Rdev), value), nil
+}
+
+// Apply 将pid加入到对应cgroupPath对应的cgroup中，没有限制时也加入，用于统计读写量
+func (s *BlkioSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
+	if err := applyPid(s.Name(), cgroupPath, pid); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// Remove 删除cgroupPath对应的cgroup
+func (s *BlkioSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// Stats 读取块设备读写字节数
+// blkio.throttle.io_service_bytes 的格式为每行 major:minor Read|Write|Sync|Async|Discard|Total bytes
+// v2 使用 io.stat，格式为每行 major:minor rbytes=1 wbytes=2 rios=3 wios=4 ...
+func (s *BlkioSubsystem) Stats(cgroupPath string, stats *Stats) error {
+	subsysCgroupPath, v1, err := statsCgroupPath(s.Name(), cgroupPath)
+	if err != nil {
+		return err
+	}
+	statFile := "blkio.throttle.io_service_bytes"
+	if !v1 {
+		statFile = "io.stat"
+	}
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, statFile))
+	if err != nil {
+		return fmt.Errorf("read %s fail %v", statFile, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if v1 {
+			if len(fields) != 3 {
+				continue
+			}
+			value, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch fields[1] {
+			case "Read":
+				stats.BlkioRead += value
+			case "Write":
+				stats.BlkioWrite += value
+			}
+			continue
+		}
+		for _, field := range fields {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			value, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				stats.BlkioRead += value
+			case "wbytes":
+				stats.BlkioWrite += value
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// findBlockDevice 找到一个宿主机上的块设备用于测试
+func findBlockDevice(t *testing.T) string {
+	devices, _ := filepath.Glob("/sys/block/*")
+	for _, device := range devices {
+		devicePath := path.Join("/dev", path.Base(device))
+		if _, err := os.Stat(devicePath); err == nil {
+			return devicePath
+		}
+	}
+	t.Skip("no block device found")
+	return ""
+}
+
+func TestBlkioCgroup(t *testing.T) {
+	blkioSubSys := BlkioSubsystem{}
+	device := findBlockDevice(t)
+	resConfig := &ResourceConfig{
+		DeviceReadBps:   []string{device + ":1048576"},
+		DeviceWriteBps:  []string{device + ":1048576"},
+		DeviceReadIOps:  []string{device + ":1000"},
+		DeviceWriteIOps: []string{device + ":1000"},
+	}
+	testCgroup := "test-blkio"
+
+	if err := blkioSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	readBps, _ := os.ReadFile(path.Join(findCgroupMountpoint("blkio"), testCgroup, "blkio.throttle.read_bps_device"))
+	if !strings.Contains(string(readBps), "1048576") {
+		t.Fatalf("read bps %s, want 1048576", readBps)
+	}
+
+	if err := blkioSubSys.Apply(testCgroup, os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	// 将进程移回到根Cgroup节点
+	if err := blkioSubSys.Apply("", os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := blkioSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
+
+func TestBlkioWeightCgroup(t *testing.T) {
+	blkioSubSys := BlkioSubsystem{}
+	resConfig := &ResourceConfig{
+		BlkioWeight: 500,
+	}
+	testCgroup := "test-blkio-weight"
+
+	root := findCgroupMountpoint("blkio")
+	_, weightErr := os.Stat(path.Join(root, "blkio.weight"))
+	_, bfqErr := os.Stat(path.Join(root, "blkio.bfq.weight"))
+	if weightErr != nil && bfqErr != nil {
+		t.Skip("blkio weight is not supported by current io scheduler")
+	}
+	if err := blkioSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	// blkio.bfq.weight 的格式为 default 500
+	weightFile := "blkio.weight"
+	if weightErr != nil {
+		weightFile = "blkio.bfq.weight"
+	}
+	weight, err := os.ReadFile(path.Join(root, testCgroup, weightFile))
+	if err != nil {
+		t.Fatalf("read %s fail %v", weightFile, err)
+	}
+	if fields := strings.Fields(string(weight)); len(fields) == 0 || fields[len(fields)-1] != "500" {
+		t.Fatalf("%s is %s, want 500", weightFile, weight)
+	}
+
+	if err := blkioSubSys.Apply(testCgroup, os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	// 将进程移回到根Cgroup节点
+	if err := blkioSubSys.Apply("", os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := blkioSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
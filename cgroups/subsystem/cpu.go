@@ -23,7 +23,7 @@ func (s *CpuSubsystem) Name() string {
 
 // Set 设置cgroupPath 对应的cgroup cpu限制
 func (s *CpuSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
-	if res.CpuCfsQuota == 0 && res.CpuShare == "" {
+	if res.CpuCfsQuota == 0 && res.Cpus == 0 && res.CpuShare == "" {
 		return nil
 	}
 
@@ -54,12 +54,25 @@ func (s *CpuSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 		}
 	}
 
+	// --cpus 指定可以使用的cpu核数，例如1.5表示每个周期可以使用1.5个周期的cpu时间
+	if res.Cpus != 0 {
+		err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(PeriodDefault)), constant.Perm0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup cpu period fail: %v", err)
+		}
+		quota := int(res.Cpus * PeriodDefault)
+		err = os.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_quota_us"), []byte(strconv.Itoa(quota)), constant.Perm0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup cpu quota fail: %v", err)
+		}
+	}
+
 	return nil
 }
 
 // Apply 将pid加入到对应cgroupPath对应的cgroup中
 func (s *CpuSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
-	if res.CpuCfsQuota == 0 && res.CpuShare == "" {
+	if res.CpuCfsQuota == 0 && res.Cpus == 0 && res.CpuShare == "" {
 		return nil
 	}
 
@@ -0,0 +1,41 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCpusCgroup(t *testing.T) {
+	cpuSubSys := CpuSubsystem{}
+	resConfig := &ResourceConfig{
+		Cpus:     1.5,
+		CpuShare: "512",
+	}
+	testCgroup := "test-cpus"
+
+	if err := cpuSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	quota, _ := os.ReadFile(path.Join(findCgroupMountpoint("cpu"), testCgroup, "cpu.cfs_quota_us"))
+	if strings.TrimSpace(string(quota)) != "150000" {
+		t.Fatalf("cpu quota %s, want 150000", quota)
+	}
+	shares, _ := os.ReadFile(path.Join(findCgroupMountpoint("cpu"), testCgroup, "cpu.shares"))
+	if strings.TrimSpace(string(shares)) != "512" {
+		t.Fatalf("cpu shares %s, want 512", shares)
+	}
+
+	if err := cpuSubSys.Apply(testCgroup, os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	// 将进程移回到根Cgroup节点
+	if err := cpuSubSys.Apply("", os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := cpuSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
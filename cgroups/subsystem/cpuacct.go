@@ -0,0 +1,61 @@
+package subsystem
+
+import (
+	"fmt"
+	"os"
+)
+
+// CpuacctSubsystem 统计cgroup的cpu使用时间
+type CpuacctSubsystem struct {
+}
+
+func (s *CpuacctSubsystem) Name() string {
+	return "cpuacct"
+}
+
+// Set cpuacct 只用于统计，没有资源限制
+func (s *CpuacctSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	return nil
+}
+
+// Apply 将pid加入到对应cgroupPath对应的cgroup中
+func (s *CpuacctSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
+	if err := applyPid(s.Name(), cgroupPath, pid); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// Remove 删除cgroupPath对应的cgroup
+func (s *CpuacctSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// Stats 读取累计使用的cpu时间，cpuacct.usage 的单位为纳秒
+// v2 没有 cpuacct，从 cpu.stat 的 usage_usec 读取，单位为微秒
+func (s *CpuacctSubsystem) Stats(cgroupPath string, stats *Stats) error {
+	subsysCgroupPath, v1, err := statsCgroupPath(s.Name(), cgroupPath)
+	if err != nil {
+		return err
+	}
+	if v1 {
+		if stats.CpuUsage, err = readUint(subsysCgroupPath, "cpuacct.usage"); err != nil {
+			return fmt.Errorf("read cpuacct usage fail %v", err)
+		}
+		return nil
+	}
+	values, err := readKeyValues(subsysCgroupPath, "cpu.stat")
+	if err != nil {
+		return fmt.Errorf("read cpu stat fail %v", err)
+	}
+	usage, ok := values["usage_usec"]
+	if !ok {
+		return fmt.Errorf("usage_usec not found in cpu.stat")
+	}
+	stats.CpuUsage = usage * 1000
+	return nil
+}
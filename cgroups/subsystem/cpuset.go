@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/ChenMiaoQiu/tiny-docker/constant"
 )
@@ -26,6 +27,9 @@ func (s *CpusetSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 	if err != nil {
 		return err
 	}
+	if err = s.ensureParent(findCgroupMountpoint(s.Name()), subsysCgroupPath); err != nil {
+		return err
+	}
 	// 设置这个cgroup的cpuset限制，即将限制写入到cgroup对应目录的cpuset.cpus 文件中。
 	err = os.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), constant.Perm0644)
 	if err != nil {
@@ -34,6 +38,34 @@ func (s *CpusetSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 	return nil
 }
 
+// ensureParent 新创建的 cpuset cgroup 中 cpuset.cpus 和 cpuset.mems 为空，不能设置限制也不能加入进程，
+// 这里从 root 开始逐级向下，为空时从父cgroup中复制
+func (s *CpusetSubsystem) ensureParent(root, current string) error {
+	if current == root || !strings.HasPrefix(current, root) {
+		return nil
+	}
+	parent := path.Dir(current)
+	if err := s.ensureParent(root, parent); err != nil {
+		return err
+	}
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		content, err := os.ReadFile(path.Join(current, file))
+		if err != nil {
+			return fmt.Errorf("read %s fail %v", file, err)
+		}
+		if strings.TrimSpace(string(content)) != "" {
+			continue
+		}
+		if content, err = os.ReadFile(path.Join(parent, file)); err != nil {
+			return fmt.Errorf("read %s fail %v", file, err)
+		}
+		if err = os.WriteFile(path.Join(current, file), content, constant.Perm0644); err != nil {
+			return fmt.Errorf("init %s fail %v", file, err)
+		}
+	}
+	return nil
+}
+
 // Apply 将pid加入到对应cgroupPath对应的cgroup中
 func (s *CpusetSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
 	if res.CpuSet == "" {
@@ -0,0 +1,147 @@
+package subsystem
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+)
+
+// freezer 的状态，v2 的 cgroup.events 中 frozen 字段会被转换为同样的状态
+const (
+	FreezerFrozen = "FROZEN"
+	FreezerThawed = "THAWED"
+)
+
+const (
+	freezeTimeout       = 10 * time.Second
+	freezeCheckInterval = 10 * time.Millisecond
+)
+
+// FreezerSubsystem 通过 freezer 挂起和恢复 cgroup 中的所有进程
+// cgroup v1 使用 freezer.state，cgroup v2 使用 cgroup.freeze 和 cgroup.events
+type FreezerSubsystem struct {
+}
+
+func (s *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+// Set freezer 没有资源限制，只需要创建对应的 cgroup
+func (s *FreezerSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	_, err := s.getCgroupPath(cgroupPath, true)
+	return err
+}
+
+// Apply 将pid加入到对应cgroupPath对应的cgroup中，为了随时可以暂停容器，总是加入
+func (s *FreezerSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
+	subsysCgroupPath, err := s.getCgroupPath(cgroupPath, true)
+	if err != nil {
+		return fmt.Errorf("%v fail get cgroup: %s", err, cgroupPath)
+	}
+
+	procsFile := "tasks"
+	if !s.isV1() {
+		procsFile = "cgroup.procs"
+	}
+	err = os.WriteFile(path.Join(subsysCgroupPath, procsFile), []byte(strconv.Itoa(pid)), constant.Perm0644)
+	if err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// Remove 删除cgroupPath对应的cgroup
+func (s *FreezerSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := s.getCgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// Freeze 挂起cgroup中的所有进程，并等待状态变为 FROZEN
+func (s *FreezerSubsystem) Freeze(cgroupPath string) error {
+	return s.setState(cgroupPath, FreezerFrozen)
+}
+
+// Thaw 恢复cgroup中的所有进程，并等待状态变为 THAWED
+func (s *FreezerSubsystem) Thaw(cgroupPath string) error {
+	return s.setState(cgroupPath, FreezerThawed)
+}
+
+// State 获取cgroup当前的 freezer 状态
+func (s *FreezerSubsystem) State(cgroupPath string) (string, error) {
+	subsysCgroupPath, err := s.getCgroupPath(cgroupPath, false)
+	if err != nil {
+		return "", err
+	}
+	if s.isV1() {
+		content, err := os.ReadFile(path.Join(subsysCgroupPath, "freezer.state"))
+		if err != nil {
+			return "", fmt.Errorf("read freezer state fail %v", err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	// cgroup.events 中 frozen 1 表示已经冻结
+	content, err := os.ReadFile(path.Join(subsysCgroupPath, "cgroup.events"))
+	if err != nil {
+		return "", fmt.Errorf("read cgroup events fail %v", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "frozen 1" {
+			return FreezerFrozen, nil
+		}
+	}
+	return FreezerThawed, nil
+}
+
+func (s *FreezerSubsystem) setState(cgroupPath string, state string) error {
+	subsysCgroupPath, err := s.getCgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	stateFile, value := "freezer.state", state
+	if !s.isV1() {
+		stateFile, value = "cgroup.freeze", "0"
+		if state == FreezerFrozen {
+			value = "1"
+		}
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		// v1 在进程无法立即冻结时会停留在 FREEZING 状态，需要重复写入直到状态稳定
+		err = os.WriteFile(path.Join(subsysCgroupPath, stateFile), []byte(value), constant.Perm0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup freezer state %s fail %v", state, err)
+		}
+		current, err := s.State(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if current == state {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("wait cgroup freezer state %s timeout, current state %s", state, current)
+		}
+		time.Sleep(freezeCheckInterval)
+	}
+}
+
+// isV1 优先使用 v1 的 freezer hierarchy，没有挂载时使用 v2 的统一 hierarchy
+func (s *FreezerSubsystem) isV1() bool {
+	return findCgroupMountpoint(s.Name()) != ""
+}
+
+func (s *FreezerSubsystem) getCgroupPath(cgroupPath string, autoCreate bool) (string, error) {
+	if s.isV1() {
+		return getCgroupPath(s.Name(), cgroupPath, autoCreate)
+	}
+	return getCgroupV2Path(cgroupPath, autoCreate)
+}
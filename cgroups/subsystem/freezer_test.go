@@ -0,0 +1,49 @@
+package subsystem
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestFreezerCgroup(t *testing.T) {
+	freezerSubSys := FreezerSubsystem{}
+	resConfig := &ResourceConfig{}
+	testCgroup := "test-freezer"
+
+	cmd := exec.Command("sleep", "100")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	if err := freezerSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	if err := freezerSubSys.Apply(testCgroup, cmd.Process.Pid, resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := freezerSubSys.Freeze(testCgroup); err != nil {
+		t.Fatalf("cgroup Freeze %v", err)
+	}
+	if state, _ := freezerSubSys.State(testCgroup); state != FreezerFrozen {
+		t.Fatalf("freezer state %s, want %s", state, FreezerFrozen)
+	}
+	if err := freezerSubSys.Thaw(testCgroup); err != nil {
+		t.Fatalf("cgroup Thaw %v", err)
+	}
+	if state, _ := freezerSubSys.State(testCgroup); state != FreezerThawed {
+		t.Fatalf("freezer state %s, want %s", state, FreezerThawed)
+	}
+
+	// 将进程移回到根Cgroup节点
+	if err := freezerSubSys.Apply("", cmd.Process.Pid, resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	if err := freezerSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
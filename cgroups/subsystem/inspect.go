@@ -0,0 +1,46 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// limitFiles 各个Subsystem中记录资源限制的文件
+var limitFiles = map[string][]string{
+	"memory": {"memory.limit_in_bytes", "memory.memsw.limit_in_bytes", "memory.soft_limit_in_bytes"},
+	"cpu":    {"cpu.cfs_quota_us", "cpu.cfs_period_us", "cpu.shares"},
+	"cpuset": {"cpuset.cpus", "cpuset.mems"},
+	"pids":   {"pids.max"},
+	"blkio": {"blkio.weight", "blkio.throttle.read_bps_device", "blkio.throttle.write_bps_device",
+		"blkio.throttle.read_iops_device", "blkio.throttle.write_iops_device"},
+	"freezer": {"freezer.state", "cgroup.freeze"},
+}
+
+// Inspect 返回cgroup在这个Subsystem中的绝对路径以及当前生效的资源限制
+// cgroup不存在时返回空路径，不存在或内容为空的限制文件会被忽略
+func Inspect(s Subsystem, cgroupPath string) (string, map[string]string) {
+	var subsysCgroupPath string
+	if freezer, ok := s.(*FreezerSubsystem); ok {
+		subsysCgroupPath, _ = freezer.getCgroupPath(cgroupPath, false)
+	} else if findCgroupMountpoint(s.Name()) != "" {
+		subsysCgroupPath, _ = getCgroupPath(s.Name(), cgroupPath, false)
+	}
+	if subsysCgroupPath == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(subsysCgroupPath); err != nil {
+		return "", nil
+	}
+	limits := make(map[string]string)
+	for _, file := range limitFiles[s.Name()] {
+		content, err := os.ReadFile(path.Join(subsysCgroupPath, file))
+		if err != nil {
+			continue
+		}
+		if value := strings.TrimSpace(string(content)); value != "" {
+			limits[file] = value
+		}
+	}
+	return subsysCgroupPath, limits
+}
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strconv"
 
 	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
 )
 
 type MemorySubsystem struct {
@@ -18,7 +18,7 @@ func (s *MemorySubsystem) Name() string {
 
 // Set 设置cgroupPath 对应的cgroup内存限制
 func (s *MemorySubsystem) Set(cgroupPath string, res *ResourceConfig) error {
-	if res.MemoryLimit == "" {
+	if res.MemoryLimit == "" && res.MemorySwap == "" && res.MemoryReservation == "" && !res.OomKillDisable {
 		return nil
 	}
 
@@ -27,25 +27,68 @@ func (s *MemorySubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 		return err
 	}
 	// 设置这个cgroup的内存限制，即将限制写入到cgroup对应目录的memory.limit_in_bytes 文件中。
-	err = os.WriteFile(path.Join(subsysCgroupPath, "memory.limit_in_bytes"), []byte(res.MemoryLimit), constant.Perm0644)
-	if err != nil {
-		return fmt.Errorf("set cgroup memory fail %v", err)
+	setLimit := func() error {
+		if res.MemoryLimit == "" {
+			return nil
+		}
+		if err := os.WriteFile(path.Join(subsysCgroupPath, "memory.limit_in_bytes"), []byte(res.MemoryLimit), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup memory fail %v", err)
+		}
+		return nil
+	}
+	// memory.memsw.limit_in_bytes 是内存和swap的总限制，任何时候都不能小于 memory.limit_in_bytes
+	setSwap := func() error {
+		if res.MemorySwap == "" {
+			return nil
+		}
+		if err := os.WriteFile(path.Join(subsysCgroupPath, "memory.memsw.limit_in_bytes"), []byte(res.MemorySwap), constant.Perm0644); err != nil {
+			return fmt.Errorf("set cgroup memory swap fail %v", err)
+		}
+		return nil
+	}
+	// update 调大内存限制时需要先调大总限制，否则新的内存限制会超过原来的总限制，其他情况先设置内存限制
+	order := []func() error{setLimit, setSwap}
+	if s.limitGrows(subsysCgroupPath, res) {
+		order = []func() error{setSwap, setLimit}
+	}
+	for _, set := range order {
+		if err = set(); err != nil {
+			return err
+		}
+	}
+	// memory.soft_limit_in_bytes 为软限制，内存紧张时内核会优先回收超过软限制的cgroup
+	if res.MemoryReservation != "" {
+		err = os.WriteFile(path.Join(subsysCgroupPath, "memory.soft_limit_in_bytes"), []byte(res.MemoryReservation), constant.Perm0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup memory reservation fail %v", err)
+		}
+	}
+	// memory.oom_control 写入 1 关闭 OOM killer
+	if res.OomKillDisable {
+		err = os.WriteFile(path.Join(subsysCgroupPath, "memory.oom_control"), []byte("1"), constant.Perm0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup memory oom kill disable fail %v", err)
+		}
 	}
 	return nil
 }
 
-// Apply 将pid加入到对应cgroupPath对应的cgroup中
-func (s *MemorySubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
-	if res.MemoryLimit == "" {
-		return nil
+// limitGrows 判断同时设置内存限制和总限制时，新的内存限制是否大于 cgroup 当前的内存限制
+func (s *MemorySubsystem) limitGrows(subsysCgroupPath string, res *ResourceConfig) bool {
+	if res.MemoryLimit == "" || res.MemorySwap == "" {
+		return false
 	}
-	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	limit, err := utils.RAMInBytes(res.MemoryLimit)
 	if err != nil {
-		return fmt.Errorf("%v fail get cgroup: %s", err, cgroupPath)
+		return false
 	}
+	current, err := readUint(subsysCgroupPath, "memory.limit_in_bytes")
+	return err == nil && uint64(limit) > current
+}
 
-	err = os.WriteFile(path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), constant.Perm0644)
-	if err != nil {
+// Apply 将pid加入到对应cgroupPath对应的cgroup中，没有内存限制时也加入，用于统计内存使用量
+func (s *MemorySubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
+	if err := applyPid(s.Name(), cgroupPath, pid); err != nil {
 		return fmt.Errorf("set cgroup proc fail %v", err)
 	}
 	return nil
@@ -59,3 +102,22 @@ func (s *MemorySubsystem) Remove(cgroupPath string) error {
 	}
 	return os.RemoveAll(subsysCgroupPath)
 }
+
+// Stats 读取内存使用量和内存限制，v2 使用 memory.current 和 memory.max
+func (s *MemorySubsystem) Stats(cgroupPath string, stats *Stats) error {
+	subsysCgroupPath, v1, err := statsCgroupPath(s.Name(), cgroupPath)
+	if err != nil {
+		return err
+	}
+	usageFile, limitFile := "memory.usage_in_bytes", "memory.limit_in_bytes"
+	if !v1 {
+		usageFile, limitFile = "memory.current", "memory.max"
+	}
+	if stats.MemoryUsage, err = readUint(subsysCgroupPath, usageFile); err != nil {
+		return fmt.Errorf("read memory usage fail %v", err)
+	}
+	if stats.MemoryLimit, err = readUint(subsysCgroupPath, limitFile); err != nil {
+		return fmt.Errorf("read memory limit fail %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package subsystem
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"golang.org/x/sys/unix"
+)
+
+// NotifyOOM 监听cgroup的 OOM 事件，每发生一次 OOM 向返回的 channel 发送一次通知
+// cgroup v1 通过 cgroup.event_control 将 eventfd 注册到 memory.oom_control 上
+// cgroup v2 通过 inotify 监听 memory.events 的修改，并比较其中的 oom_kill 计数
+func (s *MemorySubsystem) NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	if findCgroupMountpoint(s.Name()) == "" {
+		return s.notifyOOMV2(cgroupPath)
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	oomControl, err := os.Open(path.Join(subsysCgroupPath, "memory.oom_control"))
+	if err != nil {
+		return nil, fmt.Errorf("open memory.oom_control fail %v", err)
+	}
+	efd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		oomControl.Close()
+		return nil, fmt.Errorf("create eventfd fail %v", err)
+	}
+	// 写入 "<event_fd> <fd of memory.oom_control>" 完成注册
+	data := fmt.Sprintf("%d %d", efd, oomControl.Fd())
+	err = os.WriteFile(path.Join(subsysCgroupPath, "cgroup.event_control"), []byte(data), constant.Perm0644)
+	if err != nil {
+		oomControl.Close()
+		unix.Close(efd)
+		return nil, fmt.Errorf("register oom event fail %v", err)
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		defer oomControl.Close()
+		defer unix.Close(efd)
+		buf := make([]byte, 8)
+		for {
+			if _, err := unix.Read(efd, buf); err != nil {
+				return
+			}
+			// cgroup 被删除时 eventfd 同样会收到通知，此时退出监听
+			if _, err := os.Stat(path.Join(subsysCgroupPath, "cgroup.event_control")); os.IsNotExist(err) {
+				return
+			}
+			notify(ch)
+		}
+	}()
+	return ch, nil
+}
+
+func (s *MemorySubsystem) notifyOOMV2(cgroupPath string) (<-chan struct{}, error) {
+	subsysCgroupPath, err := getCgroupV2Path(cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	eventsFile := path.Join(subsysCgroupPath, "memory.events")
+	ifd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("init inotify fail %v", err)
+	}
+	if _, err = unix.InotifyAddWatch(ifd, eventsFile, unix.IN_MODIFY); err != nil {
+		unix.Close(ifd)
+		return nil, fmt.Errorf("watch %s fail %v", eventsFile, err)
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		defer unix.Close(ifd)
+		lastCount, _ := readOOMKillCount(eventsFile)
+		buf := make([]byte, unix.SizeofInotifyEvent+unix.PathMax+1)
+		for {
+			if _, err := unix.Read(ifd, buf); err != nil {
+				return
+			}
+			count, err := readOOMKillCount(eventsFile)
+			if err != nil {
+				return
+			}
+			if count > lastCount {
+				lastCount = count
+				notify(ch)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// OOMKillCount 读取cgroup中被 OOM killer 杀死的进程数
+// v1 中为 memory.oom_control 的 oom_kill 字段，v2 中为 memory.events 的 oom_kill 字段
+func (s *MemorySubsystem) OOMKillCount(cgroupPath string) (uint64, error) {
+	if findCgroupMountpoint(s.Name()) == "" {
+		subsysCgroupPath, err := getCgroupV2Path(cgroupPath, false)
+		if err != nil {
+			return 0, err
+		}
+		return readOOMKillCount(path.Join(subsysCgroupPath, "memory.events"))
+	}
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	return readOOMKillCount(path.Join(subsysCgroupPath, "memory.oom_control"))
+}
+
+// readOOMKillCount 读取 key value 格式文件中的 oom_kill 字段
+func readOOMKillCount(file string) (uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// notify 非阻塞地发送通知，未被消费的通知会被合并
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -3,6 +3,7 @@ package subsystem
 import (
 	"os"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -31,3 +32,46 @@ func TestMemoryCgroup(t *testing.T) {
 		t.Fatalf("cgroup remove %v", err)
 	}
 }
+
+func TestMemorySwapCgroup(t *testing.T) {
+	memSubSys := MemorySubsystem{}
+	resConfig := &ResourceConfig{
+		MemoryLimit:       "100m",
+		MemorySwap:        "200m",
+		MemoryReservation: "50m",
+	}
+	testCgroup := "test-memswap"
+
+	if _, err := os.Stat(path.Join(findCgroupMountpoint("memory"), "memory.memsw.limit_in_bytes")); err != nil {
+		t.Skipf("swap accounting is not enabled: %v", err)
+	}
+	if err := memSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	want := map[string]string{
+		"memory.limit_in_bytes":       "104857600",
+		"memory.memsw.limit_in_bytes": "209715200",
+		"memory.soft_limit_in_bytes":  "52428800",
+	}
+	for file, value := range want {
+		content, err := os.ReadFile(path.Join(findCgroupMountpoint("memory"), testCgroup, file))
+		if err != nil {
+			t.Fatalf("read %s fail %v", file, err)
+		}
+		if strings.TrimSpace(string(content)) != value {
+			t.Fatalf("%s is %s, want %s", file, content, value)
+		}
+	}
+
+	if err := memSubSys.Apply(testCgroup, os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	// 将进程移回到根Cgroup节点
+	if err := memSubSys.Apply("", os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := memSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package subsystem
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+)
+
+// PidsSubsystem 限制和统计cgroup中的进程数
+type PidsSubsystem struct {
+}
+
+func (s *PidsSubsystem) Name() string {
+	return "pids"
+}
+
+// Set 设置cgroupPath 对应的cgroup进程数限制，用于防止 fork 炸弹
+func (s *PidsSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if res.PidsLimit == 0 {
+		return nil
+	}
+
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	// pids.max 为 max 时表示不限制
+	limit := "max"
+	if res.PidsLimit > 0 {
+		limit = strconv.Itoa(res.PidsLimit)
+	}
+	err = os.WriteFile(path.Join(subsysCgroupPath, "pids.max"), []byte(limit), constant.Perm0644)
+	if err != nil {
+		return fmt.Errorf("set cgroup pids limit fail %v", err)
+	}
+	return nil
+}
+
+// Apply 将pid加入到对应cgroupPath对应的cgroup中，没有限制时也加入，用于统计进程数
+func (s *PidsSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
+	if err := applyPid(s.Name(), cgroupPath, pid); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// Remove 删除cgroupPath对应的cgroup
+func (s *PidsSubsystem) Remove(cgroupPath string) error {
+	subsysCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(subsysCgroupPath)
+}
+
+// Stats 读取当前进程数，v1 和 v2 都使用 pids.current
+func (s *PidsSubsystem) Stats(cgroupPath string, stats *Stats) error {
+	subsysCgroupPath, _, err := statsCgroupPath(s.Name(), cgroupPath)
+	if err != nil {
+		return err
+	}
+	if stats.Pids, err = readUint(subsysCgroupPath, "pids.current"); err != nil {
+		return fmt.Errorf("read pids current fail %v", err)
+	}
+	return nil
+}
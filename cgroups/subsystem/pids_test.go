@@ -0,0 +1,41 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPidsCgroup(t *testing.T) {
+	pidsSubSys := PidsSubsystem{}
+	resConfig := &ResourceConfig{
+		PidsLimit: 100,
+	}
+	testCgroup := "test-pidslimit"
+
+	if err := pidsSubSys.Set(testCgroup, resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	limit, _ := os.ReadFile(path.Join(findCgroupMountpoint("pids"), testCgroup, "pids.max"))
+	if strings.TrimSpace(string(limit)) != "100" {
+		t.Fatalf("pids limit %s, want 100", limit)
+	}
+
+	if err := pidsSubSys.Apply(testCgroup, os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	stats := &Stats{}
+	if err := pidsSubSys.Stats(testCgroup, stats); err != nil {
+		t.Fatalf("cgroup Stats %v", err)
+	}
+	t.Logf("pids current: %d", stats.Pids)
+	// 将进程移回到根Cgroup节点
+	if err := pidsSubSys.Apply("", os.Getpid(), resConfig); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+
+	if err := pidsSubSys.Remove(testCgroup); err != nil {
+		t.Fatalf("cgroup remove %v", err)
+	}
+}
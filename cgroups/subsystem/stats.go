@@ -0,0 +1,86 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+)
+
+// Stats 容器cgroup的资源使用情况
+type Stats struct {
+	CpuUsage    uint64 `json:"cpuUsage"`    // 累计使用的cpu时间，单位纳秒
+	MemoryUsage uint64 `json:"memoryUsage"` // 当前内存使用量，单位字节
+	MemoryLimit uint64 `json:"memoryLimit"` // 内存限制，单位字节
+	Pids        uint64 `json:"pids"`        // 当前进程数
+	BlkioRead   uint64 `json:"blkioRead"`   // 累计读取的字节数
+	BlkioWrite  uint64 `json:"blkioWrite"`  // 累计写入的字节数
+}
+
+// StatsCollector 能够统计资源使用情况的Subsystem
+type StatsCollector interface {
+	// Stats 读取某个cgroup在这个Subsystem中的资源使用情况
+	Stats(path string, stats *Stats) error
+}
+
+// readUint 读取只包含一个整数的cgroup文件，v2 的限制文件中 max 表示没有限制，返回 0
+func readUint(dir string, file string) (uint64, error) {
+	content, err := os.ReadFile(path.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readKeyValues 读取每行为 key value 格式的cgroup文件，例如 cpu.stat
+func readKeyValues(dir string, file string) (map[string]uint64, error) {
+	content, err := os.ReadFile(path.Join(dir, file))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values, nil
+}
+
+// statsCgroupPath 返回读取统计信息使用的cgroup目录，Subsystem没有挂载 v1 hierarchy 时使用 v2 的统一 hierarchy
+// v1 为 false 时需要读取 v2 的统计文件，两者都没有挂载时返回 ErrNotMounted
+func statsCgroupPath(subsystem string, cgroupPath string) (dir string, v1 bool, err error) {
+	if findCgroupMountpoint(subsystem) != "" {
+		dir, err = getCgroupPath(subsystem, cgroupPath, false)
+		return dir, true, err
+	}
+	if findCgroupV2Mountpoint() == "" {
+		return "", false, errors.WithMessagef(ErrNotMounted, "subsystem %s", subsystem)
+	}
+	dir, err = getCgroupV2Path(cgroupPath, false)
+	return dir, false, err
+}
+
+// applyPid 将pid加入到对应的cgroup中，cgroup不存在时自动创建
+// 只用于统计的Subsystem没有挂载时直接跳过，不影响容器启动
+func applyPid(subsystem string, cgroupPath string, pid int) error {
+	if findCgroupMountpoint(subsystem) == "" {
+		return nil
+	}
+	subsysCgroupPath, err := getCgroupPath(subsystem, cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), constant.Perm0644)
+}
@@ -0,0 +1,35 @@
+package subsystem
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadStatFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.current": "1048576\n",
+		"memory.max":     "max\n",
+		"cpu.stat":       "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+	}
+	for file, content := range files {
+		if err := os.WriteFile(path.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if usage, err := readUint(dir, "memory.current"); err != nil || usage != 1048576 {
+		t.Fatalf("read memory.current got %d, %v", usage, err)
+	}
+	// v2 中 max 表示没有限制
+	if limit, err := readUint(dir, "memory.max"); err != nil || limit != 0 {
+		t.Fatalf("read memory.max got %d, %v", limit, err)
+	}
+	values, err := readKeyValues(dir, "cpu.stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["usage_usec"] != 1500 || values["system_usec"] != 500 {
+		t.Fatalf("read cpu.stat got %v", values)
+	}
+}
@@ -1,11 +1,21 @@
 package subsystem
 
-// ResourceConfig 用于传递资源限制配置的结构体，包含内存限制，CPU 时间片权重，CPU核心数
+// ResourceConfig 用于传递资源限制配置的结构体，包含内存限制，CPU 时间片权重，CPU核心数，进程数以及块设备限制
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuCfsQuota int
-	CpuShare    string
-	CpuSet      string
+	MemoryLimit       string
+	MemorySwap        string // 内存加 swap 的总限制，-1 表示不限制
+	MemoryReservation string // 内存软限制
+	OomKillDisable    bool   // 超过内存限制时不触发 OOM killer，进程会被挂起直到内存可用
+	CpuCfsQuota       int
+	Cpus              float64 // 可以使用的cpu核数，支持小数，会被转换为 cfs quota
+	CpuShare          string
+	CpuSet            string
+	PidsLimit         int
+	BlkioWeight       int
+	DeviceReadBps     []string // 格式为 设备路径:值，e.g. /dev/sda:1048576
+	DeviceWriteBps    []string
+	DeviceReadIOps    []string
+	DeviceWriteIOps   []string
 }
 
 type Subsystem interface {
@@ -20,7 +30,17 @@ type Subsystem interface {
 }
 
 var SubsystemsIns = []Subsystem{
-	&MemorySubsystem{},
+	Memory,
 	&CpuSubsystem{},
 	&CpusetSubsystem{},
+	&CpuacctSubsystem{},
+	&PidsSubsystem{},
+	&BlkioSubsystem{},
+	Freezer,
 }
+
+// Memory 除了资源限制外还用于监听 OOM 事件
+var Memory = &MemorySubsystem{}
+
+// Freezer 用于暂停和恢复容器
+var Freezer = &FreezerSubsystem{}
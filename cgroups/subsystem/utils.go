@@ -8,30 +8,71 @@ import (
 	"strings"
 
 	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 const mountPointIndex = 4
 
-// getCgroupPath 找到cgroup在文件系统中的绝对路径
+// ErrNotMounted 宿主机没有挂载Subsystem对应的 v1 hierarchy
+var ErrNotMounted = errors.New("cgroup subsystem is not mounted")
+
+// getCgroupPath 找到cgroup在文件系统中的绝对路径，Subsystem没有挂载时返回 ErrNotMounted
 func getCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string, error) {
 	cgroupRoot := findCgroupMountpoint(subsystem)
+	if cgroupRoot == "" {
+		return "", errors.WithMessagef(ErrNotMounted, "subsystem %s", subsystem)
+	}
 	absPath := path.Join(cgroupRoot, cgroupPath)
 	if !autoCreate {
 		return absPath, nil
 	}
 	// 判断是否存在文件
 	_, err := os.Stat(absPath)
-	// 如果不存在，则创建
+	// 如果不存在，则级联创建，容器的cgroup位于 tiny-docker/{containerId} 下
 	if err != nil && os.IsNotExist(err) {
-		err = os.Mkdir(absPath, constant.Perm0755)
+		err = os.MkdirAll(absPath, constant.Perm0755)
 		return absPath, err
 	}
+	// 已经存在时直接复用，便于对运行中的容器重新设置资源限制
+	return absPath, err
+}
 
-	if err == nil {
-		err = fmt.Errorf("create cgroup")
+// getCgroupV2Path 找到cgroup在 v2 统一 hierarchy 中的绝对路径
+func getCgroupV2Path(cgroupPath string, autoCreate bool) (string, error) {
+	cgroupRoot := findCgroupV2Mountpoint()
+	if cgroupRoot == "" {
+		return "", fmt.Errorf("cgroup v2 is not mounted")
 	}
-	return absPath, err
+	absPath := path.Join(cgroupRoot, cgroupPath)
+	if !autoCreate {
+		return absPath, nil
+	}
+	if err := os.MkdirAll(absPath, constant.Perm0755); err != nil {
+		return absPath, err
+	}
+	return absPath, nil
+}
+
+// findCgroupV2Mountpoint 找到 cgroup2 文件系统的挂载点
+func findCgroupV2Mountpoint() string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 30 24 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate
+		field := strings.Split(scanner.Text(), " ")
+		for i, item := range field {
+			if item == "-" && i+1 < len(field) && field[i+1] == "cgroup2" {
+				return field[mountPointIndex]
+			}
+		}
+	}
+	return ""
 }
 
 func findCgroupMountpoint(subsystem string) string {
@@ -1,9 +1,37 @@
 package subsystem
 
-import "testing"
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
 
 func TestFindCgroupMountpoint(t *testing.T) {
 	t.Logf("cpu subsystem mount point %v\n", findCgroupMountpoint("cpu"))
 	t.Logf("cpuset subsystem mount point %v\n", findCgroupMountpoint("cpuset"))
 	t.Logf("memory subsystem mount point %v\n", findCgroupMountpoint("memory"))
 }
+
+func TestNotMountedSubsystem(t *testing.T) {
+	// 在临时目录中执行，确认不会在当前目录下创建相对路径的cgroup
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err = applyPid("notmounted", "tiny-docker/test", os.Getpid()); err != nil {
+		t.Fatalf("apply pid to not mounted subsystem should be skipped, got %v", err)
+	}
+	if _, err = getCgroupPath("notmounted", "tiny-docker/test", true); !errors.Is(err, ErrNotMounted) {
+		t.Fatalf("get cgroup path of not mounted subsystem should fail, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("not mounted subsystem created %s in current dir", entries[0].Name())
+	}
+}
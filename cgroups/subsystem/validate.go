@@ -0,0 +1,143 @@
+package subsystem
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// minMemoryLimit 内存限制过小时容器进程无法启动，与 docker 保持一致
+	minMemoryLimit = 6 * utils.MiB
+	// minCpus cfs quota 最小为 1ms，即 1% 个cpu
+	minCpus        = 0.01
+	minCpuShares   = 2
+	maxCpuShares   = 262144
+	minBlkioWeight = 10
+	maxBlkioWeight = 1000
+	// unlimited 表示不限制，用于 memory-swap 和 pids-limit
+	unlimited = "-1"
+)
+
+// Validate 检查资源限制是否合法，并将内存大小统一转换为字节数
+/*
+cgroup 文件只接受整数形式的字节数或 k、m、g 后缀，1.5g、100MiB 等写入时会报错，
+这里在写入 cgroup 之前统一解析单位，并根据宿主机的内存总量和在线cpu检查限制的范围。
+*/
+func (r *ResourceConfig) Validate() error {
+	if err := r.validateMemory(); err != nil {
+		return err
+	}
+	if err := r.validateCpu(); err != nil {
+		return err
+	}
+	if r.PidsLimit < -1 {
+		return fmt.Errorf("invalid pids limit %d, must be positive or -1 for unlimited", r.PidsLimit)
+	}
+	if r.BlkioWeight != 0 && (r.BlkioWeight < minBlkioWeight || r.BlkioWeight > maxBlkioWeight) {
+		return fmt.Errorf("invalid blkio weight %d, must be between %d and %d", r.BlkioWeight, minBlkioWeight, maxBlkioWeight)
+	}
+	for _, devices := range [][]string{r.DeviceReadBps, r.DeviceWriteBps, r.DeviceReadIOps, r.DeviceWriteIOps} {
+		for _, device := range devices {
+			if _, err := parseThrottleDevice(device); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateMemory 检查内存限制、swap 限制以及软限制
+func (r *ResourceConfig) validateMemory() error {
+	if r.MemoryLimit == "" && r.MemorySwap == "" && r.MemoryReservation == "" {
+		return nil
+	}
+	memTotal, err := utils.GetMemoryTotal()
+	if err != nil {
+		return errors.WithMessage(err, "get host memory total failed")
+	}
+
+	var limit int64
+	if r.MemoryLimit != "" {
+		if limit, err = utils.RAMInBytes(r.MemoryLimit); err != nil {
+			return errors.WithMessage(err, "invalid memory limit")
+		}
+		if limit < minMemoryLimit {
+			return fmt.Errorf("memory limit %s is too small, minimum allowed is %s", r.MemoryLimit, utils.HumanSize(minMemoryLimit))
+		}
+		if uint64(limit) > memTotal {
+			return fmt.Errorf("memory limit %s exceeds host memory %s", r.MemoryLimit, utils.HumanSize(memTotal))
+		}
+		r.MemoryLimit = strconv.FormatInt(limit, 10)
+	}
+
+	if r.MemorySwap != "" && r.MemorySwap != unlimited {
+		if r.MemoryLimit == "" {
+			return fmt.Errorf("memory swap can not be set without memory limit")
+		}
+		swap, err := utils.RAMInBytes(r.MemorySwap)
+		if err != nil {
+			return errors.WithMessage(err, "invalid memory swap")
+		}
+		// memory-swap 是内存和 swap 的总和，不能小于内存限制
+		if swap < limit {
+			return fmt.Errorf("memory swap %s must be larger than or equal to memory limit %s", r.MemorySwap, utils.HumanSize(uint64(limit)))
+		}
+		r.MemorySwap = strconv.FormatInt(swap, 10)
+	}
+
+	if r.MemoryReservation != "" {
+		reservation, err := utils.RAMInBytes(r.MemoryReservation)
+		if err != nil {
+			return errors.WithMessage(err, "invalid memory reservation")
+		}
+		if r.MemoryLimit != "" && reservation > limit {
+			return fmt.Errorf("memory reservation %s must be smaller than memory limit %s", r.MemoryReservation, utils.HumanSize(uint64(limit)))
+		}
+		if uint64(reservation) > memTotal {
+			return fmt.Errorf("memory reservation %s exceeds host memory %s", r.MemoryReservation, utils.HumanSize(memTotal))
+		}
+		r.MemoryReservation = strconv.FormatInt(reservation, 10)
+	}
+	return nil
+}
+
+// validateCpu 检查cpu使用率、cpu核数、cpu权重以及cpuset
+func (r *ResourceConfig) validateCpu() error {
+	if r.CpuCfsQuota == 0 && r.Cpus == 0 && r.CpuShare == "" && r.CpuSet == "" {
+		return nil
+	}
+	online, err := utils.GetOnlineCPUs()
+	if err != nil {
+		return errors.WithMessage(err, "get host online cpus failed")
+	}
+
+	// --cpu 为单个cpu的百分比，最多可以使用所有在线cpu
+	maxQuota := Percent * len(online)
+	if r.CpuCfsQuota < 0 || r.CpuCfsQuota > maxQuota {
+		return fmt.Errorf("invalid cpu quota %d, must be between 1 and %d", r.CpuCfsQuota, maxQuota)
+	}
+	if r.Cpus != 0 && (r.Cpus < minCpus || r.Cpus > float64(len(online))) {
+		return fmt.Errorf("invalid cpus %g, must be between %g and %d", r.Cpus, minCpus, len(online))
+	}
+	if r.CpuShare != "" {
+		shares, err := strconv.Atoi(r.CpuShare)
+		if err != nil || shares < minCpuShares || shares > maxCpuShares {
+			return fmt.Errorf("invalid cpu shares %s, must be between %d and %d", r.CpuShare, minCpuShares, maxCpuShares)
+		}
+	}
+	if r.CpuSet != "" {
+		cpus, err := utils.ParseCPUList(r.CpuSet)
+		if err != nil {
+			return errors.WithMessage(err, "invalid cpuset")
+		}
+		for cpu := range cpus {
+			if !online[cpu] {
+				return fmt.Errorf("cpu %d in cpuset %s is not online", cpu, r.CpuSet)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package client 提供管理容器的 Go SDK
+/*
+Client 直接在本地创建和管理容器，DaemonClient 通过 daemon 的 HTTP API 管理容器，两者都实现了 API 接口，
+tiny-docker 的命令行和 daemon 都基于这个包实现。
+容器的 init 进程、supervisor 以及 exec 需要通过 tiny-docker 可执行文件启动，在其他程序中使用 Client 时需要通过
+Config.Binary 指定 tiny-docker 可执行文件的路径。
+*/
+package client
+
+import (
+	"context"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+)
+
+// defaultBinary 未指定可执行文件时重新执行当前程序，适用于 tiny-docker 命令行本身
+const defaultBinary = "/proc/self/exe"
+
+// Config Client 的配置
+type Config struct {
+	// Binary tiny-docker 可执行文件的路径，为空时使用 /proc/self/exe
+	Binary string
+}
+
+// Client 在本地直接管理容器
+type Client struct {
+	binary string
+}
+
+// New 创建本地管理容器的 Client
+func New(cfg Config) *Client {
+	binary := cfg.Binary
+	if binary == "" {
+		binary = defaultBinary
+	}
+	return &Client{binary: binary}
+}
+
+// API 本地执行和通过 daemon 执行都支持的操作
+type API interface {
+	// Create 创建容器但不启动，返回容器id
+	Create(opts *CreateOptions) (string, error)
+	// Start 在后台启动已创建的容器
+	Start(containerId string) error
+	// Stop 停止容器，超时后强制杀死
+	Stop(containerId string, opts *StopOptions) error
+	// Kill 向容器的init进程发送信号
+	Kill(containerId string, signal string) error
+	// Pause 挂起容器内的所有进程
+	Pause(containerId string) error
+	// Unpause 恢复被挂起的容器
+	Unpause(containerId string) error
+	// Remove 删除容器
+	Remove(containerId string, opts *RemoveOptions) error
+	// List 列出所有容器
+	List() ([]*container.Info, error)
+	// Rename 修改容器名
+	Rename(containerId string, name string) error
+	// Update 更新运行中容器的资源限制
+	Update(containerId string, update *subsystem.ResourceConfig) error
+	// Commit 将容器的文件系统打包为镜像
+	Commit(containerId string, imageName string) error
+	// Inspect 获取容器的详细信息
+	Inspect(containerId string) (*ContainerInspect, error)
+	// Port 获取容器当前生效的端口映射
+	Port(containerId string) ([]network.PortBinding, error)
+	// Logs 获取后台运行容器的日志
+	Logs(containerId string, opts *LogsOptions) ([]byte, error)
+	// Events 读取容器、网络和镜像的事件并依次调用 fn
+	Events(ctx context.Context, opts *EventsOptions, fn func(*events.Event) error) error
+
+	// CreateNetwork 创建网络
+	CreateNetwork(opts *NetworkCreateOptions) error
+	// ListNetworks 列出所有网络
+	ListNetworks() ([]*network.Network, error)
+	// InspectNetwork 获取网络以及连接到这个网络的容器信息
+	InspectNetwork(name string) (*network.NetworkInspect, error)
+	// RemoveNetwork 删除网络
+	RemoveNetwork(name string) error
+	// ConnectNetwork 将运行中的容器连接到网络
+	ConnectNetwork(name string, opts *NetworkConnectOptions) error
+	// DisconnectNetwork 将容器从网络中断开
+	DisconnectNetwork(name string, containerId string) error
+	// Firewall 获取宿主机配置网络规则使用的防火墙后端
+	Firewall() (*network.FirewallInfo, error)
+	// SetFirewall 修改宿主机的防火墙后端，并将现有的网络规则迁移到新的后端
+	SetFirewall(backend string) error
+	// ListImages 列出所有镜像
+	ListImages() ([]*container.Image, error)
+	// InspectImage 获取镜像信息
+	InspectImage(name string) (*container.Image, error)
+}
+
+var (
+	_ API = (*Client)(nil)
+	_ API = (*DaemonClient)(nil)
+)
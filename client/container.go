@@ -0,0 +1,240 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// lookupContainer 根据容器id、容器名或唯一的容器id前缀读取容器信息，前缀匹配到多个容器时返回参数错误
+func lookupContainer(ref string) (*container.Info, error) {
+	info, err := container.Lookup(ref)
+	if errors.Is(err, container.ErrAmbiguousID) {
+		return nil, invalidParameter(err)
+	}
+	return info, err
+}
+
+// resolveContainer 将容器id、容器名或唯一的容器id前缀转换为完整的容器id
+func resolveContainer(ref string) (string, error) {
+	containerId, err := container.ResolveID(ref)
+	if errors.Is(err, container.ErrAmbiguousID) {
+		return "", invalidParameter(err)
+	}
+	return containerId, err
+}
+
+// Remove 删除容器，运行中的容器需要指定 opts.Force 强制删除
+func (c *Client) Remove(containerId string, opts *RemoveOptions) error {
+	force := opts != nil && opts.Force
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return err
+	}
+	return removeContainer(containerId, force)
+}
+
+func removeContainer(containerId string, force bool) error {
+	// 查询对应容器信息
+	containerInfo, err := container.GetInfo(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	// 其他运行中的容器还在使用该容器的 namespace 时不允许删除
+	users, err := container.NamespaceUsers(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "check container [%s]'s namespace users failed", containerId)
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("couldn't remove container [%s], its namespaces are used by containers %v", containerId, users)
+	}
+	switch containerInfo.Status {
+	case container.CREATED: // 未启动的容器还没有创建工作目录
+		if err = container.DeleteContainerInfo(containerId); err != nil {
+			return err
+		}
+		containerEvent(events.ActionDestroy, containerInfo, nil)
+		return nil
+	case container.STOP, container.Exit: // STOP或已退出的容器直接删除
+		// 先删除目录
+		if err = container.DeleteContainerInfo(containerId); err != nil {
+			return errors.WithMessagef(err, "remove container [%s]'s config failed", containerId)
+		}
+		// 删除工作文件夹，网络和cgroup资源已经在 stop 或容器退出时释放
+		container.DeleteWorkSpace(containerId, containerInfo.Volume)
+		containerEvent(events.ActionDestroy, containerInfo, nil)
+		return nil
+	case container.RUNNING, container.PAUSED: // 如果状态为运行中，判断是否强制删除，如果强制删除则先停止再删除
+		if !force {
+			return fmt.Errorf("couldn't remove running container [%s], stop the container before attempting removal or force remove", containerId)
+		}
+		logrus.Infof("force delete running container [%s]", containerId)
+		// 强制删除不等待容器优雅退出
+		if err = stopContainer(containerId, 0); err != nil {
+			return errors.WithMessagef(err, "stop container [%s] failed", containerId)
+		}
+		return removeContainer(containerId, force)
+	default:
+		return fmt.Errorf("couldn't remove container, invalid status %s", containerInfo.Status)
+	}
+}
+
+// Rename 修改容器名，新容器名不能被其他容器使用
+func (c *Client) Rename(containerId string, name string) error {
+	if err := container.ValidateName(name); err != nil {
+		return invalidParameter(err)
+	}
+	containerInfo, err := lookupContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = containerInfo.Id
+	if containerInfo.Name == name {
+		return invalidParameter(fmt.Errorf("container %s is already named %s", containerId, name))
+	}
+	if err = container.ReserveName(name, containerId); err != nil {
+		return invalidParameter(err)
+	}
+	var oldName string
+	err = container.UpdateInfo(containerId, func(info *container.Info) error {
+		oldName = info.Name
+		info.Name = name
+		containerInfo = info
+		return nil
+	})
+	if err != nil {
+		container.ReleaseName(name, containerId)
+		return errors.WithMessagef(err, "rename container %s failed", containerId)
+	}
+	container.ReleaseName(oldName, containerId)
+	containerEvent(events.ActionRename, containerInfo, map[string]string{"oldName": oldName})
+	return nil
+}
+
+// List 列出所有容器
+func (c *Client) List() ([]*container.Info, error) {
+	infos, err := container.ListInfos()
+	if err != nil {
+		return nil, errors.WithMessage(err, "list container info failed")
+	}
+	return infos, nil
+}
+
+// Logs 读取后台运行容器的日志文件
+func (c *Client) Logs(containerId string, opts *LogsOptions) ([]byte, error) {
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+	logFileLocation := path.Join(fmt.Sprintf(container.InfoLocFormat, containerId), container.GetLogFile(containerId))
+	content, err := os.ReadFile(logFileLocation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read log file %s failed", logFileLocation)
+	}
+	if opts == nil || opts.Tail <= 0 {
+		return content, nil
+	}
+	return tailLines(content, opts.Tail), nil
+}
+
+// tailLines 返回最后 n 行内容
+func tailLines(content []byte, n int) []byte {
+	// 忽略结尾的换行符，避免最后的空行被计算为一行
+	end := len(content)
+	if end > 0 && content[end-1] == '\n' {
+		end--
+	}
+	start := end
+	for ; n > 0; n-- {
+		idx := bytes.LastIndexByte(content[:start], '\n')
+		if idx < 0 {
+			return content
+		}
+		start = idx
+	}
+	return content[start+1:]
+}
+
+// Pause 通过 freezer 挂起容器内的所有进程
+// 状态在容器信息的锁内检查和修改，避免覆盖 supervisor 或 stop 同时记录的退出信息
+func (c *Client) Pause(containerId string) error {
+	id, err := resolveContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = id
+	return container.UpdateInfo(containerId, func(info *container.Info) error {
+		if info.Status != container.RUNNING {
+			return fmt.Errorf("container %s is not running, status %s", containerId, info.Status)
+		}
+		if err := cgroups.NewContainerCgroupManager(containerId).Freeze(); err != nil {
+			return errors.WithMessagef(err, "freeze container %s failed", containerId)
+		}
+		info.Status = container.PAUSED
+		return nil
+	})
+}
+
+// Unpause 恢复被挂起的容器
+func (c *Client) Unpause(containerId string) error {
+	id, err := resolveContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = id
+	return container.UpdateInfo(containerId, func(info *container.Info) error {
+		if info.Status != container.PAUSED {
+			return fmt.Errorf("container %s is not paused, status %s", containerId, info.Status)
+		}
+		if err := cgroups.NewContainerCgroupManager(containerId).Thaw(); err != nil {
+			return errors.WithMessagef(err, "thaw container %s failed", containerId)
+		}
+		info.Status = container.RUNNING
+		return nil
+	})
+}
+
+// Commit 将容器的文件系统打包为镜像
+func (c *Client) Commit(containerId string, imageName string) error {
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return err
+	}
+	mntPath := utils.GetMerged(containerId)
+	imageTar := utils.GetImage(imageName)
+	exist, err := utils.PathExists(imageTar)
+	if err != nil {
+		return errors.WithMessagef(err, "check is image [%s/%s] exist failed", imageName, imageTar)
+	}
+
+	if exist {
+		return invalidParameter(fmt.Errorf("image %s already exist", imageName))
+	}
+	logrus.Infof("commitContainer imageTar:%s", imageTar)
+	output, err := exec.Command("tar", "-czf", imageTar, "-C", mntPath, ".").CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "tar folder %s failed: %s", mntPath, output)
+	}
+	// 新镜像继承容器的停止信号和暴露的端口
+	containerInfo, err := container.GetInfo(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container [%s] info failed", containerId)
+	}
+	if containerInfo.StopSignal != "" || len(containerInfo.ExposedPorts) > 0 {
+		imageConfig := &container.ImageConfig{StopSignal: containerInfo.StopSignal, ExposedPorts: containerInfo.ExposedPorts}
+		if err = container.SaveImageConfig(imageName, imageConfig); err != nil {
+			return err
+		}
+	}
+	events.Log(events.TypeImage, events.ActionCommit, imageName, map[string]string{"container": containerId})
+	return nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTailLines(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int
+		want    string
+	}{
+		{"a\nb\nc\n", 1, "c\n"},
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\nc\n", 5, "a\nb\nc\n"},
+		{"", 3, ""},
+	}
+	for _, test := range tests {
+		got := string(tailLines([]byte(test.content), test.n))
+		if got != test.want {
+			t.Fatalf("tail %d lines of %q, want %q, got %q", test.n, test.content, test.want, got)
+		}
+	}
+}
+
+func TestIsInvalidParameter(t *testing.T) {
+	err := errors.WithMessage(invalidParameter(fmt.Errorf("missing command")), "create container failed")
+	if !IsInvalidParameter(err) {
+		t.Fatalf("wrapped error %v should be invalid parameter", err)
+	}
+	if IsInvalidParameter(fmt.Errorf("missing command")) || invalidParameter(nil) != nil {
+		t.Fatalf("unexpected invalid parameter error")
+	}
+	if !IsNotFound(notFoundError{fmt.Errorf("no such container")}) {
+		t.Fatalf("not found error should match os.ErrNotExist")
+	}
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// createOptionsName create 时保存创建参数的文件
+	createOptionsName = "run.json"
+	// readyFdIndex supervisor 通过第一个额外的文件描述符通知启动进程容器的启动结果
+	readyFdIndex = 3
+)
+
+// startResult supervisor 启动容器的结果
+type startResult struct {
+	Id    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// Create 创建容器但不启动，保存创建参数并记录状态为 created 的容器信息
+func (c *Client) Create(opts *CreateOptions) (string, error) {
+	if opts.Tty {
+		return "", invalidParameter(fmt.Errorf("created container can not attach tty"))
+	}
+	if err := opts.Validate(); err != nil {
+		return "", invalidParameter(err)
+	}
+	containerId := container.GenerateContainerID()
+	containerInfo := opts.containerInfo(containerId)
+	if containerInfo.Name == "" {
+		containerInfo.Name = container.ShortID(containerId)
+	}
+	if err := container.ReserveName(containerInfo.Name, containerId); err != nil {
+		return "", invalidParameter(err)
+	}
+	containerInfo.Command = strings.Join(opts.Cmd, "")
+	containerInfo.CreatedTime = time.Now().Format(container.TimeFormat)
+	containerInfo.Status = container.CREATED
+	if err := container.SaveInfo(containerInfo); err != nil {
+		container.ReleaseName(containerInfo.Name, containerId)
+		_ = container.DeleteContainerInfo(containerId)
+		return "", err
+	}
+
+	if err := saveCreateOptions(containerId, opts); err != nil {
+		_ = container.DeleteContainerInfo(containerId)
+		return "", err
+	}
+	containerEvent(events.ActionCreate, containerInfo, nil)
+	return containerId, nil
+}
+
+// saveCreateOptions 保存创建参数，先写入临时文件再重命名，避免 supervisor 读到写了一半的文件
+func saveCreateOptions(containerId string, opts *CreateOptions) error {
+	content, err := json.Marshal(opts)
+	if err != nil {
+		return errors.Wrap(err, "marshal create options failed")
+	}
+	optionsPath := path.Join(fmt.Sprintf(container.InfoLocFormat, containerId), createOptionsName)
+	tmpPath := optionsPath + ".tmp"
+	if err = os.WriteFile(tmpPath, content, constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", tmpPath)
+	}
+	if err = os.Rename(tmpPath, optionsPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "rename %s failed", tmpPath)
+	}
+	return nil
+}
+
+// loadCreateOptions 读取 create 时保存的创建参数
+func loadCreateOptions(containerId string) (*CreateOptions, error) {
+	optionsPath := path.Join(fmt.Sprintf(container.InfoLocFormat, containerId), createOptionsName)
+	content, err := os.ReadFile(optionsPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s failed", optionsPath)
+	}
+	opts := &CreateOptions{}
+	if err = json.Unmarshal(content, opts); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s failed", optionsPath)
+	}
+	return opts, nil
+}
+
+// Start 启动 supervisor 进程在后台运行已创建的容器
+/*
+容器进程只有被它的父进程 wait 时才能拿到退出码，因此后台运行的容器不能由 CLI 或 daemon 直接启动，
+这里执行 supervise 命令，由这个脱离终端的 supervisor 进程启动容器并等待容器退出，
+启动进程通过管道等待 supervisor 返回的启动结果。
+*/
+func (c *Client) Start(containerId string) error {
+	containerInfo, err := lookupContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = containerInfo.Id
+	if containerInfo.Status != container.CREATED {
+		return fmt.Errorf("container %s can not be started, status %s", containerId, containerInfo.Status)
+	}
+
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "create pipe failed")
+	}
+	defer readPipe.Close()
+
+	cmd := exec.Command(c.binary, "supervise", containerId)
+	cmd.ExtraFiles = []*os.File{writePipe}
+	// 创建新的会话，使 supervisor 脱离当前终端，daemon 退出后也不受影响
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	writePipe.Close()
+	if err != nil {
+		return errors.Wrap(err, "start supervisor failed")
+	}
+	// supervisor 会在容器退出后自行退出，在后台回收，避免 daemon 中残留僵尸进程
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	content, err := io.ReadAll(readPipe)
+	if err != nil {
+		return errors.Wrap(err, "read supervisor start result failed")
+	}
+	result := &startResult{}
+	if err = json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("supervisor exited before container started")
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// Supervise supervisor 进程的入口，启动容器并等待容器退出，只能在 Start 启动的 supervise 命令中调用
+func (c *Client) Supervise(containerId string) error {
+	ready := openReadyPipe()
+	opts, err := loadCreateOptions(containerId)
+	if err != nil {
+		notifyStartResult(ready, containerId, err)
+		return err
+	}
+	if err = c.run(containerId, opts, ready); err != nil {
+		// 启动失败时通知启动进程，启动成功时 run 内部已经通知
+		notifyStartResult(ready, containerId, err)
+		return err
+	}
+	return nil
+}
+
+// openReadyPipe 获取 supervisor 用于通知启动结果的管道
+func openReadyPipe() *os.File {
+	// 避免管道被 supervisor 启动的其他进程继承，导致启动进程无法读到 EOF
+	syscall.CloseOnExec(readyFdIndex)
+	return os.NewFile(uintptr(readyFdIndex), "ready")
+}
+
+// notifyStartResult 将容器启动结果写入管道并关闭
+func notifyStartResult(ready *os.File, containerId string, startErr error) {
+	if ready == nil {
+		return
+	}
+	defer ready.Close()
+	result := &startResult{Id: containerId}
+	if startErr != nil {
+		result.Error = startErr.Error()
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		logrus.Errorf("marshal start result error %v", err)
+		return
+	}
+	if _, err = ready.Write(content); err != nil {
+		logrus.Errorf("write start result error %v", err)
+	}
+}
+
+// superviseContainer 等待后台容器退出，记录退出码、是否被 OOM killer 杀死以及退出时间，并释放容器资源
+func superviseContainer(parent *exec.Cmd, containerInfo *container.Info, cgroupManager *cgroups.CgroupManager) {
+	containerId := containerInfo.Id
+	var oomKilled atomic.Bool
+	oomCh, err := cgroupManager.NotifyOOM()
+	if err != nil {
+		logrus.Warnf("watch container %s oom event error %v", containerId, err)
+	} else {
+		go func() {
+			for range oomCh {
+				logrus.Warnf("container %s memory exceeded, oom killer triggered", containerId)
+				if oomKilled.CompareAndSwap(false, true) {
+					containerEvent(events.ActionOOM, containerInfo, nil)
+				}
+			}
+		}()
+	}
+
+	_ = parent.Wait()
+	exitCode := container.ExitCode(parent.ProcessState)
+	// 监听到的事件可能晚于进程退出，再通过 oom_kill 计数确认一次
+	oom := oomKilled.Load()
+	if !oom && cgroupManager.OOMKilled() && oomKilled.CompareAndSwap(false, true) {
+		oom = true
+		containerEvent(events.ActionOOM, containerInfo, nil)
+	}
+	logrus.Infof("container %s exited with code %d, oom killed: %v", containerId, exitCode, oom)
+	containerEvent(events.ActionDie, containerInfo, map[string]string{"exitCode": strconv.Itoa(exitCode)})
+
+	err = container.UpdateInfo(containerId, func(info *container.Info) error {
+		releaseContainerResources(info)
+		// 通过 stop 停止的容器保留 stopped 状态
+		if info.Status != container.STOP {
+			info.Status = container.Exit
+		}
+		info.Pid = ""
+		info.ExitCode = exitCode
+		info.OOMKilled = oom
+		info.FinishedTime = time.Now().Format(container.TimeFormat)
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("record container %s exit info error %v", containerId, err)
+	}
+}
@@ -0,0 +1,326 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/pkg/errors"
+)
+
+const (
+	// UnixSchema 通过 unix socket 访问 daemon 的 host 前缀
+	UnixSchema = "unix://"
+	// daemonURL 通过 unix socket 访问时 host 部分不会被使用
+	daemonURL = "http://tiny-docker"
+)
+
+// CreateResponse 创建容器的返回结果
+type CreateResponse struct {
+	Id string `json:"id"`
+}
+
+// DaemonClient 通过 daemon 的 HTTP API 管理容器
+type DaemonClient struct {
+	client *http.Client
+}
+
+// NewDaemonClient 创建 daemon 客户端，host 格式为 unix:///run/tiny-docker.sock
+func NewDaemonClient(host string) (*DaemonClient, error) {
+	socketPath, ok := strings.CutPrefix(host, UnixSchema)
+	if !ok || socketPath == "" {
+		return nil, fmt.Errorf("unsupported host %s, must be %s<socket path>", host, UnixSchema)
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &DaemonClient{client: &http.Client{Transport: transport}}, nil
+}
+
+// do 发送请求，in 不为 nil 时作为 JSON 请求体，out 不为 nil 时解析 JSON 返回结果
+func (c *DaemonClient) do(method, path string, query url.Values, in, out any) error {
+	resp, err := c.request(context.Background(), method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "decode %s %s response failed", method, path)
+	}
+	return nil
+}
+
+// request 发送请求，状态码不是 2xx 时返回 daemon 的错误信息，400 和 404 分别转换为参数错误和不存在的错误
+func (c *DaemonClient) request(ctx context.Context, method, path string, query url.Values, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal request body failed")
+		}
+		body = bytes.NewReader(content)
+	}
+	reqURL := daemonURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request failed")
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to daemon failed")
+	}
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := &ErrorResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+		err = fmt.Errorf("daemon returned %s", resp.Status)
+	} else {
+		err = errors.New(apiErr.Message)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		return nil, invalidParameter(err)
+	case http.StatusNotFound:
+		return nil, notFoundError{err}
+	default:
+		return nil, err
+	}
+}
+
+// Create 创建容器但不启动，返回容器id
+func (c *DaemonClient) Create(opts *CreateOptions) (string, error) {
+	resp := &CreateResponse{}
+	if err := c.do(http.MethodPost, "/containers/create", nil, opts, resp); err != nil {
+		return "", err
+	}
+	return resp.Id, nil
+}
+
+// Start 在后台启动已创建的容器
+func (c *DaemonClient) Start(containerId string) error {
+	return c.do(http.MethodPost, containerPath(containerId, "start"), nil, nil, nil)
+}
+
+// Stop 停止容器，opts 为空时使用 daemon 默认的超时时间
+func (c *DaemonClient) Stop(containerId string, opts *StopOptions) error {
+	var query url.Values
+	if opts != nil {
+		query = url.Values{"t": {strconv.Itoa(opts.Timeout)}}
+	}
+	return c.do(http.MethodPost, containerPath(containerId, "stop"), query, nil, nil)
+}
+
+// Kill 向容器的init进程发送信号
+func (c *DaemonClient) Kill(containerId string, signal string) error {
+	query := url.Values{"signal": {signal}}
+	return c.do(http.MethodPost, containerPath(containerId, "kill"), query, nil, nil)
+}
+
+// Pause 挂起容器内的所有进程
+func (c *DaemonClient) Pause(containerId string) error {
+	return c.do(http.MethodPost, containerPath(containerId, "pause"), nil, nil, nil)
+}
+
+// Unpause 恢复被挂起的容器
+func (c *DaemonClient) Unpause(containerId string) error {
+	return c.do(http.MethodPost, containerPath(containerId, "unpause"), nil, nil, nil)
+}
+
+// Remove 删除容器
+func (c *DaemonClient) Remove(containerId string, opts *RemoveOptions) error {
+	force := opts != nil && opts.Force
+	query := url.Values{"force": {strconv.FormatBool(force)}}
+	return c.do(http.MethodDelete, containerPath(containerId, ""), query, nil, nil)
+}
+
+// Rename 修改容器名
+func (c *DaemonClient) Rename(containerId string, name string) error {
+	query := url.Values{"name": {name}}
+	return c.do(http.MethodPost, containerPath(containerId, "rename"), query, nil, nil)
+}
+
+// Update 更新运行中容器的资源限制
+func (c *DaemonClient) Update(containerId string, update *subsystem.ResourceConfig) error {
+	return c.do(http.MethodPost, containerPath(containerId, "update"), nil, update, nil)
+}
+
+// Commit 将容器的文件系统打包为镜像
+func (c *DaemonClient) Commit(containerId string, imageName string) error {
+	query := url.Values{"container": {containerId}, "repo": {imageName}}
+	return c.do(http.MethodPost, "/commit", query, nil, nil)
+}
+
+// List 列出所有容器
+func (c *DaemonClient) List() ([]*container.Info, error) {
+	var infos []*container.Info
+	err := c.do(http.MethodGet, "/containers/json", nil, nil, &infos)
+	return infos, err
+}
+
+// Inspect 获取容器的详细信息
+func (c *DaemonClient) Inspect(containerId string) (*ContainerInspect, error) {
+	info := &ContainerInspect{}
+	if err := c.do(http.MethodGet, containerPath(containerId, "json"), nil, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Port 获取容器当前生效的端口映射
+func (c *DaemonClient) Port(containerId string) ([]network.PortBinding, error) {
+	var bindings []network.PortBinding
+	if err := c.do(http.MethodGet, containerPath(containerId, "port"), nil, nil, &bindings); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// Logs 获取后台运行容器的日志
+func (c *DaemonClient) Logs(containerId string, opts *LogsOptions) ([]byte, error) {
+	var query url.Values
+	if opts != nil && opts.Tail > 0 {
+		query = url.Values{"tail": {strconv.Itoa(opts.Tail)}}
+	}
+	resp, err := c.request(context.Background(), http.MethodGet, containerPath(containerId, "logs"), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Events 读取 daemon 推送的事件并依次调用 fn，daemon 每行返回一个 JSON 格式的事件
+func (c *DaemonClient) Events(ctx context.Context, opts *EventsOptions, fn func(*events.Event) error) error {
+	query := url.Values{}
+	if opts != nil {
+		if !opts.Since.IsZero() {
+			query.Set("since", events.FormatTimestamp(opts.Since))
+		}
+		if !opts.Until.IsZero() {
+			query.Set("until", events.FormatTimestamp(opts.Until))
+		}
+		for _, filter := range opts.Filter.Args() {
+			query.Add("filters", filter)
+		}
+	}
+	resp, err := c.request(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := &events.Event{}
+		if err = decoder.Decode(event); err != nil {
+			// 读取到末尾或者 ctx 取消时正常结束
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "decode event failed")
+		}
+		if err = fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// CreateNetwork 创建网络
+func (c *DaemonClient) CreateNetwork(opts *NetworkCreateOptions) error {
+	return c.do(http.MethodPost, "/networks/create", nil, opts, nil)
+}
+
+// ListNetworks 列出所有网络
+func (c *DaemonClient) ListNetworks() ([]*network.Network, error) {
+	var networks []*network.Network
+	err := c.do(http.MethodGet, "/networks", nil, nil, &networks)
+	return networks, err
+}
+
+// InspectNetwork 获取网络以及连接到这个网络的容器信息
+func (c *DaemonClient) InspectNetwork(name string) (*network.NetworkInspect, error) {
+	result := &network.NetworkInspect{}
+	if err := c.do(http.MethodGet, "/networks/"+url.PathEscape(name), nil, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RemoveNetwork 删除网络
+func (c *DaemonClient) RemoveNetwork(name string) error {
+	return c.do(http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// ConnectNetwork 将运行中的容器连接到网络
+func (c *DaemonClient) ConnectNetwork(name string, opts *NetworkConnectOptions) error {
+	return c.do(http.MethodPost, "/networks/"+url.PathEscape(name)+"/connect", nil, opts, nil)
+}
+
+// DisconnectNetwork 将容器从网络中断开
+func (c *DaemonClient) DisconnectNetwork(name string, containerId string) error {
+	opts := &NetworkConnectOptions{Container: containerId}
+	return c.do(http.MethodPost, "/networks/"+url.PathEscape(name)+"/disconnect", nil, opts, nil)
+}
+
+// Firewall 获取宿主机配置网络规则使用的防火墙后端
+func (c *DaemonClient) Firewall() (*network.FirewallInfo, error) {
+	info := &network.FirewallInfo{}
+	if err := c.do(http.MethodGet, "/firewall", nil, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// SetFirewall 修改宿主机的防火墙后端，并将现有的网络规则迁移到新的后端
+func (c *DaemonClient) SetFirewall(backend string) error {
+	return c.do(http.MethodPost, "/firewall", nil, &network.FirewallInfo{Backend: backend}, nil)
+}
+
+// ListImages 列出所有镜像
+func (c *DaemonClient) ListImages() ([]*container.Image, error) {
+	var images []*container.Image
+	err := c.do(http.MethodGet, "/images/json", nil, nil, &images)
+	return images, err
+}
+
+// InspectImage 获取镜像信息
+func (c *DaemonClient) InspectImage(name string) (*container.Image, error) {
+	image := &container.Image{}
+	if err := c.do(http.MethodGet, "/images/"+url.PathEscape(name)+"/json", nil, nil, image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// containerPath 返回容器相关接口的路径，action 为空时返回容器本身的路径
+func containerPath(containerId string, action string) string {
+	p := "/containers/" + url.PathEscape(containerId)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
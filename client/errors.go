@@ -0,0 +1,48 @@
+package client
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrorResponse daemon 返回的错误信息
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// invalidParameterError 参数错误，daemon 返回 400
+type invalidParameterError struct {
+	error
+}
+
+func (e invalidParameterError) Unwrap() error {
+	return e.error
+}
+
+// invalidParameter 将错误标记为参数错误
+func invalidParameter(err error) error {
+	if err == nil {
+		return nil
+	}
+	return invalidParameterError{err}
+}
+
+// IsInvalidParameter 判断错误是否由参数错误引起
+func IsInvalidParameter(err error) bool {
+	var target invalidParameterError
+	return errors.As(err, &target)
+}
+
+// notFoundError 通过 daemon 访问时容器、网络等不存在的错误
+type notFoundError struct {
+	error
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == os.ErrNotExist
+}
+
+// IsNotFound 判断错误是否由容器、网络等不存在引起，daemon 返回 404
+func IsNotFound(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+)
+
+// Events 读取满足条件的事件并依次调用 fn，opts.Until 为零值时持续等待新的事件，直到 ctx 取消或 fn 返回错误
+func (c *Client) Events(ctx context.Context, opts *EventsOptions, fn func(*events.Event) error) error {
+	if opts == nil {
+		opts = &EventsOptions{}
+	}
+	// ps 显示的是短id，过滤前将容器名和id前缀解析为事件中记录的完整id
+	opts.Filter.ResolveContainers()
+	return events.Watch(ctx, opts.Since, opts.Until, opts.Filter, fn)
+}
+
+// containerEvent 记录容器事件，属性中带上容器名和镜像，便于按名称和镜像过滤
+func containerEvent(action string, info *container.Info, attributes map[string]string) {
+	attrs := map[string]string{"name": info.Name, "image": info.Image}
+	for key, value := range attributes {
+		attrs[key] = value
+	}
+	events.Log(events.TypeContainer, action, info.Id, attrs)
+}
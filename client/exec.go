@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// nsenter里的C代码里已经出现tiny_docker_pid和tiny_docker_cmd这两个Key,主要是为了控制是否执行C代码里面的setns.
+const (
+	EnvExecPid = "tiny_docker_pid"
+	EnvExecCmd = "tiny_docker_cmd"
+)
+
+// Exec 在运行中的容器内执行命令，等待命令执行结束
+/*
+进入容器的 namespace 需要在 Go 运行时启动多个线程前调用 setns，因此通过环境变量将容器 pid 和命令传给
+tiny-docker exec，由 setns 包中的 C 代码在程序启动时进入容器执行命令。
+*/
+func (c *Client) Exec(containerId string, opts *ExecOptions) error {
+	if opts == nil || len(opts.Cmd) == 0 {
+		return invalidParameter(fmt.Errorf("missing exec command"))
+	}
+	containerInfo, err := lookupContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = containerInfo.Id
+	// 暂停中的容器无法执行命令，需要先恢复
+	if containerInfo.Status == container.PAUSED {
+		return fmt.Errorf("container %s is paused, unpause the container before exec", containerId)
+	}
+	pid := containerInfo.Pid
+	if pid == "" {
+		return fmt.Errorf("container %s is not running", containerId)
+	}
+
+	cmd := exec.Command(c.binary, "exec")
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+
+	// 传递命令
+	cmdStr := strings.Join(opts.Cmd, " ")
+	logrus.Infof("container pid: %s command: %s", pid, cmdStr)
+	cmd.Env = append(os.Environ(), EnvExecPid+"="+pid, EnvExecCmd+"="+cmdStr)
+	cmd.Env = append(cmd.Env, getEnvsByPid(pid)...)
+
+	if err = cmd.Run(); err != nil {
+		return errors.Wrapf(err, "exec container %s failed", containerId)
+	}
+	return nil
+}
+
+// getEnvsByPid 获取指定pid进程的环境变量
+func getEnvsByPid(pid string) []string {
+	// 环境变量存放路径
+	path := fmt.Sprintf("/proc/%s/environ", pid)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logrus.Errorf("Read file %s error %v", path, err)
+		return nil
+	}
+	// env split by \u0000
+	envs := strings.Split(string(content), "\u0000")
+	return envs
+}
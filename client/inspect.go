@@ -0,0 +1,94 @@
+package client
+
+import (
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// ContainerInspect 容器的详细信息，在 config.json 记录的容器信息之外，加上文件系统、cgroup、网络端点以及挂载信息
+type ContainerInspect struct {
+	*container.Info
+	GraphDriver GraphDriver             `json:"graphDriver"`
+	Cgroup      *cgroups.CgroupInfo     `json:"cgroup"`
+	Networks    []*network.EndpointInfo `json:"networks,omitempty"` // 容器连接的各个网络的端点信息
+	Mounts      []Mount                 `json:"mounts"`
+}
+
+// GraphDriver 容器 overlayfs 使用的目录
+type GraphDriver struct {
+	Name      string `json:"name"`
+	LowerDir  string `json:"lowerDir"`
+	UpperDir  string `json:"upperDir"`
+	WorkDir   string `json:"workDir"`
+	MergedDir string `json:"mergedDir"`
+}
+
+// Mount 容器的数据卷挂载
+type Mount struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`      // 宿主机上的路径
+	Destination string `json:"destination"` // 容器内的路径
+}
+
+// Inspect 获取容器的详细信息，containerId 可以是容器id或容器名，容器不存在时返回的错误满足 IsNotFound
+func (c *Client) Inspect(containerId string) (*ContainerInspect, error) {
+	info, err := lookupContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+	result := &ContainerInspect{
+		Info: info,
+		GraphDriver: GraphDriver{
+			Name:      "overlay",
+			LowerDir:  utils.GetLower(info.Id),
+			UpperDir:  utils.GetUpper(info.Id),
+			WorkDir:   utils.GetWorker(info.Id),
+			MergedDir: utils.GetMerged(info.Id),
+		},
+		Cgroup: cgroups.NewContainerCgroupManager(info.Id).Inspect(),
+		Mounts: []Mount{},
+	}
+	if info.Volume != "" {
+		if source, destination, err := utils.VolumeExtract(info.Volume); err == nil {
+			result.Mounts = append(result.Mounts, Mount{Type: "bind", Source: source, Destination: destination})
+		}
+	}
+	// 网络信息读取失败时仍然返回其他信息
+	if result.Networks, err = network.InspectEndpoints(info); err != nil {
+		logrus.Warnf("inspect container %s endpoint error %v", info.Id, err)
+	}
+	return result, nil
+}
+
+// Port 获取容器当前生效的端口映射，容器停止后端口映射随网络端点一起删除
+func (c *Client) Port(containerId string) ([]network.PortBinding, error) {
+	info, err := lookupContainer(containerId)
+	if err != nil {
+		return nil, err
+	}
+	bindings := []network.PortBinding{}
+	for _, ep := range info.Endpoints {
+		for _, pm := range ep.PortMapping {
+			parsed, err := network.ParsePortMapping(pm)
+			if err != nil {
+				logrus.Warnf("parse port mapping %s of container %s error %v", pm, info.Id, err)
+				continue
+			}
+			bindings = append(bindings, parsed...)
+		}
+	}
+	return bindings, nil
+}
+
+// InspectNetwork 获取网络以及连接到这个网络的容器信息
+func (c *Client) InspectNetwork(name string) (*network.NetworkInspect, error) {
+	return network.InspectNetwork(name)
+}
+
+// InspectImage 获取镜像信息
+func (c *Client) InspectImage(name string) (*container.Image, error) {
+	return container.InspectImage(name)
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateNetwork 创建网络
+func (c *Client) CreateNetwork(opts *NetworkCreateOptions) error {
+	if opts.Name == "" {
+		return invalidParameter(fmt.Errorf("missing network name"))
+	}
+	ipv4, ipv6, err := network.ParseSubnets(opts.Subnets, opts.IPv6)
+	if err != nil {
+		return invalidParameter(err)
+	}
+	opts4, opts6, err := network.ParseSubnetOptions(opts.Gateways, opts.IPRanges, ipv4, ipv6)
+	if err != nil {
+		return invalidParameter(err)
+	}
+	config := &network.CreateConfig{
+		Driver:      opts.Driver,
+		Name:        opts.Name,
+		IPv4:        ipv4,
+		IPv6:        ipv6,
+		IPv4Options: opts4,
+		IPv6Options: opts6,
+		Internal:    opts.Internal,
+		Options:     opts.Options,
+	}
+	if err = network.CreateNetwork(config); err != nil {
+		return err
+	}
+	// 容器连接网络时还会再次检查，这里启动失败不影响网络的创建
+	if err = c.ensureDNS(opts.Name); err != nil {
+		logrus.Warnf("start dns server of network %s error %v", opts.Name, err)
+	}
+	return nil
+}
+
+// Firewall 获取宿主机配置网络规则使用的防火墙后端
+func (c *Client) Firewall() (*network.FirewallInfo, error) {
+	return network.GetFirewallInfo()
+}
+
+// SetFirewall 修改宿主机的防火墙后端，并将现有的网络规则迁移到新的后端
+func (c *Client) SetFirewall(backend string) error {
+	switch backend {
+	case network.FirewallAuto, network.FirewallIPTables, network.FirewallNFTables:
+	default:
+		return invalidParameter(fmt.Errorf("unknown firewall backend %s, should be one of auto, iptables, nftables", backend))
+	}
+	return network.SetFirewallBackend(backend)
+}
+
+// ensureDNS 启动网络的 DNS 进程，网络不提供内置 DNS 或者 DNS 进程已经在运行时直接返回
+func (c *Client) ensureDNS(networkName string) error {
+	servers, err := network.DNSServers(networkName)
+	if err != nil || len(servers) == 0 || network.DNSRunning(networkName) {
+		return err
+	}
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "create pipe failed")
+	}
+	defer readPipe.Close()
+
+	cmd := exec.Command(c.binary, network.DNSServerCommand, networkName)
+	cmd.ExtraFiles = []*os.File{writePipe}
+	// 和 supervisor 一样脱离当前终端，启动它的进程退出后继续运行
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	writePipe.Close()
+	if err != nil {
+		return errors.Wrap(err, "start dns server failed")
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	// DNS 进程开始监听后关闭管道，启动失败时写入错误信息
+	content, err := io.ReadAll(readPipe)
+	if err != nil {
+		return errors.Wrap(err, "read dns server start result failed")
+	}
+	// 多个容器同时启动时，其他进程可能已经启动了 DNS 进程
+	if len(content) > 0 && !network.DNSRunning(networkName) {
+		return errors.New(string(content))
+	}
+	return nil
+}
+
+// ServeDNS DNS 进程的入口，只能在 ensureDNS 启动的 dns-server 命令中调用
+func (c *Client) ServeDNS(networkName string) error {
+	ready := openReadyPipe()
+	return network.ServeDNS(networkName, func(err error) {
+		defer ready.Close()
+		if err != nil {
+			_, _ = ready.WriteString(err.Error())
+		}
+	})
+}
+
+// setupDNS 确保网络的 DNS 进程正在运行，并将容器的 resolv.conf 指向它
+func (c *Client) setupDNS(containerId string, networkName string) error {
+	if err := c.ensureDNS(networkName); err != nil {
+		return err
+	}
+	return network.WriteResolvConf(networkName, utils.GetMerged(containerId))
+}
+
+// ListNetworks 列出所有网络
+func (c *Client) ListNetworks() ([]*network.Network, error) {
+	return network.ListNetworks()
+}
+
+// RemoveNetwork 删除网络
+func (c *Client) RemoveNetwork(name string) error {
+	return network.DeleteNetwork(name)
+}
+
+// ConnectNetwork 将运行中的容器连接到网络，在容器中创建一个新的网卡
+// 连接的网络在容器停止时全部断开，下次启动时只会连接创建容器时指定的网络
+func (c *Client) ConnectNetwork(name string, opts *NetworkConnectOptions) error {
+	var ip net.IP
+	if opts.IP != "" {
+		if ip = net.ParseIP(opts.IP); ip == nil {
+			return invalidParameter(fmt.Errorf("invalid ip address %s", opts.IP))
+		}
+	}
+	for _, alias := range opts.Aliases {
+		if err := container.ValidateName(alias); err != nil {
+			return invalidParameter(fmt.Errorf("invalid network alias [%s], only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", alias))
+		}
+	}
+	containerId, err := resolveContainer(opts.Container)
+	if err != nil {
+		return err
+	}
+	// 在容器信息的锁中连接网络，避免同时连接多个网络时分配到相同的网卡名
+	err = container.UpdateInfo(containerId, func(info *container.Info) error {
+		if info.Status != container.RUNNING && info.Status != container.PAUSED {
+			return fmt.Errorf("container %s is not running", containerId)
+		}
+		if info.Namespaces.NetMode != "" {
+			return invalidParameter(fmt.Errorf("container %s uses network mode %s, can not connect to a network", containerId, info.Namespaces.NetMode))
+		}
+		ep, err := network.Connect(name, info, &network.ConnectOptions{IP: ip, Aliases: opts.Aliases})
+		if err != nil {
+			if errors.Is(err, network.ErrIPOutOfRange) || errors.Is(err, network.ErrIPInUse) {
+				return invalidParameter(err)
+			}
+			return err
+		}
+		info.Endpoints = append(info.Endpoints, ep)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = c.ensureDNS(name); err != nil {
+		logrus.Warnf("start dns server of network %s error %v", name, err)
+	}
+	return nil
+}
+
+// DisconnectNetwork 将容器从网络中断开，删除容器中对应的网卡
+func (c *Client) DisconnectNetwork(name string, containerId string) error {
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return err
+	}
+	return container.UpdateInfo(containerId, func(info *container.Info) error {
+		ep := info.Endpoint(name)
+		if ep == nil {
+			return invalidParameter(fmt.Errorf("container %s is not connected to network %s", containerId, name))
+		}
+		if err := network.Disconnect(info, ep); err != nil {
+			return err
+		}
+		info.RemoveEndpoint(name)
+		return nil
+	})
+}
+
+// ListImages 列出所有镜像
+func (c *Client) ListImages() ([]*container.Image, error) {
+	return container.ListImages()
+}
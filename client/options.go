@@ -0,0 +1,231 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+)
+
+// DefaultStopTimeout stop 默认等待容器退出的秒数
+const DefaultStopTimeout = 10
+
+// CreateOptions 创建容器的参数，create 时会保存到容器目录中，start 时读取
+type CreateOptions struct {
+	Tty         bool                       `json:"tty"` // 只有通过 Run 前台运行时可以使用
+	Cmd         []string                   `json:"cmd"`
+	Resources   *subsystem.ResourceConfig  `json:"resources"`
+	Volume      string                     `json:"volume"`
+	Name        string                     `json:"name"`
+	Image       string                     `json:"image"`
+	Env         []string                   `json:"env"`
+	Network     string                     `json:"network"` // 网络名，namespace 模式通过 Namespaces.NetMode 指定
+	PortMapping []string                   `json:"portMapping"`
+	PublishAll  bool                       `json:"publishAll"` // 将暴露的端口全部发布到宿主机的随机端口
+	Expose      []string                   `json:"expose"`     // 容器暴露的端口，Validate 后包含镜像中配置的端口
+	Aliases     []string                   `json:"aliases"`    // 容器在网络中的别名，同一网络中的容器可以通过别名解析到这个容器
+	Namespaces  *container.NamespaceConfig `json:"namespaces"`
+	Init        bool                       `json:"init"`
+	Ulimits     []string                   `json:"ulimits"`
+	Sysctls     []string                   `json:"sysctls"`
+	StopSignal  string                     `json:"stopSignal"` // 为空时使用镜像中配置的 StopSignal
+	OomScoreAdj int                        `json:"oomScoreAdj"`
+}
+
+// StopOptions 停止容器的参数
+type StopOptions struct {
+	// Timeout 等待容器退出的秒数，超时后发送 SIGKILL
+	Timeout int `json:"timeout"`
+}
+
+// RemoveOptions 删除容器的参数
+type RemoveOptions struct {
+	// Force 强制删除运行中的容器
+	Force bool `json:"force"`
+}
+
+// LogsOptions 获取容器日志的参数
+type LogsOptions struct {
+	// Tail 只返回最后的行数，0 表示返回全部日志
+	Tail int `json:"tail"`
+}
+
+// ExecOptions 在容器中执行命令的参数
+type ExecOptions struct {
+	Cmd []string
+	// 命令的输入输出，为空时不绑定
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// EventsOptions 获取事件的参数
+type EventsOptions struct {
+	// Since 只返回该时间之后的事件，零值表示从第一条事件开始
+	Since time.Time
+	// Until 只返回该时间之前的事件，零值表示持续等待新的事件
+	Until  time.Time
+	Filter events.Filter
+}
+
+// NetworkCreateOptions 创建网络的参数
+type NetworkCreateOptions struct {
+	Name    string   `json:"name"`
+	Driver  string   `json:"driver"`
+	Subnets []string `json:"subnets"` // 每种地址族最多一个网段
+	IPv6    bool     `json:"ipv6"`    // 是否开启 IPv6，开启时需要指定 IPv6 网段
+	// Gateways 网段的网关地址，每个网段最多一个，没有指定时使用网段中第一个可用地址
+	Gateways []string `json:"gateways"`
+	// IPRanges 容器地址的分配范围，每个网段最多一个，没有指定时从整个网段中分配
+	IPRanges []string `json:"ipRanges"`
+	// Internal 内部网络，容器不能访问外部网络
+	Internal bool `json:"internal"`
+	// Options 驱动参数，例如 bridge 驱动的 icc=false，macvlan 驱动的 parent=eth1
+	Options map[string]string `json:"options"`
+}
+
+// NetworkConnectOptions 将容器连接到网络的参数
+type NetworkConnectOptions struct {
+	Container string   `json:"container"` // 容器id或容器名
+	IP        string   `json:"ip"`        // 指定容器的 IPv4 或 IPv6 地址，为空时自动分配
+	Aliases   []string `json:"aliases"`   // 容器在网络中的别名
+}
+
+// Validate 检查创建参数，Create 和 Run 会自动调用
+// 未指定停止信号时使用镜像中配置的 StopSignal，并合并镜像中配置的暴露端口，PublishAll 时将它们加入端口映射
+func (opts *CreateOptions) Validate() error {
+	if len(opts.Cmd) == 0 || opts.Image == "" {
+		return fmt.Errorf("missing imageName or container command")
+	}
+	if opts.Resources == nil {
+		opts.Resources = &subsystem.ResourceConfig{}
+	}
+	if opts.Namespaces == nil {
+		opts.Namespaces = &container.NamespaceConfig{}
+	}
+	if opts.Resources.CpuCfsQuota != 0 && opts.Resources.Cpus != 0 {
+		return fmt.Errorf("cpu and cpus paramter can not both provided")
+	}
+	if err := opts.Resources.Validate(); err != nil {
+		return err
+	}
+	if err := opts.Namespaces.Validate(); err != nil {
+		return err
+	}
+	if err := opts.Namespaces.Resolve(); err != nil {
+		return err
+	}
+	if opts.Name != "" {
+		if err := container.ValidateName(opts.Name); err != nil {
+			return err
+		}
+	}
+	for _, alias := range opts.Aliases {
+		if opts.Network == "" {
+			return fmt.Errorf("network alias can only be used with a user defined network")
+		}
+		if err := container.ValidateName(alias); err != nil {
+			return fmt.Errorf("invalid network alias [%s], only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", alias)
+		}
+	}
+	// 没有独立的网络时无法配置端口映射
+	if opts.Namespaces.NetMode != "" && (len(opts.PortMapping) > 0 || opts.PublishAll) {
+		return fmt.Errorf("port mapping can not be used with net mode %s", opts.Namespaces.NetMode)
+	}
+	for _, pm := range opts.PortMapping {
+		if _, err := network.ParsePortMapping(pm); err != nil {
+			return err
+		}
+	}
+	for _, ulimit := range opts.Ulimits {
+		if _, err := container.ParseUlimit(ulimit); err != nil {
+			return err
+		}
+	}
+	for _, sysctl := range opts.Sysctls {
+		if err := container.ValidateSysctl(sysctl, opts.Namespaces); err != nil {
+			return err
+		}
+	}
+	imageConfig, err := container.LoadImageConfig(opts.Image)
+	if err != nil {
+		return err
+	}
+	if opts.StopSignal == "" {
+		opts.StopSignal = imageConfig.StopSignal
+	}
+	if err = opts.mergeExposedPorts(imageConfig.ExposedPorts); err != nil {
+		return err
+	}
+	if opts.StopSignal != "" {
+		if _, err := utils.ParseSignal(opts.StopSignal); err != nil {
+			return err
+		}
+	}
+	return container.ValidateOomScoreAdj(opts.OomScoreAdj)
+}
+
+// mergeExposedPorts 合并镜像中配置的暴露端口，PublishAll 时将还没有发布的端口加入端口映射，宿主机端口随机分配
+// 重复调用时不会重复添加
+func (opts *CreateOptions) mergeExposedPorts(imagePorts []string) error {
+	exposed := make([]string, 0, len(imagePorts)+len(opts.Expose))
+	seen := map[string]bool{}
+	for _, port := range append(append([]string{}, imagePorts...), opts.Expose...) {
+		if strings.Contains(port, ":") {
+			return fmt.Errorf("invalid exposed port %s, host port can not be specified", port)
+		}
+		bindings, err := network.ParsePortMapping(port)
+		if err != nil {
+			return err
+		}
+		for _, binding := range bindings {
+			key := fmt.Sprintf("%d/%s", binding.ContainerPort, binding.Proto)
+			if !seen[key] {
+				seen[key] = true
+				exposed = append(exposed, key)
+			}
+		}
+	}
+	opts.Expose = exposed
+	if !opts.PublishAll {
+		return nil
+	}
+	published := map[string]bool{}
+	for _, pm := range opts.PortMapping {
+		bindings, _ := network.ParsePortMapping(pm)
+		for _, binding := range bindings {
+			published[fmt.Sprintf("%d/%s", binding.ContainerPort, binding.Proto)] = true
+		}
+	}
+	for _, port := range exposed {
+		if !published[port] {
+			opts.PortMapping = append(opts.PortMapping, port)
+		}
+	}
+	return nil
+}
+
+// containerInfo 根据创建参数构建容器信息
+func (opts *CreateOptions) containerInfo(containerId string) *container.Info {
+	return &container.Info{
+		Id:             containerId,
+		Name:           opts.Name,
+		Volume:         opts.Volume,
+		NetworkName:    opts.Network,
+		PortMapping:    opts.PortMapping,
+		ExposedPorts:   opts.Expose,
+		Namespaces:     *opts.Namespaces,
+		Image:          opts.Image,
+		StopSignal:     opts.StopSignal,
+		ResourceConfig: opts.Resources,
+		OomScoreAdj:    opts.OomScoreAdj,
+		Ulimits:        opts.Ulimits,
+		Sysctls:        opts.Sysctls,
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeExposedPorts(t *testing.T) {
+	opts := &CreateOptions{
+		PortMapping: []string{"8080:80"},
+		PublishAll:  true,
+		Expose:      []string{"53/udp", "8000-8001"},
+	}
+	for i := 0; i < 2; i++ {
+		// 重复调用结果不变
+		if err := opts.mergeExposedPorts([]string{"80", "53/udp"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"80/tcp", "53/udp", "8000/tcp", "8001/tcp"}; !reflect.DeepEqual(opts.Expose, want) {
+		t.Fatalf("exposed ports got %v, want %v", opts.Expose, want)
+	}
+	if want := []string{"8080:80", "53/udp", "8000/tcp", "8001/tcp"}; !reflect.DeepEqual(opts.PortMapping, want) {
+		t.Fatalf("port mapping got %v, want %v", opts.PortMapping, want)
+	}
+	if err := (&CreateOptions{Expose: []string{"8080:80"}}).mergeExposedPorts(nil); err == nil {
+		t.Fatalf("exposed port with host port should fail")
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Run 在前台运行容器，绑定当前进程的标准输入输出，容器退出后删除容器
+func (c *Client) Run(opts *CreateOptions) error {
+	if !opts.Tty {
+		return invalidParameter(fmt.Errorf("run in foreground requires tty, use Create and Start instead"))
+	}
+	if err := opts.Validate(); err != nil {
+		return invalidParameter(err)
+	}
+	containerId := container.GenerateContainerID()
+	name := opts.Name
+	if name == "" {
+		name = container.ShortID(containerId)
+	}
+	if err := container.ReserveName(name, containerId); err != nil {
+		return invalidParameter(err)
+	}
+	// 前台运行的容器在 run 返回时已经被删除
+	defer container.ReleaseName(name, containerId)
+	return c.run(containerId, opts, nil)
+}
+
+// run 启动容器进程，ready 不为空时表示由 supervisor 启动，启动后通知启动结果并等待容器退出
+func (c *Client) run(containerId string, opts *CreateOptions, ready *os.File) error {
+	// 通过 create 创建的容器保留创建时间，以及 create 之后通过 rename 修改的容器名
+	created, _ := container.GetInfo(containerId)
+	containerInfo := opts.containerInfo(containerId)
+	if created != nil {
+		containerInfo.Name = created.Name
+		containerInfo.CreatedTime = created.CreatedTime
+	}
+	if containerInfo.Name == "" {
+		containerInfo.Name = container.ShortID(containerId)
+	}
+
+	initOpts := &container.InitOptions{Binary: c.binary, Reap: opts.Init, Ulimits: opts.Ulimits, Sysctls: opts.Sysctls}
+	parent, writePipe := container.NewParentProcess(opts.Tty, opts.Volume, containerId, opts.Image, opts.Env, opts.Namespaces, initOpts)
+	if parent == nil {
+		return errors.New("new parent process error")
+	}
+	// 需要共享其他容器 namespace 时，会先加入对应 namespace 再启动进程
+	err := container.StartProcess(parent, opts.Namespaces)
+	if err != nil {
+		_ = writePipe.Close()
+		container.DeleteWorkSpace(containerId, opts.Volume)
+		// 通过 create 创建的容器保留容器信息，例如共享 namespace 的容器没有运行时，之后还可以再次启动
+		if created == nil {
+			_ = container.DeleteContainerInfo(containerId)
+		}
+		return err
+	}
+
+	// 每个容器使用单独的cgroup，后台运行的容器在退出或 stop 时释放
+	cgroupManager := cgroups.NewContainerCgroupManager(containerId)
+	// 配置cgroup资源限制，失败时容器进程还没有执行用户命令，直接结束并清理
+	if err = cgroupManager.Set(opts.Resources); err != nil {
+		abortContainer(parent, containerId, opts.Volume, cgroupManager, created != nil)
+		return err
+	}
+	if err = cgroupManager.Apply(parent.Process.Pid, opts.Resources); err != nil {
+		abortContainer(parent, containerId, opts.Volume, cgroupManager, created != nil)
+		return err
+	}
+	if opts.OomScoreAdj != 0 {
+		if err = container.SetOomScoreAdj(parent.Process.Pid, opts.OomScoreAdj); err != nil {
+			logrus.Errorf("Set oom score adj error %v", err)
+		}
+	}
+
+	// 如果指定了网络信息则进行配置，host、none 以及共享其他容器网络时 net 为空
+	if opts.Network != "" {
+		// config container network
+		containerInfo.Pid = strconv.Itoa(parent.Process.Pid)
+		connectOpts := &network.ConnectOptions{Aliases: opts.Aliases, PortMapping: opts.PortMapping}
+		ep, err := network.Connect(opts.Network, containerInfo, connectOpts)
+		if err != nil {
+			// 例如宿主机端口已经被其他容器映射，容器进程还没有执行用户命令，直接结束
+			abortContainer(parent, containerId, opts.Volume, cgroupManager, created != nil)
+			return errors.WithMessage(err, "connect network failed")
+		}
+		containerInfo.Endpoints = append(containerInfo.Endpoints, ep)
+		// DNS 不可用时保留镜像中的 resolv.conf，容器仍然可以通过 IP 访问其他容器
+		if err = c.setupDNS(containerId, opts.Network); err != nil {
+			logrus.Warnf("setup dns of container %s error %v", containerId, err)
+		}
+	}
+
+	// 记录容器信息
+	if err = container.RecordContainerInfo(containerInfo, parent.Process.Pid, opts.Cmd); err != nil {
+		// 断开已经连接的网络，释放地址、端口映射规则以及登记的宿主机端口
+		for _, ep := range containerInfo.Endpoints {
+			if errIn := network.Disconnect(containerInfo, ep); errIn != nil {
+				logrus.Errorf("Disconnect container [%s] from network %s failed, detail: %v", containerId, ep.Network, errIn)
+			}
+		}
+		abortContainer(parent, containerId, opts.Volume, cgroupManager, created != nil)
+		return errors.WithMessage(err, "record container info error")
+	}
+	// 前台运行的容器没有经过 Create，在这里记录创建事件
+	if created == nil {
+		containerEvent(events.ActionCreate, containerInfo, nil)
+	}
+	containerEvent(events.ActionStart, containerInfo, nil)
+
+	// 创建完子进程后发送参数
+	sendInitCommand(opts.Cmd, writePipe)
+	// 如果是tty，那么父进程等待，就是前台运行
+	if opts.Tty {
+		_ = parent.Wait()
+		exitCode := container.ExitCode(parent.ProcessState)
+		containerEvent(events.ActionDie, containerInfo, map[string]string{"exitCode": strconv.Itoa(exitCode)})
+		// 运行期间可能通过 network connect 连接了其他网络，使用最新的容器信息释放资源
+		if latest, err := container.GetInfo(containerId); err == nil {
+			containerInfo = latest
+		}
+		// 进程结束时自动删除对应cgroup资源限制，并断开容器连接的所有网络
+		releaseContainerResources(containerInfo)
+		// 解绑并删除overlayFS 使用的upper work mount 文件夹
+		container.DeleteWorkSpace(containerId, opts.Volume)
+		container.DeleteContainerInfo(containerId)
+		containerEvent(events.ActionDestroy, containerInfo, nil)
+		return nil
+	}
+	// 后台运行时由 supervisor 等待容器退出并记录退出原因
+	if ready != nil {
+		notifyStartResult(ready, containerId, nil)
+		superviseContainer(parent, containerInfo, cgroupManager)
+	}
+	return nil
+}
+
+// abortContainer 结束还未运行用户命令的容器进程，并释放已经创建的资源
+// keepInfo 为 true 时保留通过 create 创建的容器信息，容器仍然是 created 状态，可以再次启动
+func abortContainer(parent *exec.Cmd, containerId, volume string, cgroupManager *cgroups.CgroupManager, keepInfo bool) {
+	_ = parent.Process.Kill()
+	_ = parent.Wait()
+	_ = cgroupManager.Destroy()
+	container.DeleteWorkSpace(containerId, volume)
+	if !keepInfo {
+		_ = container.DeleteContainerInfo(containerId)
+	}
+}
+
+func sendInitCommand(comArr []string, writePipe *os.File) {
+	command := strings.Join(comArr, " ")
+	logrus.Info("command is: ", command)
+	writePipe.WriteString(command)
+	writePipe.Close()
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Stats 容器一次采样的资源使用计数，cpu 使用率需要根据两次采样的 CpuUsage 和 Read 计算
+type Stats struct {
+	Id   string    `json:"id"`
+	Name string    `json:"name"`
+	Read time.Time `json:"read"` // 采样时间
+	subsystem.Stats
+	NetRx uint64 `json:"netRx"`
+	NetTx uint64 `json:"netTx"`
+}
+
+// Stats 采样容器当前的资源使用情况
+func (c *Client) Stats(containerId string) (*Stats, error) {
+	info, err := lookupContainer(containerId)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	return collectStats(info), nil
+}
+
+// collectStats 读取容器 cgroup 和网络设备的统计信息，读取失败的项保持为 0 并打印警告
+func collectStats(info *container.Info) *Stats {
+	stats, err := cgroups.NewContainerCgroupManager(info.Id).GetStats()
+	if err != nil {
+		logrus.Warnf("get container %s cgroup stats error %v", info.Id, err)
+	}
+	result := &Stats{Id: info.Id, Name: info.Name, Read: time.Now()}
+	if stats != nil {
+		result.Stats = *stats
+	}
+	netStats, err := network.GetEndpointStats(info)
+	if err != nil {
+		logrus.Debugf("get container %s network stats error %v", info.Id, err)
+	} else {
+		result.NetRx, result.NetTx = netStats.RxBytes, netStats.TxBytes
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	killTimeout       = 5 * time.Second // 发送 SIGKILL 后等待进程退出的时间
+	exitCheckInterval = 100 * time.Millisecond
+)
+
+// Stop 停止容器
+// 先发送容器的停止信号，等待 timeout 秒后进程仍未退出则发送 SIGKILL，opts 为空时使用默认超时时间
+// 只有确认进程已经退出后才会释放资源并修改容器状态
+func (c *Client) Stop(containerId string, opts *StopOptions) error {
+	timeout := DefaultStopTimeout
+	if opts != nil {
+		if opts.Timeout < 0 {
+			return invalidParameter(fmt.Errorf("invalid stop timeout %d", opts.Timeout))
+		}
+		timeout = opts.Timeout
+	}
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return err
+	}
+	return stopContainer(containerId, timeout)
+}
+
+func stopContainer(containerId string, timeout int) error {
+	// 1. 根据容器Id查询容器信息
+	containerInfo, err := container.GetInfo(containerId)
+	if err != nil {
+		logrus.Errorf("Get container %s info error %v", containerId, err)
+		return err
+	}
+	if containerInfo.Pid == "" {
+		return fmt.Errorf("container %s is not running", containerId)
+	}
+	pidInt, err := strconv.Atoi(containerInfo.Pid)
+	if err != nil {
+		logrus.Error("Conver pid form string to int error ", err)
+		return err
+	}
+	// 2. 发送停止信号，默认为 SIGTERM
+	stopSignal := syscall.SIGTERM
+	if containerInfo.StopSignal != "" {
+		if stopSignal, err = utils.ParseSignal(containerInfo.StopSignal); err != nil {
+			return err
+		}
+	}
+	if err = syscall.Kill(pidInt, stopSignal); err != nil && err != syscall.ESRCH {
+		return errors.Wrapf(err, "send signal %v to container %s failed", stopSignal, containerId)
+	}
+	// 暂停中的容器无法处理信号，发送信号后恢复容器，使其能够退出
+	if containerInfo.Status == container.PAUSED {
+		if err = cgroups.NewContainerCgroupManager(containerId).Thaw(); err != nil {
+			return errors.WithMessagef(err, "thaw container %s failed", containerId)
+		}
+	}
+	// 3. 等待进程退出，超时后发送 SIGKILL
+	if !waitForExit(pidInt, time.Duration(timeout)*time.Second) {
+		logrus.Warnf("container %s did not exit within %d seconds, sending SIGKILL", containerId, timeout)
+		if err = syscall.Kill(pidInt, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return errors.Wrapf(err, "kill container %s failed", containerId)
+		}
+		if !waitForExit(pidInt, killTimeout) {
+			return fmt.Errorf("container %s is still alive after SIGKILL", containerId)
+		}
+	}
+	// 4. 进程退出后释放网络和cgroup资源，设置容器状态为stop并清空pid
+	// 后台容器的 supervisor 也会在进程退出时修改容器信息，这里需要加锁更新
+	err = container.UpdateInfo(containerId, func(info *container.Info) error {
+		releaseContainerResources(info)
+		info.Status = container.STOP
+		info.Pid = ""
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Save container %s info error:%v", containerId, err)
+		return err
+	}
+	containerEvent(events.ActionStop, containerInfo, nil)
+	return nil
+}
+
+// Kill 向容器的init进程发送指定信号，signal 可以是信号名或信号值，为空时发送 SIGKILL
+func (c *Client) Kill(containerId string, signal string) error {
+	sig := syscall.SIGKILL
+	if signal != "" {
+		var err error
+		if sig, err = utils.ParseSignal(signal); err != nil {
+			return invalidParameter(err)
+		}
+	}
+	containerId, err := resolveContainer(containerId)
+	if err != nil {
+		return err
+	}
+	containerInfo, err := container.GetInfo(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	if containerInfo.Pid == "" {
+		return fmt.Errorf("container %s is not running", containerId)
+	}
+	pidInt, err := strconv.Atoi(containerInfo.Pid)
+	if err != nil {
+		return errors.Wrap(err, "convert pid from string to int failed")
+	}
+	if err = syscall.Kill(pidInt, sig); err != nil {
+		return errors.Wrapf(err, "send signal %v to container %s failed", sig, containerId)
+	}
+	return nil
+}
+
+// releaseContainerResources 释放容器占用的网络和cgroup资源
+// 断开所有网络后清空网络端点，stop 和 supervisor 都会调用，重复调用时不会再次释放IP
+func releaseContainerResources(containerInfo *container.Info) {
+	for _, ep := range containerInfo.Endpoints {
+		if err := network.Disconnect(containerInfo, ep); err != nil {
+			logrus.Errorf("Disconnect container [%s] from network %s failed, detail: %v", containerInfo.Id, ep.Network, err)
+		}
+	}
+	containerInfo.Endpoints = nil
+	if err := cgroups.NewContainerCgroupManager(containerInfo.Id).Destroy(); err != nil {
+		logrus.Errorf("Destroy container [%s] cgroup failed, detail: %v", containerInfo.Id, err)
+	}
+}
+
+// waitForExit 等待进程退出，超时返回false
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !processAlive(pid) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(exitCheckInterval)
+	}
+}
+
+// processAlive 判断进程是否存活，僵尸进程视为已经退出
+func processAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// /proc/[pid]/stat 格式为 pid (comm) state ...，comm 中可能包含空格，从最后一个 ) 之后解析
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
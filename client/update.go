@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups"
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Update 更新运行中容器的资源限制，并将新的限制写回 config.json 和 create 保存的 run.json
+// update 中为空或为0的限制保持不变，因此已有的内存、cpu和cpuset限制只能修改不能移除，
+// pids-limit 和 memory-swap 可以设置为 -1 取消限制。
+// 资源限制在容器信息的锁内读取和保存，避免覆盖 supervisor 记录的退出信息或者 network connect 修改的网络端点
+func (c *Client) Update(containerId string, update *subsystem.ResourceConfig) error {
+	id, err := resolveContainer(containerId)
+	if err != nil {
+		return errors.WithMessagef(err, "get container %s info failed", containerId)
+	}
+	containerId = id
+	return container.UpdateInfo(containerId, func(containerInfo *container.Info) error {
+		if containerInfo.Status != container.RUNNING && containerInfo.Status != container.PAUSED {
+			return fmt.Errorf("container %s is not running, status %s", containerId, containerInfo.Status)
+		}
+		pid, err := strconv.Atoi(containerInfo.Pid)
+		if err != nil {
+			return errors.Wrap(err, "convert pid from string to int failed")
+		}
+
+		res := containerInfo.ResourceConfig
+		if res == nil {
+			res = &subsystem.ResourceConfig{}
+		}
+		if update.MemoryLimit != "" {
+			res.MemoryLimit = update.MemoryLimit
+		}
+		if update.MemorySwap != "" {
+			res.MemorySwap = update.MemorySwap
+		}
+		if update.CpuCfsQuota != 0 {
+			res.CpuCfsQuota = update.CpuCfsQuota
+			res.Cpus = 0
+		}
+		if update.CpuSet != "" {
+			res.CpuSet = update.CpuSet
+		}
+		if update.PidsLimit != 0 {
+			res.PidsLimit = update.PidsLimit
+		}
+
+		if err = res.Validate(); err != nil {
+			return invalidParameter(err)
+		}
+		cgroupManager := cgroups.NewContainerCgroupManager(containerId)
+		if update.MemoryLimit != "" {
+			if err = validateMemoryUpdate(cgroupManager, res); err != nil {
+				return invalidParameter(err)
+			}
+		}
+		// 在已有的cgroup上重新设置限制，之前没有限制的Subsystem需要再将进程加入到cgroup中
+		if err = cgroupManager.Set(res); err != nil {
+			return errors.WithMessagef(err, "set container %s resource failed", containerId)
+		}
+		if err = cgroupManager.Apply(pid, res); err != nil {
+			return errors.WithMessagef(err, "apply container %s resource failed", containerId)
+		}
+
+		if err = updateCreateOptions(containerId, res); err != nil {
+			return err
+		}
+		containerInfo.ResourceConfig = res
+		logrus.Infof("update container %s resource config %+v", containerId, *res)
+		return nil
+	})
+}
+
+// validateMemoryUpdate 没有可用swap时，新的内存限制不能低于当前的内存使用量，否则内核无法回收内存会导致设置失败
+func validateMemoryUpdate(cgroupManager *cgroups.CgroupManager, res *subsystem.ResourceConfig) error {
+	limit, err := utils.RAMInBytes(res.MemoryLimit)
+	if err != nil {
+		return err
+	}
+	swapTotal, err := utils.GetSwapTotal()
+	if err != nil {
+		return err
+	}
+	// 容器的 memory-swap 与内存限制相同时，同样无法使用swap
+	swapOff := swapTotal == 0 || res.MemorySwap == res.MemoryLimit
+	if !swapOff {
+		return nil
+	}
+	stats, err := cgroupManager.GetStats()
+	if err != nil {
+		return err
+	}
+	if uint64(limit) < stats.MemoryUsage {
+		return fmt.Errorf("memory limit %s is below current usage %s and swap is off",
+			res.MemoryLimit, utils.HumanSize(stats.MemoryUsage))
+	}
+	return nil
+}
+
+// updateCreateOptions 将新的资源限制同步到 create 保存的创建参数中，run 启动的容器没有创建参数文件
+func updateCreateOptions(containerId string, res *subsystem.ResourceConfig) error {
+	opts, err := loadCreateOptions(containerId)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return err
+	}
+	opts.Resources = res
+	return saveCreateOptions(containerId, opts)
+}
@@ -5,4 +5,5 @@ const (
 	Perm0644 = 0644 // 用户具有读写权限，组用户和其它用户具有只读权限；
 	Perm0777 = 0777 // 用户、组用户和其它用户都有读/写/执行权限
 	Perm0622 = 0622 // 用户具有读/写权限，组用户和其它用户具只写权限；
+	Perm0660 = 0660 // 用户和组用户具有读写权限，其它用户没有权限
 )
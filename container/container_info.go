@@ -1,72 +1,93 @@
 package container
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
 	"github.com/ChenMiaoQiu/tiny-docker/constant"
-	"github.com/ChenMiaoQiu/tiny-docker/utils"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 const (
+	CREATED       = "created"
 	RUNNING       = "running"
+	PAUSED        = "paused"
 	STOP          = "stopped"
 	Exit          = "exited"
 	InfoLoc       = "/var/lib/tiny-docker/containers/"
 	InfoLocFormat = InfoLoc + "%s/"
 	ConfigName    = "config.json"
-	IDLength      = 10
+	IDLength      = 64
+	lockName      = "config.lock"
+	TimeFormat    = "2006-01-02 15:04:05"
 	LogFile       = "%s-json.log"
 )
 
 type Info struct {
-	Pid         string   `json:"pid"`         // 容器的init进程在宿主机上的 PID
-	Id          string   `json:"id"`          // 容器Id
-	Name        string   `json:"name"`        // 容器名
-	Command     string   `json:"command"`     // 容器内init运行命令
-	CreatedTime string   `json:"createTime"`  // 创建时间
-	Status      string   `json:"status"`      // 容器的状态
-	Volume      string   `json:"volume"`      // 容器数据卷
-	NetworkName string   `json:"networkName"` // 容器所在的网络
-	PortMapping []string `json:"portMapping"` // 端口映射
-	IP          string   `json:"ip"`          // 容器IP
+	Pid          string   `json:"pid"`                    // 容器的init进程在宿主机上的 PID
+	Id           string   `json:"id"`                     // 容器Id
+	Name         string   `json:"name"`                   // 容器名
+	Command      string   `json:"command"`                // 容器内init运行命令
+	CreatedTime  string   `json:"createTime"`             // 创建时间
+	Status       string   `json:"status"`                 // 容器的状态
+	Volume       string   `json:"volume"`                 // 容器数据卷
+	NetworkName  string   `json:"networkName"`            // 创建容器时指定的网络，启动时连接
+	PortMapping  []string `json:"portMapping"`            // 端口映射
+	ExposedPorts []string `json:"exposedPorts,omitempty"` // 容器暴露的端口，包括镜像中配置的端口
+	Image        string   `json:"image"`                  // 容器使用的镜像
+	StopSignal   string   `json:"stopSignal"`             // 停止容器时发送的信号
+
+	Endpoints []*Endpoint `json:"endpoints,omitempty"` // 运行中的容器连接的网络，停止时全部断开
+
+	ResourceConfig *subsystem.ResourceConfig `json:"resourceConfig"` // 容器的资源限制
+	OomScoreAdj    int                       `json:"oomScoreAdj"`    // 容器init进程的 oom_score_adj
+	Ulimits        []string                  `json:"ulimits"`        // 容器进程的 rlimit，格式为 name=soft:hard
+	Sysctls        []string                  `json:"sysctls"`        // 容器内设置的 sysctl，格式为 key=value
+
+	ExitCode     int    `json:"exitCode"`     // 容器退出码
+	OOMKilled    bool   `json:"oomKilled"`    // 容器是否因为超过内存限制被 OOM killer 杀死
+	FinishedTime string `json:"finishedTime"` // 容器退出时间
+
+	Namespaces NamespaceConfig `json:"namespaces"` // 容器各 namespace 的共享模式
 }
 
-// RecordContainerInfo 记录容器信息
-func RecordContainerInfo(containerPID int, commandArray []string, containerName string, containerId string, volume string, network string, portMapping []string, ip string) (*Info, error) {
-	// 如果未指定容器名，则使用随机生成的containerID
-	if containerName == "" {
-		containerName = containerId
-	}
-	command := strings.Join(commandArray, "")
-	containerInfo := &Info{
-		Pid:         strconv.Itoa(containerPID),
-		Id:          containerId,
-		Name:        containerName,
-		Command:     command,
-		CreatedTime: time.Now().Format("2006-01-02 15:04:05"),
-		Status:      RUNNING,
-		Volume:      volume,
-		NetworkName: network,
-		PortMapping: portMapping,
-		IP:          ip,
+// RecordContainerInfo 补充容器的 pid、命令、创建时间和状态，并将容器信息记录到文件中
+func RecordContainerInfo(containerInfo *Info, containerPID int, commandArray []string) error {
+	// 如果未指定容器名，则使用短容器id
+	if containerInfo.Name == "" {
+		containerInfo.Name = ShortID(containerInfo.Id)
 	}
+	containerInfo.Pid = strconv.Itoa(containerPID)
+	containerInfo.Command = strings.Join(commandArray, "")
+	// 通过 create 创建的容器保留创建时间
+	if containerInfo.CreatedTime == "" {
+		containerInfo.CreatedTime = time.Now().Format(TimeFormat)
+	}
+	containerInfo.Status = RUNNING
+	return SaveInfo(containerInfo)
+}
 
+// SaveInfo 将容器信息写入容器目录下的 config.json
+func SaveInfo(containerInfo *Info) error {
 	jsonByte, err := json.Marshal(containerInfo)
 	if err != nil {
-		return nil, errors.WithMessage(err, "container info marshal failed")
+		return errors.WithMessage(err, "container info marshal failed")
 	}
 	jsonStr := string(jsonByte)
 	// 拼接出存储容器信息文件的路径，如果目录不存在则级联创建
-	dirPath := fmt.Sprintf(InfoLocFormat, containerId)
+	dirPath := fmt.Sprintf(InfoLocFormat, containerInfo.Id)
 	if err := os.MkdirAll(dirPath, constant.Perm0622); err != nil {
-		return nil, errors.WithMessagef(err, "mkdir %s failed", dirPath)
+		return errors.WithMessagef(err, "mkdir %s failed", dirPath)
 	}
 
 	// 写入文件信息
@@ -76,18 +97,82 @@ func RecordContainerInfo(containerPID int, commandArray []string, containerName
 		_ = file.Close()
 	}()
 	if err != nil {
-		return nil, errors.WithMessagef(err, "create file %s failed", fileName)
+		return errors.WithMessagef(err, "create file %s failed", fileName)
 	}
 	_, err = file.WriteString(jsonStr)
 	if err != nil {
-		return nil, errors.WithMessagef(err, "write container info to config file %s failed", fileName)
+		return errors.WithMessagef(err, "write container info to config file %s failed", fileName)
+	}
+	return nil
+}
+
+// UpdateInfo 在文件锁的保护下读取、修改并写回容器信息，避免 stop 与 supervisor 等多个进程同时修改时互相覆盖
+func UpdateInfo(containerId string, update func(info *Info) error) error {
+	lockPath := path.Join(fmt.Sprintf(InfoLocFormat, containerId), lockName)
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, constant.Perm0644)
+	if err != nil {
+		return errors.WithMessagef(err, "open lock file %s failed", lockPath)
 	}
+	defer lockFile.Close()
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.WithMessagef(err, "lock %s failed", lockPath)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
 
-	return containerInfo, nil
+	info, err := GetInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if err = update(info); err != nil {
+		return err
+	}
+	return SaveInfo(info)
 }
 
-// DeleteContainerInfo 删除容器日志
+// GetInfo 根据容器id读取容器信息
+func GetInfo(containerId string) (*Info, error) {
+	configFilePath := path.Join(fmt.Sprintf(InfoLocFormat, containerId), ConfigName)
+	content, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read file %s failed", configFilePath)
+	}
+	info := new(Info)
+	if err = json.Unmarshal(content, info); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal %s failed", configFilePath)
+	}
+	loadLegacyEndpoint(info, content)
+	return info, nil
+}
+
+// ListInfos 读取所有容器的信息，读取失败的容器会被跳过
+func ListInfos() ([]*Info, error) {
+	files, err := os.ReadDir(InfoLoc)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithMessagef(err, "read dir %s failed", InfoLoc)
+	}
+	infos := make([]*Info, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		info, err := GetInfo(file.Name())
+		if err != nil {
+			logrus.Errorf("get container info error %v", err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// DeleteContainerInfo 删除容器信息目录，并释放容器名
 func DeleteContainerInfo(containerID string) error {
+	if info, err := GetInfo(containerID); err == nil {
+		ReleaseName(info.Name, containerID)
+	}
 	dirPath := fmt.Sprintf(InfoLocFormat, containerID)
 	if err := os.RemoveAll(dirPath); err != nil {
 		return errors.WithMessagef(err, "remove dir %s failed", dirPath)
@@ -95,9 +180,14 @@ func DeleteContainerInfo(containerID string) error {
 	return nil
 }
 
-// GenerateContainerID 生成容器id
+// GenerateContainerID 生成 64 位十六进制的随机容器id
 func GenerateContainerID() string {
-	return utils.RandStringBytes(IDLength)
+	id := make([]byte, IDLength/2)
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand 在 Linux 上读取失败说明系统熵源不可用，无法生成可靠的id
+		panic(errors.Wrap(err, "generate container id failed"))
+	}
+	return hex.EncodeToString(id)
 }
 
 // GetLogFile 获取日志文件名称
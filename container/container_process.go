@@ -15,12 +15,13 @@ import (
 // NewParentProcess 构建 command 用于启动一个新进程
 /*
 这里是父进程，也就是当前进程执行的内容。
-1.这里的/proc/se1f/exe调用中，/proc/self/ 指的是当前运行进程自己的环境，exec 其实就是自己调用了自己，使用这种方式对创建出来的进程进行初始化
+1.这里的/proc/se1f/exe调用中，/proc/self/ 指的是当前运行进程自己的环境，exec 其实就是自己调用了自己，使用这种方式对创建出来的进程进行初始化，
+在其他程序中通过 SDK 创建容器时 initOpts.Binary 为 tiny-docker 可执行文件的路径
 2.后面的args是参数，其中init是传递给本进程的第一个参数，在本例中，其实就是会去调用initCommand去初始化进程的一些环境和资源
 3.下面的clone参数就是去fork出来一个新进程，并且使用了namespace隔离新创建的进程和外部环境。
 4.如果用户指定了-it参数，就需要把当前进程的输入输出导入到标准输入输出上
 */
-func NewParentProcess(tty bool, volume string, containerId string, imageName string, envSlice []string) (*exec.Cmd, *os.File) {
+func NewParentProcess(tty bool, volume string, containerId string, imageName string, envSlice []string, namespaces *NamespaceConfig, initOpts *InitOptions) (*exec.Cmd, *os.File) {
 	// 创建匿名管道用于传递参数
 	readPipe, writePipe, err := os.Pipe()
 	if err != nil {
@@ -28,12 +29,11 @@ func NewParentProcess(tty bool, volume string, containerId string, imageName str
 		return nil, nil
 	}
 	// 这里的 init 指令就用用来在子进程中调用 initCommand
-	cmd := exec.Command("/proc/self/exe", "init")
+	cmd := exec.Command(initOpts.Binary, initOpts.args()...)
 	cmd.Env = append(os.Environ(), envSlice...)
-	// 设置隔离模式
+	// 设置隔离模式，共享宿主机或其他容器的 namespace 时不创建对应的新 namespace
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
+		Cloneflags: namespaces.CloneFlags(),
 	}
 	// 将输入输出绑定至终端
 	if tty {
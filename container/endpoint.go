@@ -0,0 +1,83 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Endpoint 容器在一个网络中的网络端点
+type Endpoint struct {
+	Network       string   `json:"network"`
+	Interface     string   `json:"interface"`     // 容器内的网卡名，按连接顺序为 eth0、eth1...
+	HostInterface string   `json:"hostInterface"` // 宿主机一侧的 veth 设备名
+	IP            string   `json:"ip,omitempty"`
+	IPv6          string   `json:"ipv6,omitempty"`
+	Aliases       []string `json:"aliases,omitempty"`     // 容器在这个网络中的别名
+	PortMapping   []string `json:"portMapping,omitempty"` // 发布到宿主机的端口
+}
+
+// Endpoint 返回容器在指定网络中的网络端点，没有连接这个网络时返回 nil
+func (info *Info) Endpoint(networkName string) *Endpoint {
+	for _, ep := range info.Endpoints {
+		if ep.Network == networkName {
+			return ep
+		}
+	}
+	return nil
+}
+
+// RemoveEndpoint 删除容器在指定网络中的网络端点
+func (info *Info) RemoveEndpoint(networkName string) {
+	endpoints := info.Endpoints[:0]
+	for _, ep := range info.Endpoints {
+		if ep.Network != networkName {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	info.Endpoints = endpoints
+}
+
+// NextInterface 返回容器中下一个可用的网卡名
+func (info *Info) NextInterface() string {
+	used := make(map[string]bool, len(info.Endpoints))
+	for _, ep := range info.Endpoints {
+		used[ep.Interface] = true
+	}
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("eth%d", i)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+// IPAddresses 返回容器在各个网络中的 IPv4 地址
+func (info *Info) IPAddresses() []string {
+	ips := make([]string, 0, len(info.Endpoints))
+	for _, ep := range info.Endpoints {
+		if ep.IP != "" {
+			ips = append(ips, ep.IP)
+		}
+	}
+	return ips
+}
+
+// loadLegacyEndpoint 旧版本的容器只能连接一个网络，只记录了容器 IP，这里转换为网络端点，以便停止容器时释放地址
+func loadLegacyEndpoint(info *Info, content []byte) {
+	if len(info.Endpoints) > 0 || info.NetworkName == "" || len(info.Id) < 5 {
+		return
+	}
+	legacy := struct {
+		IP string `json:"ip"`
+	}{}
+	if err := json.Unmarshal(content, &legacy); err != nil || legacy.IP == "" {
+		return
+	}
+	info.Endpoints = []*Endpoint{{
+		Network:       info.NetworkName,
+		Interface:     "cif-" + info.Id[:5],
+		HostInterface: info.Id[:5],
+		IP:            legacy.IP,
+		PortMapping:   info.PortMapping,
+	}}
+}
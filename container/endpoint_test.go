@@ -0,0 +1,38 @@
+package container
+
+import "testing"
+
+func TestNextInterface(t *testing.T) {
+	info := &Info{}
+	if got := info.NextInterface(); got != "eth0" {
+		t.Fatalf("first interface is %s, want eth0", got)
+	}
+	info.Endpoints = []*Endpoint{{Network: "a", Interface: "eth0"}, {Network: "b", Interface: "eth1"}, {Network: "c", Interface: "eth2"}}
+	info.RemoveEndpoint("b")
+	if got := info.NextInterface(); got != "eth1" {
+		t.Fatalf("interface of disconnected network should be reused, got %s", got)
+	}
+	if info.Endpoint("b") != nil || info.Endpoint("c") == nil {
+		t.Fatalf("endpoint b should be removed and c kept")
+	}
+}
+
+func TestLoadLegacyEndpoint(t *testing.T) {
+	content := []byte(`{"id":"1234567890","networkName":"testnet","ip":"10.0.0.2","portMapping":["8080:80"]}`)
+	info := &Info{Id: "1234567890", NetworkName: "testnet", PortMapping: []string{"8080:80"}}
+	loadLegacyEndpoint(info, content)
+	if len(info.Endpoints) != 1 {
+		t.Fatalf("legacy ip should be converted to one endpoint, got %d", len(info.Endpoints))
+	}
+	ep := info.Endpoints[0]
+	if ep.Network != "testnet" || ep.IP != "10.0.0.2" || ep.HostInterface != "12345" || len(ep.PortMapping) != 1 {
+		t.Fatalf("legacy endpoint is %+v", ep)
+	}
+
+	// 没有记录 IP 的容器没有连接网络
+	info = &Info{Id: "1234567890", NetworkName: "testnet"}
+	loadLegacyEndpoint(info, []byte(`{"ip":""}`))
+	if len(info.Endpoints) != 0 {
+		t.Fatalf("container without ip should have no endpoint")
+	}
+}
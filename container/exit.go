@@ -0,0 +1,55 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+)
+
+const (
+	minOomScoreAdj = -1000
+	maxOomScoreAdj = 1000
+)
+
+// ExitCode 根据进程退出状态计算容器退出码，被信号杀死时为 128 + 信号值
+func ExitCode(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return signalExitBase + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// ValidateOomScoreAdj 检查 oom_score_adj 是否在内核允许的范围内
+func ValidateOomScoreAdj(adj int) error {
+	if adj < minOomScoreAdj || adj > maxOomScoreAdj {
+		return fmt.Errorf("invalid oom score adj %d, must be between %d and %d", adj, minOomScoreAdj, maxOomScoreAdj)
+	}
+	return nil
+}
+
+// SetOomScoreAdj 设置进程的 oom_score_adj，值越大越优先被 OOM killer 选中，容器内的进程会继承该值
+func SetOomScoreAdj(pid, adj int) error {
+	adjPath := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := os.WriteFile(adjPath, []byte(strconv.Itoa(adj)), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", adjPath)
+	}
+	return nil
+}
+
+// StatusDescription 返回容器状态，已退出的容器附带退出码以及是否被 OOM killer 杀死
+func (info *Info) StatusDescription() string {
+	if info.Status != Exit && (info.Status != STOP || info.FinishedTime == "") {
+		return info.Status
+	}
+	if info.OOMKilled {
+		return fmt.Sprintf("%s (%d, OOMKilled)", info.Status, info.ExitCode)
+	}
+	return fmt.Sprintf("%s (%d)", info.Status, info.ExitCode)
+}
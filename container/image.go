@@ -0,0 +1,112 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+)
+
+// imageSuffix 镜像以 tar 包的形式保存在镜像目录下
+const imageSuffix = ".tar"
+
+// ImageConfig 镜像的元数据，与镜像 tar 包放在同一目录下，文件不存在时使用默认配置
+type ImageConfig struct {
+	StopSignal   string   `json:"stopSignal,omitempty"`   // 停止容器时发送的信号，默认为 SIGTERM
+	ExposedPorts []string `json:"exposedPorts,omitempty"` // 容器暴露的端口，例如 80/tcp，run -P 时发布到宿主机的随机端口
+}
+
+// LoadImageConfig 读取镜像元数据
+func LoadImageConfig(imageName string) (*ImageConfig, error) {
+	config := &ImageConfig{}
+	configPath := utils.GetImageConfig(imageName)
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, errors.WithMessagef(err, "read image config %s failed", configPath)
+	}
+	if err = json.Unmarshal(content, config); err != nil {
+		return nil, errors.WithMessagef(err, "unmarshal image config %s failed", configPath)
+	}
+	return config, nil
+}
+
+// SaveImageConfig 保存镜像元数据
+func SaveImageConfig(imageName string, config *ImageConfig) error {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return errors.WithMessage(err, "image config marshal failed")
+	}
+	configPath := utils.GetImageConfig(imageName)
+	if err = os.WriteFile(configPath, content, constant.Perm0644); err != nil {
+		return errors.WithMessagef(err, "write image config %s failed", configPath)
+	}
+	return nil
+}
+
+// Image 本地镜像信息
+type Image struct {
+	Name    string       `json:"name"`
+	Path    string       `json:"path"`    // 镜像 tar 包的路径
+	Size    int64        `json:"size"`    // 镜像 tar 包的大小
+	Created string       `json:"created"` // 镜像 tar 包的修改时间
+	Config  *ImageConfig `json:"config"`
+}
+
+// ListImages 列出镜像目录下的所有镜像
+func ListImages() ([]*Image, error) {
+	entries, err := os.ReadDir(utils.ImagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithMessagef(err, "read dir %s failed", utils.ImagePath)
+	}
+	images := make([]*Image, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), imageSuffix)
+		if entry.IsDir() || !ok {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		image, err := loadImage(name, fileInfo)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// InspectImage 获取镜像信息，镜像不存在时返回的错误满足 os.ErrNotExist
+func InspectImage(imageName string) (*Image, error) {
+	imagePath := utils.GetImage(imageName)
+	fileInfo, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "stat image %s failed", imageName)
+	}
+	return loadImage(imageName, fileInfo)
+}
+
+// loadImage 根据镜像 tar 包的文件信息和镜像元数据构建镜像信息
+func loadImage(imageName string, fileInfo os.FileInfo) (*Image, error) {
+	config, err := LoadImageConfig(imageName)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Name:    imageName,
+		Path:    utils.GetImage(imageName),
+		Size:    fileInfo.Size(),
+		Created: fileInfo.ModTime().Format(TimeFormat),
+		Config:  config,
+	}, nil
+}
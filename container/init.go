@@ -19,13 +19,36 @@ import (
 // index3：带过来的第一个FD，也就是readPipe
 const fdIndex = 3
 
+// InitOptions 容器init进程的参数，通过 init 子命令的参数传递给容器内的进程
+type InitOptions struct {
+	Binary  string   // 用于启动 init 进程的 tiny-docker 可执行文件
+	Reap    bool     // 保留 init 作为 PID 1，转发信号并回收僵尸进程
+	Ulimits []string // 格式为 name=soft:hard
+	Sysctls []string // 格式为 key=value
+}
+
+// args 构建 init 子命令的参数
+func (o *InitOptions) args() []string {
+	args := []string{"init"}
+	if o.Reap {
+		args = append(args, "--reap")
+	}
+	for _, ulimit := range o.Ulimits {
+		args = append(args, "--ulimit", ulimit)
+	}
+	for _, sysctl := range o.Sysctls {
+		args = append(args, "--sysctl", sysctl)
+	}
+	return args
+}
+
 // RunContainerInitProcess 启动容器的init进程
 /*
 这里的init函数是在容器内部执行的，也就是说，代码执行到这里后，容器所在的进程其实就已经创建出来了，
 这是本容器执行的第一一个进程。
 使用mount先去挂载proc文件系统，以便后面通过ps等系统命令去查看当前进程资源的情况。
 */
-func RunContainerInitProcess() error {
+func RunContainerInitProcess(opts *InitOptions) error {
 	command := readUserCommand()
 	if command == nil {
 		return errors.New("run command in container err, command is nil")
@@ -33,6 +56,10 @@ func RunContainerInitProcess() error {
 
 	// 挂载文件系统
 	setUpMount()
+	// 收到命令时网络已经配置完成，这里可以修改网卡相关的 sysctl
+	if err := setSysctls(opts.Sysctls); err != nil {
+		return err
+	}
 
 	path, err := exec.LookPath(command[0])
 	if err != nil {
@@ -43,6 +70,16 @@ func RunContainerInitProcess() error {
 	logrus.Info("Find path: ", path)
 	logrus.Info("All command is: ", command)
 
+	// 资源限制在 exec 前设置，用户进程会继承
+	if err = SetRlimits(opts.Ulimits); err != nil {
+		return err
+	}
+
+	// 指定了 --init 时当前进程保留为 PID 1，负责转发信号和回收僵尸进程
+	if opts.Reap {
+		return runMinimalInit(path, command)
+	}
+
 	if err := syscall.Exec(path, command, os.Environ()); err != nil {
 		logrus.Errorf(err.Error())
 	}
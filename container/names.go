@@ -0,0 +1,140 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NameIndexLoc 容器名索引目录，每个容器名对应一个文件，文件内容为容器id
+	NameIndexLoc = "/var/lib/tiny-docker/names/"
+	// ShortIDLength 列表中显示的容器id长度
+	ShortIDLength = 12
+)
+
+var (
+	// ErrNameInUse 容器名已被其他容器使用
+	ErrNameInUse = errors.New("container name already in use")
+	// ErrAmbiguousID 容器id前缀匹配到多个容器
+	ErrAmbiguousID = errors.New("container id prefix is ambiguous")
+
+	validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// ValidateName 检查容器名是否合法，容器名同时作为索引文件名，不能包含路径分隔符
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid container name [%s], only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", name)
+	}
+	return nil
+}
+
+// ShortID 返回用于显示的短容器id
+func ShortID(containerId string) string {
+	if len(containerId) > ShortIDLength {
+		return containerId[:ShortIDLength]
+	}
+	return containerId
+}
+
+// ReserveName 在索引中为容器登记容器名，容器名已被其他容器使用时返回 ErrNameInUse
+// 通过 O_EXCL 创建索引文件，多个进程同时使用同一个容器名时只有一个能成功
+func ReserveName(name, containerId string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(NameIndexLoc, constant.Perm0755); err != nil {
+		return errors.Wrapf(err, "mkdir %s failed", NameIndexLoc)
+	}
+	namePath := path.Join(NameIndexLoc, name)
+	file, err := os.OpenFile(namePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, constant.Perm0644)
+	if err != nil {
+		if !os.IsExist(err) {
+			return errors.Wrapf(err, "create %s failed", namePath)
+		}
+		owner, readErr := lookupName(name)
+		if readErr != nil || owner != containerId {
+			return errors.WithMessagef(ErrNameInUse, "name [%s] is used by container [%s]", name, owner)
+		}
+		return nil
+	}
+	defer file.Close()
+	if _, err = file.WriteString(containerId); err != nil {
+		_ = os.Remove(namePath)
+		return errors.Wrapf(err, "write %s failed", namePath)
+	}
+	return nil
+}
+
+// ReleaseName 从索引中删除容器名，只删除属于该容器的记录
+func ReleaseName(name, containerId string) {
+	if name == "" {
+		return
+	}
+	if owner, err := lookupName(name); err == nil && owner == containerId {
+		_ = os.Remove(path.Join(NameIndexLoc, name))
+	}
+}
+
+// lookupName 通过容器名索引查找容器id
+func lookupName(name string) (string, error) {
+	if ValidateName(name) != nil {
+		return "", os.ErrNotExist
+	}
+	content, err := os.ReadFile(path.Join(NameIndexLoc, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// Lookup 根据完整的容器id、容器名或者唯一的容器id前缀读取容器信息
+// 容器不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)，前缀匹配到多个容器时返回 ErrAmbiguousID
+func Lookup(ref string) (*Info, error) {
+	containerId, err := ResolveID(ref)
+	if err != nil {
+		return nil, err
+	}
+	return GetInfo(containerId)
+}
+
+// ResolveID 将完整的容器id、容器名或者唯一的容器id前缀转换为完整的容器id
+func ResolveID(ref string) (string, error) {
+	if ref == "" {
+		return "", errors.New("container id or name can not be empty")
+	}
+	if strings.ContainsRune(ref, '/') {
+		return "", errors.WithMessagef(os.ErrNotExist, "no such container [%s]", ref)
+	}
+	if _, err := os.Stat(path.Join(fmt.Sprintf(InfoLocFormat, ref), ConfigName)); err == nil {
+		return ref, nil
+	}
+	if containerId, err := lookupName(ref); err == nil {
+		return containerId, nil
+	}
+
+	entries, err := os.ReadDir(InfoLoc)
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "read dir %s failed", InfoLoc)
+	}
+	matches := make([]string, 0, 1)
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ref) {
+			matches = append(matches, entry.Name())
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.WithMessagef(os.ErrNotExist, "no such container [%s]", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", errors.WithMessagef(ErrAmbiguousID, "[%s] matches %d containers", ref, len(matches))
+	}
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestValidateName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"web", true},
+		{"web-1.test_a", true},
+		{"1web", true},
+		{"", false},
+		{"-web", false},
+		{".web", false},
+		{"web/db", false},
+		{"../names", false},
+		{"web db", false},
+	}
+	for _, c := range cases {
+		err := ValidateName(c.name)
+		if c.valid && err != nil {
+			t.Fatalf("name %q should be valid: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Fatalf("name %q should be invalid", c.name)
+		}
+	}
+}
+
+func TestGenerateContainerID(t *testing.T) {
+	hex := regexp.MustCompile(`^[0-9a-f]{64}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := GenerateContainerID()
+		if !hex.MatchString(id) {
+			t.Fatalf("container id %s is not 64 hex characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate container id %s", id)
+		}
+		seen[id] = true
+		if short := ShortID(id); short != id[:ShortIDLength] {
+			t.Fatalf("short id of %s is %s", id, short)
+		}
+	}
+}
+
+func TestReserveName(t *testing.T) {
+	name := "names-test-" + ShortID(GenerateContainerID())
+	first, second := GenerateContainerID(), GenerateContainerID()
+	if err := ReserveName(name, first); err != nil {
+		t.Fatalf("reserve name %s error %v", name, err)
+	}
+	defer ReleaseName(name, first)
+	// 同一个容器重复登记不报错
+	if err := ReserveName(name, first); err != nil {
+		t.Fatalf("reserve name %s again error %v", name, err)
+	}
+	if err := ReserveName(name, second); !errors.Is(err, ErrNameInUse) {
+		t.Fatalf("reserve used name %s should fail with ErrNameInUse, got %v", name, err)
+	}
+	// 其他容器不能释放不属于自己的容器名
+	ReleaseName(name, second)
+	if id, err := lookupName(name); err != nil || id != first {
+		t.Fatalf("name %s should still belong to %s, got %s %v", name, first, id, err)
+	}
+	ReleaseName(name, first)
+	if err := ReserveName(name, second); err != nil {
+		t.Fatalf("reserve released name %s error %v", name, err)
+	}
+	ReleaseName(name, second)
+}
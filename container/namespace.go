@@ -0,0 +1,181 @@
+package container
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// namespace 共享模式
+// ""                 使用容器私有的 namespace
+// none               使用私有的 namespace，对 net 而言不配置任何网络设备
+// host               直接使用宿主机的 namespace
+// container:<id>     加入指定容器的 namespace
+const (
+	NamespaceModeNone      = "none"
+	NamespaceModeHost      = "host"
+	NamespaceModeContainer = "container:"
+)
+
+// NamespaceConfig 记录容器 net/pid/ipc/uts namespace 的来源
+type NamespaceConfig struct {
+	NetMode string `json:"netMode,omitempty"`
+	PidMode string `json:"pidMode,omitempty"`
+	IpcMode string `json:"ipcMode,omitempty"`
+	UtsMode string `json:"utsMode,omitempty"`
+}
+
+// IsNamespaceMode 判断 --net 等参数是否为 namespace 模式，否则视为网络名
+func IsNamespaceMode(mode string) bool {
+	return mode == NamespaceModeNone || mode == NamespaceModeHost || strings.HasPrefix(mode, NamespaceModeContainer)
+}
+
+// SharedContainer 返回 container:<id> 模式中的容器id，其他模式返回空
+func SharedContainer(mode string) string {
+	if !strings.HasPrefix(mode, NamespaceModeContainer) {
+		return ""
+	}
+	return strings.TrimPrefix(mode, NamespaceModeContainer)
+}
+
+// Validate 校验各 namespace 模式是否合法
+func (c *NamespaceConfig) Validate() error {
+	for _, item := range c.items() {
+		if item.mode == "" || item.mode == NamespaceModeNone || item.mode == NamespaceModeHost || SharedContainer(item.mode) != "" {
+			continue
+		}
+		return fmt.Errorf("invalid %s mode [%s], must be host, none or container:<id|name>", item.name, item.mode)
+	}
+	return nil
+}
+
+// Resolve 将 container:<id|name> 模式中的容器名或id前缀替换为完整的容器id
+func (c *NamespaceConfig) Resolve() error {
+	for _, mode := range []*string{&c.NetMode, &c.PidMode, &c.IpcMode, &c.UtsMode} {
+		ref := SharedContainer(*mode)
+		if ref == "" {
+			continue
+		}
+		id, err := ResolveID(ref)
+		if err != nil {
+			return err
+		}
+		*mode = NamespaceModeContainer + id
+	}
+	return nil
+}
+
+// CloneFlags 根据 namespace 模式生成 clone 参数
+// host 和 container 模式不创建新的 namespace，container 模式在启动前通过 setns 加入目标 namespace
+func (c *NamespaceConfig) CloneFlags() uintptr {
+	flags := uintptr(syscall.CLONE_NEWNS)
+	for _, item := range c.items() {
+		if item.mode == "" || item.mode == NamespaceModeNone {
+			flags |= item.flag
+		}
+	}
+	return flags
+}
+
+// SharedContainers 返回当前容器共享了 namespace 的容器id
+func (c *NamespaceConfig) SharedContainers() []string {
+	ids := make([]string, 0)
+	for _, item := range c.items() {
+		if id := SharedContainer(item.mode); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type namespaceItem struct {
+	name string
+	mode string
+	flag uintptr
+}
+
+func (c *NamespaceConfig) items() []namespaceItem {
+	return []namespaceItem{
+		{name: "net", mode: c.NetMode, flag: syscall.CLONE_NEWNET},
+		{name: "pid", mode: c.PidMode, flag: syscall.CLONE_NEWPID},
+		{name: "ipc", mode: c.IpcMode, flag: syscall.CLONE_NEWIPC},
+		{name: "uts", mode: c.UtsMode, flag: syscall.CLONE_NEWUTS},
+	}
+}
+
+// StartProcess 启动容器进程，如果需要共享其他容器的 namespace，则先通过 setns 加入
+func StartProcess(cmd *exec.Cmd, ns *NamespaceConfig) error {
+	type joinNs struct {
+		path string
+		flag int
+	}
+	joins := make([]joinNs, 0)
+	for _, item := range ns.items() {
+		id := SharedContainer(item.mode)
+		if id == "" {
+			continue
+		}
+		info, err := GetInfo(id)
+		if err != nil {
+			return errors.WithMessagef(err, "get container [%s] info failed", id)
+		}
+		if info.Status != RUNNING || info.Pid == "" {
+			return fmt.Errorf("can not join %s namespace of container [%s], container is not running", item.name, id)
+		}
+		joins = append(joins, joinNs{
+			path: fmt.Sprintf("/proc/%s/ns/%s", info.Pid, item.name),
+			flag: int(item.flag),
+		})
+	}
+	if len(joins) == 0 {
+		return cmd.Start()
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		// setns 只对当前线程生效，子进程由当前线程 fork 出来，会继承线程所在的 namespace
+		// 这里锁定线程后不再解锁，goroutine 退出时该线程随之销毁，避免影响其他 goroutine
+		runtime.LockOSThread()
+		for _, join := range joins {
+			fd, err := unix.Open(join.path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				errCh <- errors.Wrapf(err, "open namespace %s failed", join.path)
+				return
+			}
+			err = unix.Setns(fd, join.flag)
+			_ = unix.Close(fd)
+			if err != nil {
+				errCh <- errors.Wrapf(err, "setns %s failed", join.path)
+				return
+			}
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
+
+// NamespaceUsers 返回仍在运行且共享了指定容器 namespace 的容器id
+func NamespaceUsers(containerId string) ([]string, error) {
+	infos, err := ListInfos()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0)
+	for _, info := range infos {
+		if info.Id == containerId || info.Status != RUNNING && info.Status != PAUSED {
+			continue
+		}
+		for _, id := range info.Namespaces.SharedContainers() {
+			if id == containerId {
+				users = append(users, info.Id)
+				break
+			}
+		}
+	}
+	return users, nil
+}
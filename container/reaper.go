@@ -0,0 +1,77 @@
+package container
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// signalExitBase 子进程被信号杀死时，以 128 + 信号值作为退出码，与 shell 的约定保持一致
+const signalExitBase = 128
+
+// runMinimalInit 作为容器内的 PID 1 运行用户命令
+/*
+用户命令直接作为 PID 1 运行时存在两个问题：
+1.PID 1 需要负责回收孤儿进程，大多数程序不会 wait 子进程，容器内会不断累积僵尸进程
+2.内核不会向 PID 1 投递没有注册处理函数的信号，因此 SIGTERM 经常无法停止容器
+这里 fork 出用户命令，将收到的信号转发给它，并回收所有退出的子进程，用户命令退出后以相同的状态退出
+*/
+func runMinimalInit(path string, command []string) error {
+	// 在启动子进程前注册信号，避免子进程很快退出时错过 SIGCHLD
+	sigCh := make(chan os.Signal, 128)
+	signal.Notify(sigCh)
+
+	cmd := exec.Command(path)
+	// 与直接 exec 用户命令时一致，argv[0] 使用用户指定的命令名而不是查找到的路径
+	cmd.Args = command
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "start command %v failed", command)
+	}
+	childPid := cmd.Process.Pid
+	logrus.Infof("init forked command pid %d", childPid)
+
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exited, code := reapChildren(childPid); exited {
+				os.Exit(code)
+			}
+		case syscall.SIGURG:
+			// SIGURG 被 Go runtime 用于抢占调度，不需要转发
+		default:
+			if err := syscall.Kill(childPid, sig.(syscall.Signal)); err != nil {
+				logrus.Warnf("forward signal %v to %d failed: %v", sig, childPid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reapChildren 回收所有已经退出的子进程，如果用户命令已经退出则返回其退出码
+func reapChildren(childPid int) (bool, int) {
+	exited, code := false, 0
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return exited, code
+		}
+		if pid != childPid {
+			continue
+		}
+		exited = true
+		if status.Signaled() {
+			code = signalExitBase + int(status.Signal())
+		} else {
+			code = status.ExitStatus()
+		}
+	}
+}
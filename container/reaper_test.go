@@ -0,0 +1,112 @@
+package container
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// reaperTestEnv 设置时测试进程作为 init 运行 -- 之后的命令，第一个参数是命令的路径，其余是命令的 argv
+// runMinimalInit 会以用户命令的状态退出当前进程
+const reaperTestEnv = "TINY_DOCKER_TEST_REAPER"
+
+// startReaper 重新执行测试程序，在子进程中通过 runMinimalInit 运行 command
+// 返回时用户命令已经完成 exec，之后发送的信号都会转发给用户命令
+// 子进程退出并且标准错误读取完之后 drained 被关闭
+func startReaper(t *testing.T, path string, command []string) (cmd *exec.Cmd, stdout *strings.Builder, drained chan struct{}) {
+	cmd = exec.Command(os.Args[0], append([]string{"-test.run=^TestMinimalInit$", "--", path}, command...)...)
+	cmd.Env = append(os.Environ(), reaperTestEnv+"=1")
+	stdout = &strings.Builder{}
+	cmd.Stdout = stdout
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// fork 之后 exec 之前收到的信号会被丢弃，从启动日志中取得用户命令的 pid，等到它完成 exec
+	scanner := bufio.NewScanner(stderr)
+	childPid := 0
+	for childPid == 0 && scanner.Scan() {
+		if _, after, ok := strings.Cut(scanner.Text(), "init forked command pid "); ok {
+			// 日志使用 logrus 的文本格式，msg="init forked command pid 123"
+			childPid, _ = strconv.Atoi(strings.Trim(strings.Fields(after)[0], `"`))
+		}
+	}
+	for childPid != 0 {
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", childPid))
+		if err != nil || exe == path {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	drained = make(chan struct{})
+	go func() {
+		defer close(drained)
+		for scanner.Scan() {
+		}
+	}()
+	return cmd, stdout, drained
+}
+
+func TestMinimalInit(t *testing.T) {
+	if os.Getenv(reaperTestEnv) != "" {
+		_ = runMinimalInit(flag.Arg(0), flag.Args()[1:])
+		os.Exit(1)
+	}
+
+	cases := []struct {
+		name    string // 用户命令的可执行文件名
+		command []string
+		signal  syscall.Signal // 不为 0 时向 init 发送信号，由 init 转发给用户命令
+		code    int
+		stdout  string
+	}{
+		{"sh", []string{"sh", "-c", "exit 3"}, 0, 3, ""},
+		// argv[0] 是用户指定的命令名
+		{"sh", []string{"tdsh", "-c", "echo $0"}, 0, 0, "tdsh\n"},
+		// 直接运行 sleep，避免 shell 被结束后残留的子进程一直占用输出
+		{"sleep", []string{"sleep", "100"}, syscall.SIGTERM, signalExitBase + int(syscall.SIGTERM), ""},
+	}
+	for _, c := range cases {
+		path, err := exec.LookPath(c.name)
+		if err != nil {
+			t.Skipf("%s is not available", c.name)
+		}
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			t.Fatal(err)
+		}
+		cmd, stdout, drained := startReaper(t, path, c.command)
+		if c.signal != 0 {
+			if err := cmd.Process.Signal(c.signal); err != nil {
+				t.Fatal(err)
+			}
+		}
+		done := make(chan error, 1)
+		go func() {
+			<-drained
+			done <- cmd.Wait()
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			_ = cmd.Process.Kill()
+			t.Fatalf("init running %v did not exit", c.command)
+		}
+		if code := cmd.ProcessState.ExitCode(); code != c.code {
+			t.Fatalf("init running %v exit with %d, want %d", c.command, code, c.code)
+		}
+		if stdout.String() != c.stdout {
+			t.Fatalf("init running %v output %q, want %q", c.command, stdout.String(), c.stdout)
+		}
+	}
+}
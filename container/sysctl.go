@@ -0,0 +1,75 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+)
+
+const procSysPath = "/proc/sys"
+
+// ipcSysctls 属于 ipc namespace 的 sysctl，以 . 结尾的表示前缀
+var ipcSysctls = []string{"kernel.msgmax", "kernel.msgmnb", "kernel.msgmni", "kernel.sem",
+	"kernel.shmall", "kernel.shmmax", "kernel.shmmni", "kernel.shm_rmid_forced", "fs.mqueue."}
+
+// ParseSysctl 解析 --sysctl 参数，e.g. net.core.somaxconn=1024
+func ParseSysctl(raw string) (string, string, error) {
+	key, value, ok := strings.Cut(raw, "=")
+	if !ok || key == "" || value == "" {
+		return "", "", fmt.Errorf("invalid sysctl %s, must be key=value", raw)
+	}
+	return key, value, nil
+}
+
+// ValidateSysctl 检查 sysctl 是否属于容器拥有的 namespace
+/*
+/proc/sys 下的大部分参数是全局的，容器内修改会影响宿主机，只有按 namespace 隔离的参数才允许修改:
+1.net.* 属于 net namespace，容器需要拥有独立的网络
+2.kernel.msg*、kernel.shm*、kernel.sem、fs.mqueue.* 属于 ipc namespace，容器需要拥有独立的 ipc
+共享宿主机或其他容器的 namespace 时，修改会影响宿主机或其他容器，同样不允许
+*/
+func ValidateSysctl(raw string, namespaces *NamespaceConfig) error {
+	key, _, err := ParseSysctl(raw)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(key, "net.") {
+		if !ownNamespace(namespaces.NetMode) {
+			return fmt.Errorf("sysctl %s is not allowed, container does not own its net namespace (net mode %s)", key, namespaces.NetMode)
+		}
+		return nil
+	}
+	for _, ipcKey := range ipcSysctls {
+		if key == ipcKey || (strings.HasSuffix(ipcKey, ".") && strings.HasPrefix(key, ipcKey)) {
+			if !ownNamespace(namespaces.IpcMode) {
+				return fmt.Errorf("sysctl %s is not allowed, container does not own its ipc namespace (ipc mode %s)", key, namespaces.IpcMode)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("sysctl %s is not allowed, only namespaced sysctls (net.*, kernel.msg*, kernel.shm*, kernel.sem, fs.mqueue.*) are supported", key)
+}
+
+// ownNamespace 为空或 none 时容器会创建新的 namespace
+func ownNamespace(mode string) bool {
+	return mode == "" || mode == NamespaceModeNone
+}
+
+// setSysctls 在容器内写入 /proc/sys，需要在挂载 proc 之后调用
+func setSysctls(sysctls []string) error {
+	for _, raw := range sysctls {
+		key, value, err := ParseSysctl(raw)
+		if err != nil {
+			return err
+		}
+		sysctlPath := path.Join(procSysPath, strings.ReplaceAll(key, ".", "/"))
+		if err = os.WriteFile(sysctlPath, []byte(value), constant.Perm0644); err != nil {
+			return errors.Wrapf(err, "set sysctl %s failed", raw)
+		}
+	}
+	return nil
+}
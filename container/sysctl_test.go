@@ -0,0 +1,34 @@
+package container
+
+import "testing"
+
+func TestValidateSysctl(t *testing.T) {
+	own := &NamespaceConfig{}
+	host := &NamespaceConfig{NetMode: NamespaceModeHost, IpcMode: NamespaceModeHost}
+	cases := []struct {
+		sysctl     string
+		namespaces *NamespaceConfig
+		allowed    bool
+	}{
+		{"net.core.somaxconn=1024", own, true},
+		{"net.ipv4.ip_forward=1", &NamespaceConfig{NetMode: NamespaceModeNone}, true},
+		{"kernel.shmmax=1000000", own, true},
+		{"kernel.msgmax=8192", own, true},
+		{"fs.mqueue.msg_max=100", own, true},
+		{"net.core.somaxconn=1024", host, false},
+		{"net.core.somaxconn=1024", &NamespaceConfig{NetMode: NamespaceModeContainer + "123"}, false},
+		{"kernel.shmmax=1000000", host, false},
+		{"kernel.hostname=test", own, false},
+		{"vm.swappiness=10", own, false},
+		{"net.core.somaxconn", own, false},
+	}
+	for _, c := range cases {
+		err := ValidateSysctl(c.sysctl, c.namespaces)
+		if c.allowed && err != nil {
+			t.Fatalf("sysctl %s should be allowed with %+v: %v", c.sysctl, *c.namespaces, err)
+		}
+		if !c.allowed && err == nil {
+			t.Fatalf("sysctl %s should not be allowed with %+v", c.sysctl, *c.namespaces)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// unlimitedRlimit 表示不限制，e.g. --ulimit memlock=-1:-1
+const unlimitedRlimit = "-1"
+
+// rlimits --ulimit 支持的资源名与 setrlimit 资源类型的对应关系
+var rlimits = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+// Ulimit 容器进程的资源限制，格式为 name=soft:hard，未指定 hard 时与 soft 相同
+type Ulimit struct {
+	Name string
+	Soft uint64
+	Hard uint64
+}
+
+// ParseUlimit 解析 --ulimit 参数，e.g. nofile=1024:2048
+func ParseUlimit(raw string) (*Ulimit, error) {
+	name, value, ok := strings.Cut(raw, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid ulimit %s, must be name=soft[:hard]", raw)
+	}
+	if _, ok = rlimits[name]; !ok {
+		return nil, fmt.Errorf("invalid ulimit %s, unknown resource %s", raw, name)
+	}
+	softStr, hardStr, hasHard := strings.Cut(value, ":")
+	if !hasHard {
+		hardStr = softStr
+	}
+	soft, err := parseRlimitValue(softStr)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid ulimit %s", raw)
+	}
+	hard, err := parseRlimitValue(hardStr)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid ulimit %s", raw)
+	}
+	if soft > hard {
+		return nil, fmt.Errorf("invalid ulimit %s, soft limit must not be greater than hard limit", raw)
+	}
+	return &Ulimit{Name: name, Soft: soft, Hard: hard}, nil
+}
+
+func parseRlimitValue(value string) (uint64, error) {
+	if value == unlimitedRlimit {
+		return unix.RLIM_INFINITY, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// SetRlimits 设置当前进程的资源限制，exec 之后的用户进程会继承
+func SetRlimits(ulimits []string) error {
+	for _, raw := range ulimits {
+		ulimit, err := ParseUlimit(raw)
+		if err != nil {
+			return err
+		}
+		limit := &unix.Rlimit{Cur: ulimit.Soft, Max: ulimit.Hard}
+		if err = unix.Setrlimit(rlimits[ulimit.Name], limit); err != nil {
+			return errors.Wrapf(err, "setrlimit %s failed", raw)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/client"
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDaemonSocket = "/run/tiny-docker.sock"
+	shutdownTimeout     = 10 * time.Second
+)
+
+// badRequestError 请求参数错误，返回 400
+type badRequestError struct {
+	error
+}
+
+// daemon 通过 unix socket 提供与 docker engine 类似的 HTTP API
+type daemon struct {
+	// mu 串行执行修改容器和网络状态的请求，避免并发的 run、rm 等操作互相影响
+	mu sync.Mutex
+	// containers 单个容器的锁，stop 需要等待容器退出，只锁定对应的容器，不阻塞其他请求
+	containers *containerLocks
+	// client 在本地执行容器操作
+	client *client.Client
+}
+
+func newDaemon() *daemon {
+	return &daemon{
+		containers: &containerLocks{locks: make(map[string]*containerLock)},
+		client:     client.New(client.Config{}),
+	}
+}
+
+// containerLocks 按容器id分配的锁，没有请求使用时删除
+type containerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*containerLock
+}
+
+type containerLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock 锁定容器，ref 可以是容器名或者id前缀，返回解锁函数
+func (l *containerLocks) lock(ref string) func() {
+	// 同一个容器的不同写法需要使用同一把锁，容器不存在时由之后的处理函数返回错误
+	key := ref
+	if containerId, err := container.ResolveID(ref); err == nil {
+		key = containerId
+	}
+	l.mu.Lock()
+	cl, ok := l.locks[key]
+	if !ok {
+		cl = &containerLock{}
+		l.locks[key] = cl
+	}
+	cl.refs++
+	l.mu.Unlock()
+
+	cl.Lock()
+	return func() {
+		cl.Unlock()
+		l.mu.Lock()
+		if cl.refs--; cl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// apiHandler 处理请求，返回的错误会被转换为对应的状态码
+type apiHandler func(w http.ResponseWriter, r *http.Request) error
+
+// runDaemon 启动 daemon 并监听 socketPath，收到 SIGINT、SIGTERM 后退出
+func runDaemon(socketPath string) error {
+	// 删除上次异常退出时残留的 socket 文件
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove socket %s failed", socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrapf(err, "listen on %s failed", socketPath)
+	}
+	defer os.Remove(socketPath)
+	// 只允许 root 和同组用户访问 daemon
+	if err = os.Chmod(socketPath, constant.Perm0660); err != nil {
+		return errors.Wrapf(err, "chmod socket %s failed", socketPath)
+	}
+
+	// 清除上次运行时残留的网络规则，并根据记录的网络和容器重建
+	if err = network.Reconcile(); err != nil {
+		logrus.Errorf("reconcile network rules failed, detail: %v", err)
+	}
+
+	d := newDaemon()
+	server := &http.Server{Handler: d.routes()}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		logrus.Infof("receive signal %v, shutting down daemon", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	logrus.Infof("daemon listening on %s", socketPath)
+	if err = server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "serve api failed")
+	}
+	return nil
+}
+
+func (d *daemon) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /_ping", d.handle(d.ping, false))
+
+	mux.Handle("GET /containers/json", d.handle(d.listContainers, false))
+	mux.Handle("POST /containers/create", d.handle(d.createContainer, true))
+	mux.Handle("GET /containers/{id}/json", d.handle(d.inspectContainer, false))
+	mux.Handle("POST /containers/{id}/start", d.handle(d.startContainer, true))
+	mux.Handle("POST /containers/{id}/stop", d.handleContainer(d.stopContainer))
+	mux.Handle("POST /containers/{id}/kill", d.handle(d.killContainer, false))
+	mux.Handle("POST /containers/{id}/pause", d.handle(d.pauseContainer, true))
+	mux.Handle("POST /containers/{id}/unpause", d.handle(d.unpauseContainer, true))
+	mux.Handle("GET /containers/{id}/port", d.handle(d.containerPort, false))
+	mux.Handle("GET /containers/{id}/logs", d.handle(d.containerLogs, false))
+	mux.Handle("POST /containers/{id}/rename", d.handle(d.renameContainer, true))
+	mux.Handle("POST /containers/{id}/update", d.handle(d.updateContainer, true))
+	mux.Handle("DELETE /containers/{id}", d.handle(d.removeContainer, true))
+
+	mux.Handle("GET /networks", d.handle(d.listNetworks, false))
+	mux.Handle("POST /networks/create", d.handle(d.createNetwork, true))
+	mux.Handle("GET /networks/{name}", d.handle(d.inspectNetwork, false))
+	mux.Handle("DELETE /networks/{name}", d.handle(d.removeNetwork, true))
+	mux.Handle("POST /networks/{name}/connect", d.handle(d.connectNetwork, true))
+	mux.Handle("POST /networks/{name}/disconnect", d.handle(d.disconnectNetwork, true))
+	mux.Handle("GET /firewall", d.handle(d.firewall, false))
+	mux.Handle("POST /firewall", d.handle(d.setFirewall, true))
+
+	mux.Handle("POST /commit", d.handle(d.commitContainer, true))
+	mux.Handle("GET /images/json", d.handle(d.listImages, false))
+	mux.Handle("GET /images/{name}/json", d.handle(d.inspectImage, false))
+
+	mux.Handle("GET /events", d.handle(d.events, false))
+	return mux
+}
+
+// handle 包装 apiHandler，locked 为 true 时请求串行执行
+// 路径中带有容器id的请求先锁定容器再串行执行，与同一个容器的 stop 互斥
+func (d *daemon) handle(fn apiHandler, locked bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if locked {
+			if id := r.PathValue("id"); id != "" {
+				defer d.containers.lock(id)()
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+		}
+		d.serve(fn, w, r)
+	})
+}
+
+// handleContainer 包装 apiHandler，只锁定路径中的容器，用于 stop 这类需要长时间等待容器退出的请求
+// 容器信息的修改由 container.UpdateInfo 的文件锁保护，等待期间其他容器和网络的请求可以继续执行
+func (d *daemon) handleContainer(fn apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer d.containers.lock(r.PathValue("id"))()
+		d.serve(fn, w, r)
+	})
+}
+
+// serve 执行 apiHandler，返回的错误转换为对应的状态码
+func (d *daemon) serve(fn apiHandler, w http.ResponseWriter, r *http.Request) {
+	logrus.Infof("%s %s", r.Method, r.URL.String())
+	if err := fn(w, r); err != nil {
+		logrus.Errorf("%s %s error %v", r.Method, r.URL.Path, err)
+		writeJSON(w, errorStatus(err), &client.ErrorResponse{Message: err.Error()})
+	}
+}
+
+// errorStatus 根据错误类型返回状态码
+func errorStatus(err error) int {
+	var badRequest badRequestError
+	switch {
+	case errors.As(err, &badRequest), client.IsInvalidParameter(err):
+		return http.StatusBadRequest
+	case client.IsNotFound(err):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("write response error %v", err)
+	}
+}
+
+// decodeBody 解析请求体
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequestError{errors.Wrap(err, "decode request body failed")}
+	}
+	return nil
+}
+
+func (d *daemon) ping(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := w.Write([]byte("OK"))
+	return err
+}
+
+func (d *daemon) listContainers(w http.ResponseWriter, r *http.Request) error {
+	infos, err := d.client.List()
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, infos)
+	return nil
+}
+
+func (d *daemon) createContainer(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.CreateOptions{}
+	if err := decodeBody(r, opts); err != nil {
+		return err
+	}
+	containerId, err := d.client.Create(opts)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, &client.CreateResponse{Id: containerId})
+	return nil
+}
+
+func (d *daemon) inspectContainer(w http.ResponseWriter, r *http.Request) error {
+	info, err := d.client.Inspect(r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, info)
+	return nil
+}
+
+func (d *daemon) containerPort(w http.ResponseWriter, r *http.Request) error {
+	bindings, err := d.client.Port(r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, bindings)
+	return nil
+}
+
+func (d *daemon) startContainer(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.Start(r.PathValue("id")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) stopContainer(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.StopOptions{Timeout: client.DefaultStopTimeout}
+	if raw := r.URL.Query().Get("t"); raw != "" {
+		var err error
+		if opts.Timeout, err = strconv.Atoi(raw); err != nil {
+			return badRequestError{fmt.Errorf("invalid timeout %s", raw)}
+		}
+	}
+	if err := d.client.Stop(r.PathValue("id"), opts); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) killContainer(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.Kill(r.PathValue("id"), r.URL.Query().Get("signal")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) pauseContainer(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.Pause(r.PathValue("id")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) unpauseContainer(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.Unpause(r.PathValue("id")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) containerLogs(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.LogsOptions{}
+	if raw := r.URL.Query().Get("tail"); raw != "" {
+		var err error
+		if opts.Tail, err = strconv.Atoi(raw); err != nil {
+			return badRequestError{fmt.Errorf("invalid tail %s", raw)}
+		}
+	}
+	content, err := d.client.Logs(r.PathValue("id"), opts)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, err = w.Write(content)
+	return err
+}
+
+func (d *daemon) renameContainer(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.Rename(r.PathValue("id"), r.URL.Query().Get("name")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) updateContainer(w http.ResponseWriter, r *http.Request) error {
+	update := &subsystem.ResourceConfig{}
+	if err := decodeBody(r, update); err != nil {
+		return err
+	}
+	if err := d.client.Update(r.PathValue("id"), update); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) commitContainer(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	if err := d.client.Commit(query.Get("container"), query.Get("repo")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (d *daemon) removeContainer(w http.ResponseWriter, r *http.Request) error {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if err := d.client.Remove(r.PathValue("id"), &client.RemoveOptions{Force: force}); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) listNetworks(w http.ResponseWriter, r *http.Request) error {
+	networks, err := d.client.ListNetworks()
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, networks)
+	return nil
+}
+
+func (d *daemon) createNetwork(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.NetworkCreateOptions{}
+	if err := decodeBody(r, opts); err != nil {
+		return err
+	}
+	if err := d.client.CreateNetwork(opts); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (d *daemon) inspectNetwork(w http.ResponseWriter, r *http.Request) error {
+	result, err := d.client.InspectNetwork(r.PathValue("name"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, result)
+	return nil
+}
+
+func (d *daemon) removeNetwork(w http.ResponseWriter, r *http.Request) error {
+	if err := d.client.RemoveNetwork(r.PathValue("name")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) connectNetwork(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.NetworkConnectOptions{}
+	if err := decodeBody(r, opts); err != nil {
+		return err
+	}
+	if err := d.client.ConnectNetwork(r.PathValue("name"), opts); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) disconnectNetwork(w http.ResponseWriter, r *http.Request) error {
+	opts := &client.NetworkConnectOptions{}
+	if err := decodeBody(r, opts); err != nil {
+		return err
+	}
+	if err := d.client.DisconnectNetwork(r.PathValue("name"), opts.Container); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) firewall(w http.ResponseWriter, r *http.Request) error {
+	info, err := d.client.Firewall()
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, info)
+	return nil
+}
+
+func (d *daemon) setFirewall(w http.ResponseWriter, r *http.Request) error {
+	opts := &network.FirewallInfo{}
+	if err := decodeBody(r, opts); err != nil {
+		return err
+	}
+	if err := d.client.SetFirewall(opts.Backend); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (d *daemon) listImages(w http.ResponseWriter, r *http.Request) error {
+	images, err := d.client.ListImages()
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, images)
+	return nil
+}
+
+func (d *daemon) inspectImage(w http.ResponseWriter, r *http.Request) error {
+	image, err := d.client.InspectImage(r.PathValue("name"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, image)
+	return nil
+}
+
+// events 以每行一个 JSON 的格式持续推送事件，直到客户端断开或者到达 until 指定的时间
+func (d *daemon) events(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	now := time.Now()
+	opts := &client.EventsOptions{}
+	var err error
+	if opts.Since, err = events.ParseTime(query.Get("since"), now); err != nil {
+		return badRequestError{err}
+	}
+	if opts.Until, err = events.ParseTime(query.Get("until"), now); err != nil {
+		return badRequestError{err}
+	}
+	if opts.Filter, err = events.ParseFilter(query["filters"]); err != nil {
+		return badRequestError{err}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(w)
+	err = d.client.Events(r.Context(), opts, func(event *events.Event) error {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	// 已经开始返回事件，无法再修改状态码，只记录错误
+	if err != nil {
+		logrus.Warnf("stream events error %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/client"
+)
+
+func TestDaemonClient(t *testing.T) {
+	socketPath := path.Join(t.TempDir(), "tiny-docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: newDaemon().routes()}
+	go server.Serve(listener)
+	defer server.Close()
+
+	api, err := client.NewDaemonClient(client.UnixSchema + socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = api.List(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不存在的容器返回 404 以及 daemon 的错误信息
+	_, err = api.Inspect("not-exist")
+	if !client.IsNotFound(err) || !strings.Contains(err.Error(), "not-exist") {
+		t.Fatalf("expect not exist error, got %v", err)
+	}
+	// 参数错误在创建容器前返回
+	_, err = api.Create(&client.CreateOptions{Image: "busybox"})
+	if !client.IsInvalidParameter(err) {
+		t.Fatalf("create container without command should fail with invalid parameter, got %v", err)
+	}
+	t.Logf("create container error: %v", err)
+	// update 和 commit 同样通过 daemon 执行
+	if err = api.Update("not-exist", &subsystem.ResourceConfig{MemoryLimit: "100m"}); !client.IsNotFound(err) {
+		t.Fatalf("update not exist container should return not found, got %v", err)
+	}
+	if err = api.Commit("not-exist", "testimage"); !client.IsNotFound(err) {
+		t.Fatalf("commit not exist container should return not found, got %v", err)
+	}
+}
+
+func TestContainerLocks(t *testing.T) {
+	locks := &containerLocks{locks: make(map[string]*containerLock)}
+	unlock := locks.lock("not-exist-a")
+	// 其他容器的锁不受影响
+	locks.lock("not-exist-b")()
+
+	acquired, released := make(chan struct{}), make(chan struct{})
+	go func() {
+		unlock := locks.lock("not-exist-a")
+		close(acquired)
+		unlock()
+		close(released)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("same container should not be locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock should be acquired after unlock")
+	}
+	<-released
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.locks) != 0 {
+		t.Fatalf("unused container locks should be deleted, got %v", locks.locks)
+	}
+}
+
+func TestNewDaemonClient(t *testing.T) {
+	for _, host := range []string{"tcp://127.0.0.1:2375", "unix://", "/run/tiny-docker.sock"} {
+		if _, err := client.NewDaemonClient(host); err == nil {
+			t.Fatalf("host %s should not be supported", host)
+		}
+	}
+}
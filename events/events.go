@@ -0,0 +1,148 @@
+// Package events 记录容器、网络和镜像的生命周期事件
+/*
+事件以 JSON 格式逐行追加到 LogFile 中，任何执行容器操作的进程（命令行、supervisor、daemon）都直接写入这个文件，
+读取时按时间和过滤条件筛选，并可以像 tail -f 一样持续读取新的事件。
+日志超过 maxLogSize 后只保留最近的一半，通过临时文件 rename 替换，读取者发现文件被替换后从新文件继续读取。
+*/
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LogFile 事件日志，每行一个 JSON 格式的事件
+const LogFile = "/var/lib/tiny-docker/events.log"
+
+// maxLogSize 事件日志的最大大小，超过后丢弃较早的事件
+var maxLogSize int64 = 4 << 20
+
+// 事件对象的类型
+const (
+	TypeContainer = "container"
+	TypeNetwork   = "network"
+	TypeImage     = "image"
+)
+
+// 事件的动作
+const (
+	ActionCreate     = "create"
+	ActionStart      = "start"
+	ActionDie        = "die"
+	ActionOOM        = "oom"
+	ActionStop       = "stop"
+	ActionDestroy    = "destroy"
+	ActionRename     = "rename"
+	ActionConnect    = "connect"
+	ActionDisconnect = "disconnect"
+	ActionCommit     = "commit"
+)
+
+// Event 一条生命周期事件
+type Event struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	// Id 容器为容器id，网络为网络名，镜像为镜像名
+	Id         string            `json:"id"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Time       int64             `json:"time"`     // unix 时间戳，单位秒
+	TimeNano   int64             `json:"timeNano"` // unix 时间戳，单位纳秒
+}
+
+// Log 记录一条事件，写入失败只打印日志，不影响触发事件的操作
+func Log(eventType, action, id string, attributes map[string]string) {
+	event := &Event{
+		Type:       eventType,
+		Action:     action,
+		Id:         id,
+		Attributes: attributes,
+	}
+	if err := appendEvent(LogFile, event); err != nil {
+		logrus.Warnf("record %s %s event of %s error %v", eventType, action, id, err)
+	}
+}
+
+// appendEvent 在文件锁的保护下将事件追加到日志文件末尾，日志过大时截断
+// 事件时间为空时在加锁后记录，保证日志中事件的时间按写入顺序递增，读取者依赖这一点跳过替换前已经读过的事件
+func appendEvent(logFile string, event *Event) error {
+	if err := os.MkdirAll(path.Dir(logFile), constant.Perm0755); err != nil {
+		return errors.Wrapf(err, "mkdir %s failed", path.Dir(logFile))
+	}
+	// 截断时通过 rename 替换日志，因此使用单独的锁文件
+	lockPath := logFile + ".lock"
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, constant.Perm0644)
+	if err != nil {
+		return errors.Wrapf(err, "open lock file %s failed", lockPath)
+	}
+	defer lockFile.Close()
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrapf(err, "lock %s failed", lockPath)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	if event.TimeNano == 0 {
+		now := time.Now()
+		event.Time = now.Unix()
+		event.TimeNano = now.UnixNano()
+	}
+	content, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "marshal event failed")
+	}
+	file, err := os.OpenFile(logFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, constant.Perm0644)
+	if err != nil {
+		return errors.Wrapf(err, "open %s failed", logFile)
+	}
+	defer file.Close()
+	if _, err = file.Write(append(content, '\n')); err != nil {
+		return errors.Wrapf(err, "write %s failed", logFile)
+	}
+	return trimLog(file, logFile)
+}
+
+// trimLog 日志超过 maxLogSize 时只保留最后 maxLogSize/2 字节内完整的事件，写入临时文件后 rename 替换日志
+// 调用者需要持有日志的文件锁
+func trimLog(file *os.File, logFile string) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "stat %s failed", logFile)
+	}
+	if stat.Size() <= maxLogSize {
+		return nil
+	}
+	keep := maxLogSize / 2
+	content := make([]byte, keep)
+	if _, err = file.ReadAt(content, stat.Size()-keep); err != nil && err != io.EOF {
+		return errors.Wrapf(err, "read %s failed", logFile)
+	}
+	// 丢弃开头不完整的一行
+	for i, b := range content {
+		if b == '\n' {
+			content = content[i+1:]
+			break
+		}
+	}
+
+	tmpPath := logFile + ".tmp"
+	if err = os.WriteFile(tmpPath, content, constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", tmpPath)
+	}
+	if err = os.Rename(tmpPath, logFile); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "rename %s to %s failed", tmpPath, logFile)
+	}
+	return nil
+}
+
+// Timestamp 返回事件发生的时间
+func (e *Event) Timestamp() time.Time {
+	return time.Unix(0, e.TimeNano)
+}
@@ -0,0 +1,205 @@
+package events
+
+import (
+	"context"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	die := &Event{Type: TypeContainer, Action: ActionDie, Id: "1234567890abcdef", Attributes: map[string]string{"name": "web", "image": "busybox"}}
+	connect := &Event{Type: TypeNetwork, Action: ActionConnect, Id: "testbr", Attributes: map[string]string{"container": "1234567890abcdef"}}
+	commit := &Event{Type: TypeImage, Action: ActionCommit, Id: "myimage", Attributes: map[string]string{"container": "1234567890"}}
+	cases := []struct {
+		filter []string
+		event  *Event
+		match  bool
+	}{
+		{nil, die, true},
+		{[]string{"type=container", "event=die"}, die, true},
+		{[]string{"event=start", "event=die"}, die, true},
+		{[]string{"type=container", "event=start"}, die, false},
+		{[]string{"container=web"}, die, true},
+		{[]string{"container=1234567890abcdef"}, connect, true},
+		{[]string{"container=1234567890ab"}, die, true},
+		{[]string{"container=1234567890ab"}, connect, true},
+		{[]string{"container=123"}, die, false},
+		{[]string{"container=other"}, connect, false},
+		{[]string{"network=testbr"}, connect, true},
+		{[]string{"network=testbr"}, die, false},
+		{[]string{"image=busybox"}, die, true},
+		{[]string{"image=myimage", "type=image"}, commit, true},
+	}
+	for _, c := range cases {
+		filter, err := ParseFilter(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filter.Match(c.event) != c.match {
+			t.Fatalf("filter %v match %+v should be %v", c.filter, *c.event, c.match)
+		}
+	}
+	for _, arg := range []string{"type", "type=", "label=a=b"} {
+		if _, err := ParseFilter([]string{arg}); err == nil {
+			t.Fatalf("filter %s should be invalid", arg)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"10m", now.Add(-10 * time.Minute)},
+		{"1714564800", time.Unix(1714564800, 0)},
+		{"1714564800.5", time.Unix(1714564800, 500000000)},
+		{FormatTimestamp(now), now},
+		{"2024-05-01T12:00:00Z", now},
+	}
+	for _, c := range cases {
+		got, err := ParseTime(c.value, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(c.want) {
+			t.Fatalf("parse time %s, want %v, got %v", c.value, c.want, got)
+		}
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Fatalf("time yesterday should be invalid")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	logFile := path.Join(t.TempDir(), "events.log")
+	start := time.Now()
+	for _, action := range []string{ActionCreate, ActionStart, ActionDie} {
+		now := time.Now()
+		event := &Event{Type: TypeContainer, Action: action, Id: "1234567890", Time: now.Unix(), TimeNano: now.UnixNano()}
+		if err := appendEvent(logFile, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// until 已经过去时只读取历史事件
+	filter, _ := ParseFilter([]string{"event=start", "event=die"})
+	var actions []string
+	err := watchFile(context.Background(), logFile, start, time.Now(), filter, func(event *Event) error {
+		actions = append(actions, event.Action)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0] != ActionStart || actions[1] != ActionDie {
+		t.Fatalf("expect start and die events, got %v", actions)
+	}
+
+	// 未指定 until 时持续读取新写入的事件
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan *Event, 1)
+	go func() {
+		_ = watchFile(ctx, logFile, time.Now(), time.Time{}, Filter{}, func(event *Event) error {
+			received <- event
+			return nil
+		})
+	}()
+	time.Sleep(2 * pollInterval)
+	now := time.Now()
+	if err = appendEvent(logFile, &Event{Type: TypeContainer, Action: ActionDestroy, Id: "1234567890", Time: now.Unix(), TimeNano: now.UnixNano()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-received:
+		t.Logf("follow event %+v", *event)
+		if event.Action != ActionDestroy {
+			t.Fatalf("expect destroy event, got %s", event.Action)
+		}
+	case <-ctx.Done():
+		t.Fatalf("new event was not received")
+	}
+}
+
+func TestTrimLog(t *testing.T) {
+	defer func(size int64) { maxLogSize = size }(maxLogSize)
+	maxLogSize = 1024
+	logFile := path.Join(t.TempDir(), "events.log")
+	for i := 0; i < 100; i++ {
+		if err := appendEvent(logFile, &Event{Type: TypeContainer, Action: ActionStart, Id: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat, err := os.Stat(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() > maxLogSize {
+		t.Fatalf("log size %d exceeds %d", stat.Size(), maxLogSize)
+	}
+
+	// 截断后的日志只包含完整的事件，且保留了最新的事件
+	var ids []string
+	err = watchFile(context.Background(), logFile, time.Time{}, time.Now(), Filter{}, func(event *Event) error {
+		ids = append(ids, event.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) == 0 || ids[len(ids)-1] != "99" {
+		t.Fatalf("expect latest events kept, got %v", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		prev, _ := strconv.Atoi(ids[i-1])
+		cur, _ := strconv.Atoi(ids[i])
+		if cur != prev+1 {
+			t.Fatalf("events after trim are not continuous: %v", ids)
+		}
+	}
+}
+
+func TestWatchTrimmedLog(t *testing.T) {
+	defer func(size int64) { maxLogSize = size }(maxLogSize)
+	maxLogSize = 4096
+	logFile := path.Join(t.TempDir(), "events.log")
+	if err := appendEvent(logFile, &Event{Type: TypeContainer, Action: ActionCreate, Id: "0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 持续读取时日志被多次替换，每次读取之间写入的事件不超过保留的大小时，新事件不能丢失也不能重复
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	received := make(chan string, 100)
+	go func() {
+		_ = watchFile(ctx, logFile, time.Now(), time.Time{}, Filter{}, func(event *Event) error {
+			received <- event.Id
+			return nil
+		})
+	}()
+	time.Sleep(2 * pollInterval)
+	for i := 1; i <= 60; i++ {
+		if err := appendEvent(logFile, &Event{Type: TypeContainer, Action: ActionStart, Id: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 0 {
+			time.Sleep(2 * pollInterval)
+		}
+	}
+	for i := 1; i <= 60; i++ {
+		select {
+		case id := <-received:
+			if id != strconv.Itoa(i) {
+				t.Fatalf("expect event %d, got %s", i, id)
+			}
+		case <-ctx.Done():
+			t.Fatalf("event %d was not received", i)
+		}
+	}
+}
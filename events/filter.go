@@ -0,0 +1,163 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+)
+
+// 支持的过滤条件
+const (
+	filterType      = "type"
+	filterEvent     = "event"
+	filterContainer = "container"
+	filterNetwork   = "network"
+	filterImage     = "image"
+)
+
+// Filter 事件的过滤条件，key 为过滤条件名，同一个条件的多个值满足其一即可，不同条件需要同时满足
+type Filter map[string][]string
+
+// ParseFilter 解析 key=value 格式的过滤条件
+func ParseFilter(args []string) (Filter, error) {
+	filter := make(Filter)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid filter %s, must be key=value", arg)
+		}
+		switch key {
+		case filterType, filterEvent, filterContainer, filterNetwork, filterImage:
+		default:
+			return nil, fmt.Errorf("unsupported filter %s, must be one of type, event, container, network, image", key)
+		}
+		filter[key] = append(filter[key], value)
+	}
+	return filter, nil
+}
+
+// Args 将过滤条件转换为 key=value 格式
+func (f Filter) Args() []string {
+	args := make([]string, 0, len(f))
+	for key, values := range f {
+		for _, value := range values {
+			args = append(args, key+"="+value)
+		}
+	}
+	return args
+}
+
+// ResolveContainers 将 container 过滤条件中的容器名和容器id前缀解析为完整的容器id
+// 原来的值同样保留，已经删除的容器无法解析，仍然可以通过事件中记录的容器名或id前缀匹配
+func (f Filter) ResolveContainers() {
+	values := f[filterContainer]
+	for _, value := range values {
+		if containerId, err := container.ResolveID(value); err == nil && containerId != value {
+			f[filterContainer] = append(f[filterContainer], containerId)
+		}
+	}
+}
+
+// Match 判断事件是否满足所有过滤条件
+func (f Filter) Match(event *Event) bool {
+	for key, values := range f {
+		matched := false
+		for _, value := range values {
+			if f.matchOne(key, value, event) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) matchOne(key, value string, event *Event) bool {
+	switch key {
+	case filterType:
+		return event.Type == value
+	case filterEvent:
+		return event.Action == value
+	case filterContainer:
+		// 容器连接网络等事件通过 container 属性关联容器
+		if event.Type == TypeContainer && (matchContainerID(event.Id, value) || event.Attributes["name"] == value) {
+			return true
+		}
+		return matchContainerID(event.Attributes["container"], value)
+	case filterNetwork:
+		return event.Type == TypeNetwork && event.Id == value
+	case filterImage:
+		if event.Type == TypeImage && event.Id == value {
+			return true
+		}
+		return event.Type == TypeContainer && event.Attributes["image"] == value
+	default:
+		return false
+	}
+}
+
+// matchContainerID 判断事件中的容器id是否与过滤值相同，或者以不短于 ps 显示的短id的过滤值为前缀
+// 过短的前缀可能与容器名混淆，需要先通过 ResolveContainers 解析
+func matchContainerID(containerId, value string) bool {
+	if containerId == "" {
+		return false
+	}
+	if containerId == value {
+		return true
+	}
+	return len(value) >= container.ShortIDLength && strings.HasPrefix(containerId, value)
+}
+
+// ParseTime 解析 --since 和 --until 指定的时间
+// 支持 unix 时间戳（可以带小数部分）、RFC3339、容器信息中的时间格式，以及相对于 now 的时长，例如 10m 表示 10 分钟前
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	sec, nsec, _ := strings.Cut(value, ".")
+	if t, err := parseTimestamp(sec, nsec); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{container.TimeFormat, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s, must be a timestamp, RFC3339 time or duration", value)
+}
+
+// FormatTimestamp 将时间格式化为 ParseTime 能够解析的 unix 时间戳
+func FormatTimestamp(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// parseTimestamp 解析 seconds.nanoseconds 格式的时间戳
+func parseTimestamp(sec, nsec string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nanos int64
+	if nsec != "" {
+		if len(nsec) > 9 {
+			return time.Time{}, fmt.Errorf("invalid timestamp %s.%s", sec, nsec)
+		}
+		// 小数部分按纳秒补齐，例如 .5 表示 500000000 纳秒
+		if nanos, err = strconv.ParseInt(nsec+strings.Repeat("0", 9-len(nsec)), 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(seconds, nanos), nil
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// pollInterval 读取到日志末尾后检查新事件的间隔
+const pollInterval = 200 * time.Millisecond
+
+// Watch 读取 since 之后满足 filter 的事件并依次调用 fn
+// until 为零值时像 tail -f 一样持续读取新写入的事件，直到 ctx 取消或 fn 返回错误，否则读取到 until 为止
+// 两次读取之间写入的事件超过 maxLogSize/2 时，日志截断会丢弃其中较早的事件
+func Watch(ctx context.Context, since, until time.Time, filter Filter, fn func(*Event) error) error {
+	return watchFile(ctx, LogFile, since, until, filter, fn)
+}
+
+func watchFile(ctx context.Context, logFile string, since, until time.Time, filter Filter, fn func(*Event) error) error {
+	file, err := openLog(ctx, logFile, until)
+	if err != nil || file == nil {
+		return err
+	}
+	// 日志被替换后 file 会指向新文件
+	defer func() {
+		file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	// 写入者可能还没有写完一行，先保存已经读取的部分
+	var partial []byte
+	// last 为最后读取的事件时间，replaced 表示日志已经被截断替换，seen 之前的事件在替换前已经读取过
+	var last, seen int64
+	replaced := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			event := &Event{}
+			if err = json.Unmarshal(partial, event); err != nil {
+				logrus.Debugf("skip invalid event %s", partial)
+				partial = nil
+				continue
+			}
+			partial = nil
+			if event.TimeNano <= seen {
+				continue
+			}
+			last = event.TimeNano
+			timestamp := event.Timestamp()
+			if !since.IsZero() && timestamp.Before(since) {
+				continue
+			}
+			if !until.IsZero() && timestamp.After(until) {
+				return nil
+			}
+			if filter.Match(event) {
+				if err = fn(event); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			return errors.Wrapf(err, "read %s failed", logFile)
+		}
+		// 旧文件在 rename 之前已经写完，发现被替换后再读一次旧文件的剩余内容，然后从新文件开头继续读取
+		if replaced {
+			newFile, err := os.Open(logFile)
+			if err != nil {
+				return errors.Wrapf(err, "open %s failed", logFile)
+			}
+			file.Close()
+			file = newFile
+			reader.Reset(file)
+			partial = nil
+			seen = last
+			replaced = false
+			continue
+		}
+		if replaced, err = isReplaced(file, logFile); err != nil {
+			return err
+		}
+		if replaced {
+			continue
+		}
+		// 已经读到末尾，等待新的事件
+		if !until.IsZero() && !time.Now().Before(until) {
+			return nil
+		}
+		if !sleep(ctx) {
+			return nil
+		}
+	}
+}
+
+// isReplaced 判断打开的日志是否已经被截断后的新文件替换
+func isReplaced(file *os.File, logFile string) (bool, error) {
+	current, err := os.Stat(logFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "stat %s failed", logFile)
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return false, errors.Wrapf(err, "stat %s failed", logFile)
+	}
+	return !os.SameFile(current, opened), nil
+}
+
+// openLog 打开事件日志，日志还不存在时等待第一条事件写入，等待结束时返回 nil
+func openLog(ctx context.Context, logFile string, until time.Time) (*os.File, error) {
+	for {
+		file, err := os.Open(logFile)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "open %s failed", logFile)
+		}
+		if !until.IsZero() && !time.Now().Before(until) {
+			return nil, nil
+		}
+		if !sleep(ctx) {
+			return nil, nil
+		}
+	}
+}
+
+// sleep 等待 pollInterval，ctx 取消时返回 false
+func sleep(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(pollInterval):
+		return true
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// formatFlag inspect 命令的 --format 参数
+var formatFlag = &cli.StringFlag{
+	Name:  "format",
+	Usage: "format the output using the given go template,e.g. -format '{{.Name}}'",
+}
+
+// templateFuncs --format 模板中可以使用的函数
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// printInspect 打印 inspect 的结果，format 为空时以 JSON 数组输出，否则每个对象按 Go 模板输出一行，模板中使用结构体的字段名，如 {{.GraphDriver.MergedDir}}
+func printInspect(w io.Writer, objects []any, format string) error {
+	if format == "" {
+		content, err := json.MarshalIndent(objects, "", "    ")
+		if err != nil {
+			return errors.Wrap(err, "marshal inspect result failed")
+		}
+		_, err = fmt.Fprintln(w, string(content))
+		return err
+	}
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return errors.Wrapf(err, "parse format %s failed", format)
+	}
+	for _, object := range objects {
+		buf := &bytes.Buffer{}
+		if err = tmpl.Execute(buf, object); err != nil {
+			return errors.Wrap(err, "execute format template failed")
+		}
+		if _, err = fmt.Fprintln(w, buf.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
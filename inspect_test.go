@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintInspect(t *testing.T) {
+	type object struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	}
+	objects := []any{
+		&object{Name: "a", Labels: map[string]string{"k": "v"}},
+		&object{Name: "b"},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"{{.Name}}", "a\nb\n"},
+		{"{{json .Labels}}", "{\"k\":\"v\"}\nnull\n"},
+		{"{{upper .Name}}", "A\nB\n"},
+		{"", "[\n    {\n        \"name\": \"a\",\n        \"labels\": {\n            \"k\": \"v\"\n        }\n    },\n    {\n        \"name\": \"b\",\n        \"labels\": null\n    }\n]\n"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		if err := printInspect(buf, objects, test.format); err != nil {
+			t.Fatalf("printInspect(%q) error %v", test.format, err)
+		}
+		if buf.String() != test.want {
+			t.Fatalf("printInspect(%q) = %q, want %q", test.format, buf.String(), test.want)
+		}
+	}
+
+	if err := printInspect(&bytes.Buffer{}, objects, "{{.Name"); err == nil {
+		t.Fatalf("printInspect with invalid template should fail")
+	}
+	if err := printInspect(&bytes.Buffer{}, objects, "{{.Missing}}"); err == nil {
+		t.Fatalf("printInspect with unknown field should fail")
+	}
+}
@@ -4,44 +4,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path"
+	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// ListContainerInfos 打印容器日志信息
-func ListContainerInfos() {
-	// 读取存放容器信息目录下的所有文件
-	files, err := os.ReadDir(container.InfoLoc)
-	if err != nil {
-		logrus.Errorf("read dir %s error %v", container.InfoLoc, err)
-		return
-	}
-	containers := make([]*container.Info, 0, len(files))
-	for _, file := range files {
-		tmpContainer, err := getContainerInfo(file)
-		if err != nil {
-			logrus.Errorf("get container info error %v", err)
-			continue
-		}
-		containers = append(containers, tmpContainer)
-	}
+// printContainers 以表格形式打印容器信息
+func printContainers(containers []*container.Info) {
 	// 使用tabwriter.NewWriter在控制台打印出容器信息
 	// tabwriter 是引用的text/tabwriter类库，用于在控制台打印对齐的表格
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	_, err = fmt.Fprint(w, "ID\tNAME\tPID\tIP\tSTATUS\tCOMMAND\tCREATED\n")
+	_, err := fmt.Fprint(w, "ID\tNAME\tPID\tIP\tSTATUS\tCOMMAND\tCREATED\n")
 	if err != nil {
 		logrus.Errorf("Fprint error %v", err)
 	}
 	for _, item := range containers {
 		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-			item.Id,
+			container.ShortID(item.Id),
 			item.Name,
-			item.IP,
 			item.Pid,
-			item.Status,
+			strings.Join(item.IPAddresses(), ","),
+			item.StatusDescription(),
 			item.Command,
 			item.CreatedTime)
 		if err != nil {
@@ -53,21 +43,41 @@ func ListContainerInfos() {
 	}
 }
 
-func getContainerInfo(file os.DirEntry) (*container.Info, error) {
-	// 根据文件名拼接出完整路径
-	configFileDir := fmt.Sprintf(container.InfoLocFormat, file.Name())
-	configFileDir = path.Join(configFileDir, container.ConfigName)
-	// 读取文件
-	content, err := os.ReadFile(configFileDir)
-	if err != nil {
-		logrus.Errorf("read file %s error %v", configFileDir, err)
-		return nil, err
+// printImages 以表格形式打印镜像信息
+func printImages(images []*container.Image) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "NAME\tSIZE\tCREATED\n")
+	for _, image := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Name, utils.HumanSize(uint64(image.Size)), image.Created)
 	}
-	info := new(container.Info)
-	err = json.Unmarshal(content, info)
-	if err != nil {
-		logrus.Error("info json unmarshal error ", err)
-		return nil, err
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Flush error %v", err)
+	}
+}
+
+// printEvent 打印一条事件，format 为 json 时输出 JSON，否则输出 时间 类型 动作 id (属性)
+func printEvent(event *events.Event, format string) error {
+	if format == formatJson {
+		content, err := json.Marshal(event)
+		if err != nil {
+			return errors.Wrap(err, "marshal event failed")
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(content))
+		return err
+	}
+	keys := make([]string, 0, len(event.Attributes))
+	for key := range event.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, key+"="+event.Attributes[key])
+	}
+	line := fmt.Sprintf("%s %s %s %s", event.Timestamp().Format(time.RFC3339Nano), event.Type, event.Action, event.Id)
+	if len(attrs) > 0 {
+		line += " (" + strings.Join(attrs, ", ") + ")"
 	}
-	return info, nil
+	_, err := fmt.Fprintln(os.Stdout, line)
+	return err
 }
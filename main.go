@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 
+	// setns 包中的 C 代码会在 tiny-docker exec 启动时进入容器的 namespace
+	_ "github.com/ChenMiaoQiu/tiny-docker/setns"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
@@ -16,6 +18,14 @@ func main() {
 	app := &cli.App{
 		Name:  "tinydocker",
 		Usage: usage,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "host",
+				Aliases: []string{"H"},
+				Usage:   "daemon socket to connect to, commands run locally if not set,e.g. -host unix:///run/tiny-docker.sock",
+				EnvVars: []string{"TINY_DOCKER_HOST"},
+			},
+		},
 		Before: func(ctx *cli.Context) error {
 			logrus.SetFormatter(&logrus.JSONFormatter{})
 
@@ -25,13 +35,29 @@ func main() {
 		Commands: []*cli.Command{
 			&initCommand,
 			&runCommand,
+			&createCommand,
+			&startCommand,
+			&superviseCommand,
+			&dnsServerCommand,
+			&daemonCommand,
 			&commitCommand,
 			&listCommand,
 			&logCommand,
 			&execCommand,
 			&stopCommand,
+			&killCommand,
+			&pauseCommand,
+			&unpauseCommand,
+			&statsCommand,
+			&updateCommand,
 			&removeCommand,
+			&renameCommand,
 			&networkCommand,
+			&imagesCommand,
+			&imageCommand,
+			&inspectCommand,
+			&portCommand,
+			&eventsCommand,
 		},
 	}
 
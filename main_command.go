@@ -3,19 +3,166 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ChenMiaoQiu/tiny-docker/cgroups/subsystem"
+	"github.com/ChenMiaoQiu/tiny-docker/client"
 	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
 	"github.com/ChenMiaoQiu/tiny-docker/network"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
+// containerFlags run 和 create 共用的容器配置参数
+var containerFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "init",
+		Usage: "run an init inside the container that forwards signals and reaps processes",
+	},
+	&cli.StringFlag{
+		Name:  "mem",
+		Usage: "memory limit,e.g.: -mem 100m", // 限制内存使用率
+	},
+	&cli.IntFlag{
+		Name:  "cpu",
+		Usage: "cpu quota,e.g.: -cpu 100", // 限制进程 cpu 使用率
+	},
+	&cli.StringFlag{
+		Name:  "cpuset",
+		Usage: "cpuset limit,e.g.: -cpuset 2,4", // 限制进程 cpu 使用率
+	},
+	&cli.Float64Flag{
+		Name:  "cpus",
+		Usage: "number of cpus,e.g.: -cpus 1.5", // 限制进程可以使用的 cpu 核数
+	},
+	&cli.IntFlag{
+		Name:  "cpu-shares",
+		Usage: "cpu shares (relative weight),e.g.: -cpu-shares 512",
+	},
+	&cli.StringFlag{
+		Name:  "memory-swap",
+		Usage: "total memory plus swap limit, -1 means unlimited,e.g.: -memory-swap 200m",
+	},
+	&cli.StringFlag{
+		Name:  "memory-reservation",
+		Usage: "memory soft limit,e.g.: -memory-reservation 50m",
+	},
+	&cli.IntFlag{
+		Name:  "pids-limit",
+		Usage: "container pids limit, -1 means unlimited,e.g.: -pids-limit 100",
+	},
+	&cli.IntFlag{
+		Name:  "blkio-weight",
+		Usage: "block io relative weight, between 10 and 1000,e.g.: -blkio-weight 500",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-read-bps",
+		Usage: "limit read rate (bytes per second) from a device,e.g.: -device-read-bps /dev/sda:1048576",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-write-bps",
+		Usage: "limit write rate (bytes per second) to a device,e.g.: -device-write-bps /dev/sda:1048576",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-read-iops",
+		Usage: "limit read rate (IO per second) from a device,e.g.: -device-read-iops /dev/sda:1000",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-write-iops",
+		Usage: "limit write rate (IO per second) to a device,e.g.: -device-write-iops /dev/sda:1000",
+	},
+	&cli.StringFlag{
+		Name:  "v",
+		Usage: "volume,e.g.: -v /etc/conf:/etc/conf",
+	},
+	&cli.StringFlag{
+		Name:  "name",
+		Usage: "container name, e.g.: -name containerName",
+	},
+	&cli.StringSliceFlag{
+		Name:  "e",
+		Usage: "set environment,e.g. -e name=mydocker",
+	},
+	&cli.StringFlag{
+		Name:  "net",
+		Usage: "set container network or namespace mode(host, none, container:<id|name>), e.g. -net testbr",
+	},
+	&cli.StringSliceFlag{
+		Name:  "network-alias",
+		Usage: "add a name other containers on the same network can resolve this container by, e.g. -network-alias db",
+	},
+	&cli.StringFlag{
+		Name:  "pid",
+		Usage: "set pid namespace mode(host, none, container:<id|name>), e.g. -pid host",
+	},
+	&cli.StringFlag{
+		Name:  "ipc",
+		Usage: "set ipc namespace mode(host, none, container:<id|name>), e.g. -ipc container:123456",
+	},
+	&cli.StringFlag{
+		Name:  "uts",
+		Usage: "set uts namespace mode(host, none, container:<id|name>), e.g. -uts host",
+	},
+	&cli.StringSliceFlag{
+		Name:  "p",
+		Usage: "publish container ports to the host, [hostIP:]hostPort[-end]:containerPort[-end][/tcp|udp|sctp], random host port if omitted,e.g. -p 8080:80 -p 127.0.0.1:5353:53/udp -p 8000-8010:8000-8010",
+	},
+	&cli.BoolFlag{
+		Name:    "publish-all",
+		Aliases: []string{"P"},
+		Usage:   "publish all exposed ports to random host ports",
+	},
+	&cli.StringSliceFlag{
+		Name:  "expose",
+		Usage: "expose a port or a range of ports, published by -P,e.g. -expose 80 -expose 5000-5010/udp",
+	},
+	&cli.StringFlag{
+		Name:  "stop-signal",
+		Usage: "signal to stop the container, default is the image's StopSignal or SIGTERM, e.g. -stop-signal SIGQUIT",
+	},
+	&cli.StringSliceFlag{
+		Name:  "ulimit",
+		Usage: "set ulimit for container process,e.g. -ulimit nofile=1024:2048",
+	},
+	&cli.StringSliceFlag{
+		Name:  "sysctl",
+		Usage: "set namespaced kernel parameter,e.g. -sysctl net.core.somaxconn=1024",
+	},
+	&cli.BoolFlag{
+		Name:  "oom-kill-disable",
+		Usage: "disable OOM killer for the container, processes wait for free memory instead of being killed",
+	},
+	&cli.IntFlag{
+		Name:  "oom-score-adj",
+		Usage: "tune container's OOM preferences (-1000 to 1000),e.g.: -oom-score-adj 500",
+	},
+}
+
+// getAPI 指定了 --host 时通过 daemon 执行命令，否则直接在本地执行
+func getAPI(ctx *cli.Context) (client.API, error) {
+	host := ctx.String("host")
+	if host == "" {
+		return localClient(), nil
+	}
+	return client.NewDaemonClient(host)
+}
+
+// localClient 返回在本地执行的客户端，init、supervisor 和 exec 进程通过 /proc/self/exe 启动
+func localClient() *client.Client {
+	return client.New(client.Config{})
+}
+
 var runCommand = cli.Command{
 	Name: "run",
 	Usage: `Create a container with namespace and cgroups limit
 			mydocker run -it [imageName] [command]`,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.BoolFlag{
 			Name:  "it",
 			Usage: "enable tty",
@@ -24,82 +171,359 @@ var runCommand = cli.Command{
 			Name:  "d",
 			Usage: "detach container",
 		},
+	}, containerFlags...),
+	Action: func(ctx *cli.Context) error {
+		tty := ctx.Bool("it")
+		detach := ctx.Bool("d")
+		// tty 和 detach只能生效一个
+		if tty && detach {
+			return fmt.Errorf("it and d paramter can not both provided")
+		}
+		opts, err := createOptionsFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		opts.Tty = tty
+		if err = opts.Validate(); err != nil {
+			return err
+		}
+		if !tty && !detach {
+			return nil
+		}
+
+		if tty {
+			if ctx.String("host") != "" {
+				return fmt.Errorf("it paramter is not supported when running through daemon")
+			}
+			return localClient().Run(opts)
+		}
+		// 后台运行的容器交给 supervisor 进程启动，以便记录容器的退出状态
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		containerId, err := api.Create(opts)
+		if err != nil {
+			return err
+		}
+		if err = api.Start(containerId); err != nil {
+			return err
+		}
+		fmt.Println(containerId)
+		return nil
+	},
+}
+
+// createOptionsFromContext 根据命令行参数构建创建容器的参数
+func createOptionsFromContext(ctx *cli.Context) (*client.CreateOptions, error) {
+	if ctx.Args().Len() < 2 {
+		return nil, fmt.Errorf("missing imageName or container command")
+	}
+	// 构建资源控制器
+	limitConfig := &subsystem.ResourceConfig{
+		MemoryLimit:       ctx.String("mem"),
+		MemorySwap:        ctx.String("memory-swap"),
+		MemoryReservation: ctx.String("memory-reservation"),
+		CpuSet:            ctx.String("cpuset"),
+		CpuCfsQuota:       ctx.Int("cpu"),
+		Cpus:              ctx.Float64("cpus"),
+		PidsLimit:         ctx.Int("pids-limit"),
+		BlkioWeight:       ctx.Int("blkio-weight"),
+		DeviceReadBps:     ctx.StringSlice("device-read-bps"),
+		DeviceWriteBps:    ctx.StringSlice("device-write-bps"),
+		DeviceReadIOps:    ctx.StringSlice("device-read-iops"),
+		DeviceWriteIOps:   ctx.StringSlice("device-write-iops"),
+		OomKillDisable:    ctx.Bool("oom-kill-disable"),
+	}
+	if cpuShares := ctx.Int("cpu-shares"); cpuShares != 0 {
+		limitConfig.CpuShare = strconv.Itoa(cpuShares)
+	}
+
+	// --net 为 host、none、container:<id> 时表示 namespace 模式，其余情况表示网络名
+	network := ctx.String("net")
+	namespaces := &container.NamespaceConfig{
+		PidMode: ctx.String("pid"),
+		IpcMode: ctx.String("ipc"),
+		UtsMode: ctx.String("uts"),
+	}
+	if container.IsNamespaceMode(network) {
+		namespaces.NetMode = network
+		network = ""
+	}
+
+	return &client.CreateOptions{
+		Cmd:         ctx.Args().Slice()[1:],
+		Resources:   limitConfig,
+		Volume:      ctx.String("v"),
+		Name:        ctx.String("name"),
+		Image:       ctx.Args().Get(0),
+		Env:         ctx.StringSlice("e"),
+		Network:     network,
+		PortMapping: ctx.StringSlice("p"),
+		PublishAll:  ctx.Bool("publish-all"),
+		Expose:      ctx.StringSlice("expose"),
+		Aliases:     ctx.StringSlice("network-alias"),
+		Namespaces:  namespaces,
+		Init:        ctx.Bool("init"),
+		Ulimits:     ctx.StringSlice("ulimit"),
+		Sysctls:     ctx.StringSlice("sysctl"),
+		StopSignal:  ctx.String("stop-signal"),
+		OomScoreAdj: ctx.Int("oom-score-adj"),
+	}, nil
+}
+
+var createCommand = cli.Command{
+	Name:  "create",
+	Usage: "create a new container without starting it,e.g. tiny-docker create [imageName] [command]",
+	Flags: containerFlags,
+	Action: func(ctx *cli.Context) error {
+		opts, err := createOptionsFromContext(ctx)
+		if err != nil {
+			return err
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		containerId, err := api.Create(opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(containerId)
+		return nil
+	},
+}
+
+var startCommand = cli.Command{
+	Name:  "start",
+	Usage: "start a created container,e.g. tiny-docker start [containerId]",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Start(ctx.Args().Get(0))
+	},
+}
+
+// superviseCommand 由 start 内部调用，启动容器并等待容器退出
+var superviseCommand = cli.Command{
+	Name:   "supervise",
+	Usage:  "Supervise a created container until it exits. Do not call it outside",
+	Hidden: true,
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		return localClient().Supervise(ctx.Args().Get(0))
+	},
+}
+
+// dnsServerCommand 由创建网络和启动容器时内部调用，为网络提供内置 DNS
+var dnsServerCommand = cli.Command{
+	Name:   network.DNSServerCommand,
+	Usage:  "Serve embedded dns for a network. Do not call it outside",
+	Hidden: true,
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing network name")
+		}
+		return localClient().ServeDNS(ctx.Args().Get(0))
+	},
+}
+
+var daemonCommand = cli.Command{
+	Name:  "daemon",
+	Usage: "run tiny-docker daemon serving HTTP API on a unix socket,e.g. tiny-docker daemon -socket /run/tiny-docker.sock",
+	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:  "mem",
-			Usage: "memory limit,e.g.: -mem 100m", // 限制内存使用率
-		},
-		&cli.IntFlag{
-			Name:  "cpu",
-			Usage: "cpu quota,e.g.: -cpu 100", // 限制进程 cpu 使用率
-		},
-		&cli.StringFlag{
-			Name:  "cpuset",
-			Usage: "cpuset limit,e.g.: -cpuset 2,4", // 限制进程 cpu 使用率
+			Name:  "socket",
+			Usage: "unix socket path to listen on",
+			Value: defaultDaemonSocket,
 		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return runDaemon(ctx.String("socket"))
+	},
+}
+
+var imagesCommand = cli.Command{
+	Name:  "images",
+	Usage: "list images",
+	Action: func(ctx *cli.Context) error {
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		images, err := api.ListImages()
+		if err != nil {
+			return err
+		}
+		printImages(images)
+		return nil
+	},
+}
+
+var imageCommand = cli.Command{
+	Name:  "image",
+	Usage: "image commands",
+	Subcommands: []*cli.Command{
+		&imageInspectCommand,
+	},
+}
+
+var imageInspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information on one or more images,e.g. tiny-docker image inspect busybox",
+	Flags: []cli.Flag{formatFlag},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing image name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		images := make([]any, 0, ctx.Args().Len())
+		for _, name := range ctx.Args().Slice() {
+			image, err := api.InspectImage(name)
+			if err != nil {
+				return errors.WithMessagef(err, "inspect image %s failed", name)
+			}
+			images = append(images, image)
+		}
+		return printInspect(os.Stdout, images, ctx.String("format"))
+	},
+}
+
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information on one or more containers,e.g. tiny-docker inspect -format '{{.GraphDriver.MergedDir}}' 1234567890",
+	Flags: []cli.Flag{formatFlag},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		results := make([]any, 0, ctx.Args().Len())
+		for _, containerId := range ctx.Args().Slice() {
+			result, err := api.Inspect(containerId)
+			if err != nil {
+				return errors.WithMessagef(err, "inspect container %s failed", containerId)
+			}
+			results = append(results, result)
+		}
+		return printInspect(os.Stdout, results, ctx.String("format"))
+	},
+}
+
+var portCommand = cli.Command{
+	Name:  "port",
+	Usage: "list port mappings of a container,e.g. tiny-docker port 1234567890",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		bindings, err := api.Port(ctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		for _, binding := range bindings {
+			fmt.Printf("%d/%s -> %s\n", binding.ContainerPort, binding.Proto, binding.HostAddress())
+		}
+		return nil
+	},
+}
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "get real time events of containers, networks and images,e.g. tiny-docker events -since 10m -filter event=die",
+	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:  "v",
-			Usage: "volume,e.g.: -v /etc/conf:/etc/conf",
+			Name:  "since",
+			Usage: "show events created since timestamp, RFC3339 time or relative duration, only new events if not set,e.g. -since 10m",
 		},
 		&cli.StringFlag{
-			Name:  "name",
-			Usage: "container name, e.g.: -name containerName",
+			Name:  "until",
+			Usage: "stream events until this timestamp, follow new events if not set",
 		},
 		&cli.StringSliceFlag{
-			Name:  "e",
-			Usage: "set environment,e.g. -e name=mydocker",
+			Name:  "filter",
+			Usage: "filter events by type, event, container, network or image,e.g. -filter type=container -filter event=die",
 		},
 		&cli.StringFlag{
-			Name:  "net",
-			Usage: "set container network, e.g. -net testbr",
-		},
-		&cli.StringSliceFlag{
-			Name:  "p",
-			Usage: "port mapping,e.g. -p 8080:80 -p 30336:3306",
+			Name:  "format",
+			Usage: "output format, json or empty for plain text",
 		},
 	},
 	Action: func(ctx *cli.Context) error {
-		if ctx.Args().Len() < 2 {
-			return fmt.Errorf("missing imageName or container command")
+		format := ctx.String("format")
+		if format != "" && format != formatJson {
+			return fmt.Errorf("unsupported format %s, must be %s", format, formatJson)
 		}
-		imageName := ctx.Args().Get(0)
-		cmd := ctx.Args().Slice()[1:]
-		tty := ctx.Bool("it")
-		detach := ctx.Bool("d")
-
-		// tty 和 detach只能生效一个
-		if tty && detach {
-			return fmt.Errorf("it and d paramter can not both provided")
+		now := time.Now()
+		opts := &client.EventsOptions{}
+		var err error
+		if opts.Since, err = events.ParseTime(ctx.String("since"), now); err != nil {
+			return err
 		}
-
-		// 构建资源控制器
-		memoryLimit := ctx.String("mem")
-		cpuLimit := ctx.Int("cpu")
-		cpusetLimit := ctx.String("cpuset")
-
-		limitConfig := &subsystem.ResourceConfig{
-			MemoryLimit: memoryLimit,
-			CpuSet:      cpusetLimit,
-			CpuCfsQuota: cpuLimit,
+		// 与 docker events 一致，未指定 since 时只显示新的事件
+		if opts.Since.IsZero() {
+			opts.Since = now
 		}
-
-		volume := ctx.String("v")
-		containerName := ctx.String("name")
-		envSlice := ctx.StringSlice("e")
-		network := ctx.String("net")
-		portMapping := ctx.StringSlice("p")
-		if tty || detach {
-			Run(tty, cmd, limitConfig, volume, containerName, imageName, envSlice, network, portMapping)
+		if opts.Until, err = events.ParseTime(ctx.String("until"), now); err != nil {
+			return err
 		}
-		return nil
+		if opts.Filter, err = events.ParseFilter(ctx.StringSlice("filter")); err != nil {
+			return err
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		// Ctrl-C 时停止等待新的事件
+		sigCtx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return api.Events(sigCtx, opts, func(event *events.Event) error {
+			return printEvent(event, format)
+		})
 	},
 }
 
 var initCommand = cli.Command{
 	Name:  "init",
 	Usage: "Init container process run user's process in container. Do not call it outside",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "reap",
+			Usage: "keep init as PID 1 to forward signals and reap zombies",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ulimit",
+			Usage: "set rlimit before running user's process",
+		},
+		&cli.StringSliceFlag{
+			Name:  "sysctl",
+			Usage: "set namespaced sysctl before running user's process",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		log.Infof("init container")
-		err := container.RunContainerInitProcess()
+		err := container.RunContainerInitProcess(&container.InitOptions{
+			Reap:    ctx.Bool("reap"),
+			Ulimits: ctx.StringSlice("ulimit"),
+			Sysctls: ctx.StringSlice("sysctl"),
+		})
 		return err
 	},
 }
@@ -114,7 +538,11 @@ var commitCommand = cli.Command{
 		containerId := ctx.Args().Get(0)
 		imageName := ctx.Args().Get(1)
 
-		return commitContainer(containerId, imageName)
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Commit(containerId, imageName)
 	},
 }
 
@@ -122,7 +550,15 @@ var listCommand = cli.Command{
 	Name:  "ps",
 	Usage: "list all the containers",
 	Action: func(ctx *cli.Context) error {
-		ListContainerInfos()
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		containers, err := api.List()
+		if err != nil {
+			return err
+		}
+		printContainers(containers)
 		return nil
 	},
 }
@@ -130,13 +566,27 @@ var listCommand = cli.Command{
 var logCommand = cli.Command{
 	Name:  "logs",
 	Usage: "print logs of a container",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "tail",
+			Usage: "number of lines to show from the end of the logs, 0 means all",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if ctx.Args().Len() < 1 {
 			return fmt.Errorf("please input your container name")
 		}
 		containerName := ctx.Args().Get(0)
-		logContainer(containerName)
-		return nil
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		content, err := api.Logs(containerName, &client.LogsOptions{Tail: ctx.Int("tail")})
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
 	},
 }
 
@@ -145,7 +595,7 @@ var execCommand = cli.Command{
 	Usage: "exec a command into container",
 	Action: func(ctx *cli.Context) error {
 		// 如果环境变量存在，说明C代码已经运行过了，即setns系统调用已经执行了，这里就直接返回，避免重复执行
-		if os.Getenv(EnvExecPid) != "" {
+		if os.Getenv(client.EnvExecPid) != "" {
 			log.Infof("pid callback pid %v", os.Getgid())
 			return nil
 		}
@@ -153,24 +603,157 @@ var execCommand = cli.Command{
 		if ctx.Args().Len() < 2 {
 			return fmt.Errorf("missing container name or command")
 		}
+		// exec 需要在本地进入容器的 namespace 并转发标准输入输出，daemon 不提供这个接口
+		if ctx.String("host") != "" {
+			return fmt.Errorf("exec is not supported with --host")
+		}
 		containerName := ctx.Args().Get(0)
 		// 第0位为容器名
 		cmdArray := ctx.Args().Slice()[1:]
-		ExecContainer(containerName, cmdArray)
-		return nil
+		return localClient().Exec(containerName, &client.ExecOptions{
+			Cmd:    cmdArray,
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
 	},
 }
 
 var stopCommand = cli.Command{
 	Name:  "stop",
-	Usage: "stop container,e.g. tiny-docker stop [containerId]",
+	Usage: "stop container,e.g. tiny-docker stop -t 10 [containerId]",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "t",
+			Usage: "seconds to wait for stop before killing it",
+			Value: client.DefaultStopTimeout,
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if ctx.Args().Len() < 1 {
-			return fmt.Errorf("missing container id")
+			return fmt.Errorf("missing container id or name")
 		}
 		containerId := ctx.Args().Get(0)
-		stopContainer(containerId)
-		return nil
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Stop(containerId, &client.StopOptions{Timeout: ctx.Int("t")})
+	},
+}
+
+var killCommand = cli.Command{
+	Name:  "kill",
+	Usage: "send a signal to container,e.g. tiny-docker kill -s SIGTERM [containerId]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "s",
+			Usage: "signal to send to the container",
+			Value: "SIGKILL",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Kill(ctx.Args().Get(0), ctx.String("s"))
+	},
+}
+
+var pauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause all processes within container,e.g. tiny-docker pause [containerId]",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Pause(ctx.Args().Get(0))
+	},
+}
+
+var unpauseCommand = cli.Command{
+	Name:  "unpause",
+	Usage: "unpause all processes within container,e.g. tiny-docker unpause [containerId]",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Unpause(ctx.Args().Get(0))
+	},
+}
+
+var statsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "display container resource usage,e.g. tiny-docker stats [containerId...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-stream",
+			Usage: "print the first result only",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format, table or json",
+			Value: formatTable,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return statsContainers(ctx.Args().Slice(), ctx.Bool("no-stream"), ctx.String("format"))
+	},
+}
+
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of a running container, unset flags keep the current limits,e.g. tiny-docker update -mem 200m [containerId]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "mem",
+			Usage: "memory limit,e.g.: -mem 100m",
+		},
+		&cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "total memory plus swap limit, -1 means unlimited,e.g.: -memory-swap 200m",
+		},
+		&cli.IntFlag{
+			Name:  "cpu",
+			Usage: "cpu quota,e.g.: -cpu 100",
+		},
+		&cli.StringFlag{
+			Name:  "cpuset",
+			Usage: "cpuset limit,e.g.: -cpuset 2,4",
+		},
+		&cli.IntFlag{
+			Name:  "pids-limit",
+			Usage: "container pids limit, -1 means unlimited,e.g.: -pids-limit 100",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing container id or name")
+		}
+		update := &subsystem.ResourceConfig{
+			MemoryLimit: ctx.String("mem"),
+			MemorySwap:  ctx.String("memory-swap"),
+			CpuCfsQuota: ctx.Int("cpu"),
+			CpuSet:      ctx.String("cpuset"),
+			PidsLimit:   ctx.Int("pids-limit"),
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Update(ctx.Args().Get(0), update)
 	},
 }
 
@@ -185,12 +768,30 @@ var removeCommand = cli.Command{
 	},
 	Action: func(ctx *cli.Context) error {
 		if ctx.Args().Len() < 1 {
-			return fmt.Errorf("missing container id")
+			return fmt.Errorf("missing container id or name")
 		}
 		force := ctx.Bool("f")
 		containerId := ctx.Args().Get(0)
-		removeContainer(containerId, force)
-		return nil
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Remove(containerId, &client.RemoveOptions{Force: force})
+	},
+}
+
+var renameCommand = cli.Command{
+	Name:  "rename",
+	Usage: "rename a container,e.g. tiny-docker rename [container] [newName]",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 2 {
+			return fmt.Errorf("missing container id or new name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		return api.Rename(ctx.Args().Get(0), ctx.Args().Get(1))
 	},
 }
 
@@ -201,6 +802,10 @@ var networkCommand = cli.Command{
 		&networkCreateCommand,
 		&networkListCommand,
 		&networkRemoveCommand,
+		&networkInspectCommand,
+		&networkConnectCommand,
+		&networkDisconnectCommand,
+		&networkFirewallCommand,
 	},
 }
 
@@ -209,12 +814,33 @@ var networkCreateCommand = cli.Command{
 	Usage: "create a new network",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:  "driver",
-			Usage: "network driver",
+			Name:    "driver",
+			Aliases: []string{"d"},
+			Usage:   "network driver, one of bridge, macvlan, ipvlan",
 		},
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Name:  "subnet",
-			Usage: "subnet cidr",
+			Usage: "subnet cidr, one IPv4 and one IPv6 subnet at most,e.g. -subnet 10.0.0.0/24 -subnet fd00::/64",
+		},
+		&cli.BoolFlag{
+			Name:  "ipv6",
+			Usage: "enable IPv6 networking, requires an IPv6 subnet",
+		},
+		&cli.StringSliceFlag{
+			Name:  "gateway",
+			Usage: "gateway of the subnet, one for each subnet at most,e.g. --gateway 10.0.0.254",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ip-range",
+			Usage: "allocate container ip from a sub-range of the subnet,e.g. --ip-range 10.0.0.128/25",
+		},
+		&cli.BoolFlag{
+			Name:  "internal",
+			Usage: "restrict external access to the network, no outbound nat and default route",
+		},
+		&cli.StringSliceFlag{
+			Name:  "opt",
+			Usage: "driver specific options,e.g. --opt icc=false, --opt parent=eth1, --opt ipvlan_mode=l3",
 		},
 	},
 	Action: func(ctx *cli.Context) error {
@@ -222,10 +848,31 @@ var networkCreateCommand = cli.Command{
 			return fmt.Errorf("missing network name")
 		}
 		driver := ctx.String("driver")
-		subnet := ctx.String("subnet")
+		subnets := ctx.StringSlice("subnet")
 		name := ctx.Args().Get(0)
+		options := make(map[string]string)
+		for _, opt := range ctx.StringSlice("opt") {
+			key, value, ok := strings.Cut(opt, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid option %s, should be key=value", opt)
+			}
+			options[key] = value
+		}
 
-		err := network.CreateNetwork(driver, subnet, name)
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		err = api.CreateNetwork(&client.NetworkCreateOptions{
+			Name:     name,
+			Driver:   driver,
+			Subnets:  subnets,
+			IPv6:     ctx.Bool("ipv6"),
+			Gateways: ctx.StringSlice("gateway"),
+			IPRanges: ctx.StringSlice("ip-range"),
+			Internal: ctx.Bool("internal"),
+			Options:  options,
+		})
 		if err != nil {
 			return fmt.Errorf("create network error: %+v", err)
 		}
@@ -238,7 +885,15 @@ var networkListCommand = cli.Command{
 	Name:  "list",
 	Usage: "list container network",
 	Action: func(ctx *cli.Context) error {
-		network.ListNetwork()
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		networks, err := api.ListNetworks()
+		if err != nil {
+			return err
+		}
+		network.PrintNetworks(networks)
 		return nil
 	},
 }
@@ -250,10 +905,110 @@ var networkRemoveCommand = cli.Command{
 		if ctx.Args().Len() < 1 {
 			return fmt.Errorf("missing network name")
 		}
-		err := network.DeleteNetwork(ctx.Args().Get(0))
+		api, err := getAPI(ctx)
 		if err != nil {
+			return err
+		}
+		if err = api.RemoveNetwork(ctx.Args().Get(0)); err != nil {
 			return fmt.Errorf("remove network error: %+v", err)
 		}
 		return nil
 	},
 }
+
+var networkConnectCommand = cli.Command{
+	Name:  "connect",
+	Usage: "connect a running container to a network,e.g. tiny-docker network connect [network] [container]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "ip",
+			Usage: "IPv4 or IPv6 address of the container in the network, e.g. -ip 10.0.0.10",
+		},
+		&cli.StringSliceFlag{
+			Name:  "alias",
+			Usage: "add a name other containers on the network can resolve this container by",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 2 {
+			return fmt.Errorf("missing network name or container id")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		opts := &client.NetworkConnectOptions{
+			Container: ctx.Args().Get(1),
+			IP:        ctx.String("ip"),
+			Aliases:   ctx.StringSlice("alias"),
+		}
+		if err = api.ConnectNetwork(ctx.Args().Get(0), opts); err != nil {
+			return errors.WithMessage(err, "connect network failed")
+		}
+		return nil
+	},
+}
+
+var networkDisconnectCommand = cli.Command{
+	Name:  "disconnect",
+	Usage: "disconnect a container from a network,e.g. tiny-docker network disconnect [network] [container]",
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 2 {
+			return fmt.Errorf("missing network name or container id")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		if err = api.DisconnectNetwork(ctx.Args().Get(0), ctx.Args().Get(1)); err != nil {
+			return errors.WithMessage(err, "disconnect network failed")
+		}
+		return nil
+	},
+}
+
+var networkFirewallCommand = cli.Command{
+	Name:  "firewall",
+	Usage: "show or set the firewall backend of network rules,e.g. tiny-docker network firewall [auto|iptables|nftables]",
+	Action: func(ctx *cli.Context) error {
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		if ctx.Args().Len() > 0 {
+			if err = api.SetFirewall(ctx.Args().Get(0)); err != nil {
+				return errors.WithMessage(err, "set firewall backend failed")
+			}
+		}
+		info, err := api.Firewall()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("backend: %s\nactive: %s\n", info.Backend, info.Active)
+		return nil
+	},
+}
+
+var networkInspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information on one or more networks",
+	Flags: []cli.Flag{formatFlag},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() < 1 {
+			return fmt.Errorf("missing network name")
+		}
+		api, err := getAPI(ctx)
+		if err != nil {
+			return err
+		}
+		networks := make([]any, 0, ctx.Args().Len())
+		for _, name := range ctx.Args().Slice() {
+			nw, err := api.InspectNetwork(name)
+			if err != nil {
+				return errors.WithMessagef(err, "inspect network %s failed", name)
+			}
+			networks = append(networks, nw)
+		}
+		return printInspect(os.Stdout, networks, ctx.String("format"))
+	},
+}
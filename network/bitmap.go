@@ -0,0 +1,109 @@
+package network
+
+import "sort"
+
+// bitmap 记录网段中已分配的地址，第 n 位为 1 表示网段中偏移为 n 的地址已被分配
+// 自动分配总是从低到高分配，这里只保存到最高的已分配地址为止，超出长度的位都视为 0，
+// 因此即使是 /8 或者更大的网段，占用的空间也只和已分配的地址数量有关
+// 指定的地址和网关可能在网段的高位，不能直接写入位图，由 offsetSet 单独记录
+type bitmap []byte
+
+// test 判断第 n 位是否为 1
+func (b bitmap) test(n uint64) bool {
+	index := n / 8
+	if index >= uint64(len(b)) {
+		return false
+	}
+	return b[index]&(1<<(n%8)) != 0
+}
+
+// set 将第 n 位置为 1，长度不够时自动扩展
+func (b *bitmap) set(n uint64) {
+	index := n / 8
+	if index >= uint64(len(*b)) {
+		grown := make(bitmap, index+1)
+		copy(grown, *b)
+		*b = grown
+	}
+	(*b)[index] |= 1 << (n % 8)
+}
+
+// clear 将第 n 位置为 0，并去掉末尾全为 0 的字节
+func (b *bitmap) clear(n uint64) {
+	index := n / 8
+	if index >= uint64(len(*b)) {
+		return
+	}
+	(*b)[index] &^= 1 << (n % 8)
+	end := len(*b)
+	for end > 0 && (*b)[end-1] == 0 {
+		end--
+	}
+	*b = (*b)[:end]
+}
+
+// firstClear 返回 [from, to] 范围内第一个为 0 的位，全部为 1 时返回 false
+func (b bitmap) firstClear(from, to uint64) (uint64, bool) {
+	for n := from; n <= to; {
+		index := n / 8
+		if index >= uint64(len(b)) {
+			return n, true
+		}
+		// 跳过已经全部分配的字节
+		if b[index] == 0xff {
+			n = (index + 1) * 8
+			continue
+		}
+		if !b.test(n) {
+			return n, true
+		}
+		if n == to {
+			break
+		}
+		n++
+	}
+	return 0, false
+}
+
+// count 返回已分配的地址数量
+func (b bitmap) count() int {
+	total := 0
+	for _, v := range b {
+		for ; v != 0; v &= v - 1 {
+			total++
+		}
+	}
+	return total
+}
+
+// offsetSet 按从小到大的顺序记录位图之外的已分配偏移，例如 IPv6 网段中指定的地址或者网段末尾的网关
+type offsetSet []uint64
+
+// search 返回第一个不小于 n 的元素的下标
+func (s offsetSet) search(n uint64) int {
+	return sort.Search(len(s), func(i int) bool { return s[i] >= n })
+}
+
+// contains 判断 n 是否在集合中
+func (s offsetSet) contains(n uint64) bool {
+	i := s.search(n)
+	return i < len(s) && s[i] == n
+}
+
+// add 将 n 加入集合
+func (s *offsetSet) add(n uint64) {
+	i := s.search(n)
+	if i < len(*s) && (*s)[i] == n {
+		return
+	}
+	*s = append(*s, 0)
+	copy((*s)[i+1:], (*s)[i:])
+	(*s)[i] = n
+}
+
+// remove 将 n 从集合中删除
+func (s *offsetSet) remove(n uint64) {
+	if i := s.search(n); i < len(*s) && (*s)[i] == n {
+		*s = append((*s)[:i], (*s)[i+1:]...)
+	}
+}
@@ -3,17 +3,22 @@ package network
 import (
 	"fmt"
 	"net"
-	"os/exec"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 var _ Driver = (*BridgeNetworkDriver)(nil)
 
+// bridgeOptionICC bridge 驱动的参数，是否允许同一网络中的容器互相访问，默认允许
+const bridgeOptionICC = "icc"
+
 type BridgeNetworkDriver struct {
 }
 
@@ -21,26 +26,46 @@ func (d *BridgeNetworkDriver) Name() string {
 	return "bridge"
 }
 
-func (d *BridgeNetworkDriver) Create(subnet string, name string) (*Network, error) {
-	ip, ipRange, _ := net.ParseCIDR(subnet)
-	ipRange.IP = ip
-	n := &Network{
-		Name:    name,
-		IPRange: ipRange,
-		Driver:  d.Name(),
+// Create 创建网桥，network 的 IPRange 和 IPv6Range 中的 IP 为网桥的网关地址
+// 网桥名根据网络名生成并记录在 network.Bridge 中
+func (d *BridgeNetworkDriver) Create(n *Network) error {
+	n.Driver = d.Name()
+	if err := validateBridgeOptions(n.Options); err != nil {
+		return err
+	}
+	if n.Bridge == "" {
+		n.Bridge = bridgeName(n.Name)
+	}
+	if err := d.initBridge(n); err != nil {
+		return errors.Wrapf(err, "Failed to create bridge network")
 	}
+	return nil
+}
 
-	err := d.initBridge(n)
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to create bridge network")
+// validateBridgeOptions 检查 bridge 驱动的参数
+func validateBridgeOptions(options map[string]string) error {
+	for key, value := range options {
+		switch key {
+		case bridgeOptionICC:
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid value %s of option %s, should be true or false", value, key)
+			}
+		default:
+			return fmt.Errorf("unknown option %s of bridge driver", key)
+		}
 	}
+	return nil
+}
 
-	return n, err
+// icc 返回是否允许同一网络中的容器互相访问
+func (nw *Network) icc() bool {
+	icc, err := strconv.ParseBool(nw.Options[bridgeOptionICC])
+	return err != nil || icc
 }
 
 // initBridge 配置网桥
 func (d *BridgeNetworkDriver) initBridge(n *Network) error {
-	bridgeName := n.Name
+	bridgeName := n.Bridge
 	// 1. 创建Bridge虚拟设备
 	// sudo brctl addbr br0
 	if err := createBridgeInterface(bridgeName); err != nil {
@@ -49,10 +74,28 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 
 	// 2. 设置Bridge 设备地址和路由
 	// ip addr add 172.18.0.1/24 dev br0
-	gatewayIP := *n.IPRange
-	gatewayIP.IP = n.IPRange.IP
-	if err := setInterfaceIP(bridgeName, gatewayIP.String()); err != nil {
-		return errors.Wrapf(err, "Error set bridge ip: %s on bridge: %s", gatewayIP.String(), bridgeName)
+	// 开启 IPv6 时还需要 ip addr add fd00::1/64 dev br0，并允许宿主机转发 IPv6 报文
+	if n.IPv6Range != nil {
+		if err := enableIPv6(bridgeName); err != nil {
+			return err
+		}
+	}
+	// 同一网桥上的容器之间的报文不经过路由，需要 br_netfilter 将其交给 FORWARD 链过滤
+	if !n.icc() {
+		if err := enableBridgeNetfilter(); err != nil {
+			return err
+		}
+	}
+	// 宿主机通过 127.0.0.1 访问映射的端口时，DNAT 后的报文源地址仍然是 127.0.0.1，需要允许它从网桥发出
+	if n.IPRange != nil {
+		if err := enableRouteLocalnet(bridgeName); err != nil {
+			return err
+		}
+	}
+	for _, gatewayIP := range n.ipRanges() {
+		if err := setInterfaceIP(bridgeName, gatewayIP.String()); err != nil {
+			return errors.Wrapf(err, "Error set bridge ip: %s on bridge: %s", gatewayIP.String(), bridgeName)
+		}
 	}
 
 	// 3. 启动 Bridge 设备
@@ -61,15 +104,52 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 		return errors.Wrapf(err, "Failed to set %s up", bridgeName)
 	}
 
-	// 4. 配置 nat 规则让容器可以访问外网
-	// iptables -t nat -A POSTROUTING -s 172.18.0.0/24 ! -o br0 -j MASQUERADE
-	if err := setupIPTables(bridgeName, n.IPRange); err != nil {
-		return errors.Wrapf(err, "Failed to set up iptables for %s", bridgeName)
+	// 4. 配置 nat 规则让容器可以访问外网，以及通过映射的端口访问同一网桥上的容器
+	// iptables -t nat -A TINY-DOCKER-POSTROUTING -s 172.18.0.0/24 ! -o br0 -j MASQUERADE
+	// ip6tables -t nat -A TINY-DOCKER-POSTROUTING -s fd00::/64 ! -o br0 -j MASQUERADE
+	if err := addFirewallRules(networkOwner(n.Name), networkRules(n)); err != nil {
+		return errors.Wrapf(err, "Failed to set up firewall rules for %s", bridgeName)
 	}
 
 	return nil
 }
 
+// enableIPv6 允许网桥配置 IPv6 地址，并开启宿主机的 IPv6 转发
+func enableIPv6(bridgeName string) error {
+	sysctls := map[string]string{
+		fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", bridgeName): "0",
+		"/proc/sys/net/ipv6/conf/all/forwarding":                           "1",
+	}
+	for path, value := range sysctls {
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			return errors.Wrapf(err, "write %s to %s failed", value, path)
+		}
+	}
+	return nil
+}
+
+// enableRouteLocalnet 允许网桥转发源地址为 127.0.0.0/8 的报文
+func enableRouteLocalnet(bridgeName string) error {
+	path := fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/route_localnet", bridgeName)
+	if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+		return errors.Wrapf(err, "write 1 to %s failed", path)
+	}
+	return nil
+}
+
+// enableBridgeNetfilter 让网桥转发的报文经过 iptables 和 ip6tables 的规则，需要加载 br_netfilter 模块
+func enableBridgeNetfilter() error {
+	for _, path := range []string{
+		"/proc/sys/net/bridge/bridge-nf-call-iptables",
+		"/proc/sys/net/bridge/bridge-nf-call-ip6tables",
+	} {
+		if err := os.WriteFile(path, []byte("1"), 0644); err != nil {
+			return errors.Wrapf(err, "write 1 to %s failed, icc=false requires the br_netfilter module, try modprobe br_netfilter", path)
+		}
+	}
+	return nil
+}
+
 // createBridgeInterface 创建Bridge 设备
 // ip link add xxxx
 func createBridgeInterface(bridgeName string) error {
@@ -123,6 +203,10 @@ func setInterfaceIP(name string, rawIP string) error {
 	// 同时如果配置了地址所在网段的信息，例如 192.168.0.0/24
 	// 还会配置路由表 192.168.0.0/24 转发到这 testbridge 的网络接口上
 	addr := &netlink.Addr{IPNet: ipNet}
+	// IPv6 地址默认需要先完成重复地址检测才能使用，地址由 IPAM 分配不会重复，跳过检测避免立即添加路由时失败
+	if ipNet.IP.To4() == nil {
+		addr.Flags = unix.IFA_F_NODAD
+	}
 	return netlink.AddrAdd(iface, addr)
 }
 
@@ -140,50 +224,24 @@ func setInterfaceUP(interfaceName string) error {
 	return nil
 }
 
-// setupIPTables 设置 iptables 对应 bridge MASQUERADE 规则
-// iptables -t nat -A POSTROUTING -s 172.18.0.0/24 -o eth0 -j MASQUERADE
-// iptables -t nat -A POSTROUTING -s {subnet} -o {deviceName} -j MASQUERADE
-func setupIPTables(bridgeName string, subnet *net.IPNet) error {
-	return configIPTables(bridgeName, subnet, false)
-}
-
-func deleteIPTables(bridgeName string, subnet *net.IPNet) error {
-	return configIPTables(bridgeName, subnet, true)
-}
-
-func configIPTables(bridgeName string, subnet *net.IPNet, isDelete bool) error {
-	action := "-A"
-	if isDelete {
-		action = "-D"
-	}
-	// 拼接命令
-	iptablesCmd := fmt.Sprintf("-t nat %s POSTROUTING -s %s ! -o %s -j MASQUERADE", action, subnet.String(), bridgeName)
-	cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-	logrus.Infof("配置 SNAT cmd: %v", cmd.String())
-	// 执行该命令
-	output, err := cmd.Output()
-	if err != nil {
-		logrus.Errorf("iptables Output, %v", output)
-	}
-	return err
-}
-
 // Delete 删除网络
 func (d *BridgeNetworkDriver) Delete(network *Network) error {
-	// 清除路由规则
-	err := deleteIPRoute(network.Name, network.IPRange.IP.String())
-	if err != nil {
-		return errors.WithMessagef(err, "clean route rule failed after bridge [%s] deleted", network.Name)
+	for _, ipRange := range network.ipRanges() {
+		subnet := &net.IPNet{IP: ipRange.IP.Mask(ipRange.Mask), Mask: ipRange.Mask}
+		// 清除路由规则
+		err := deleteIPRoute(network.Bridge, subnet.String())
+		if err != nil {
+			return errors.WithMessagef(err, "clean route rule failed after bridge [%s] deleted", network.Bridge)
+		}
 	}
-	// 清除 iptables 规则
-	err = deleteIPTables(network.Name, network.IPRange)
-	if err != nil {
-		return errors.WithMessagef(err, "clean snat iptables rule failed after bridge [%s] deleted", network.Name)
+	// 清除 nat 规则
+	if err := deleteFirewallRules(networkOwner(network.Name), networkRules(network)); err != nil {
+		return errors.WithMessagef(err, "clean snat rules failed after bridge [%s] deleted", network.Bridge)
 	}
 	// 删除网桥
-	err = d.deleteBridge(network)
+	err := d.deleteBridge(network)
 	if err != nil {
-		return errors.WithMessagef(err, "delete bridge [%s] failed", network.Name)
+		return errors.WithMessagef(err, "delete bridge [%s] failed", network.Bridge)
 	}
 	return nil
 }
@@ -205,8 +263,8 @@ func deleteIPRoute(name string, rawIP string) error {
 	if err != nil {
 		return errors.Wrap(err, "abandoning retrieving the new bridge link from netlink, Run [ ip link ] to troubleshoot")
 	}
-	// 查询对应设备的路由并全部删除
-	list, err := netlink.RouteList(iface, netlink.FAMILY_V4)
+	// 查询对应设备的 IPv4 和 IPv6 路由，删除目的网段为 rawIP 的路由
+	list, err := netlink.RouteList(iface, netlink.FAMILY_ALL)
 	if err != nil {
 		return err
 	}
@@ -224,7 +282,7 @@ func deleteIPRoute(name string, rawIP string) error {
 
 // deleteBridge deletes the bridge
 func (d *BridgeNetworkDriver) deleteBridge(n *Network) error {
-	bridgeName := n.Name
+	bridgeName := n.Bridge
 
 	// get the link
 	l, err := netlink.LinkByName(bridgeName)
@@ -241,24 +299,22 @@ func (d *BridgeNetworkDriver) deleteBridge(n *Network) error {
 }
 
 // Connect 连接网桥和网端
-func (d *BridgeNetworkDriver) Connect(networkName string, endpoint *Endpoint) error {
-	bridgeName := networkName
+func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) error {
+	bridgeName := network.Bridge
 
 	// 获取要连接的网桥
 	br, err := netlink.LinkByName(bridgeName)
 	if err != nil {
 		return err
 	}
-	// 创建veth 接口
+	// 创建veth 接口，两端的名字由调用方在 endpoint.Device 中指定
 	la := netlink.NewLinkAttrs()
-	// linux 接口限制，取endpointId 前五位
-	la.Name = endpoint.ID[:5]
+	la.Name = endpoint.Device.Name
 	// 通过设置 Veth 接口 master 属性，设置这个Veth的一端挂载到网络对应的 Linux Bridge
 	la.MasterIndex = br.Attrs().Index
-	// 配置 Veth 另外一端的名字 cif {endpoint ID 的前5位)
 	endpoint.Device = netlink.Veth{
 		LinkAttrs: la,
-		PeerName:  "cif-" + endpoint.ID[:5],
+		PeerName:  endpoint.Device.PeerName,
 	}
 	// 调用netlink的LinkAdd方法创建出这个Veth接口
 	// 因为上面指定了link的MasterIndex是网络对应的Linux Bridge
@@ -266,6 +322,10 @@ func (d *BridgeNetworkDriver) Connect(networkName string, endpoint *Endpoint) er
 	if err = netlink.LinkAdd(&endpoint.Device); err != nil {
 		return fmt.Errorf("error Add Endpoint Device: %v", err)
 	}
+	// 开启网桥端口的 hairpin 模式，容器通过映射的端口访问自己时，报文需要从进入网桥的端口发回
+	if err = netlink.LinkSetHairpin(&endpoint.Device, true); err != nil {
+		return fmt.Errorf("error set hairpin mode of Endpoint Device: %v", err)
+	}
 	// 调用netlink的LinkSetUp方法，设置Veth启动
 	// 相当于ip link set xxx up命令
 	if err = netlink.LinkSetUp(&endpoint.Device); err != nil {
@@ -274,33 +334,23 @@ func (d *BridgeNetworkDriver) Connect(networkName string, endpoint *Endpoint) er
 	return nil
 }
 
-func (d *BridgeNetworkDriver) Disconnect(endpointID string) error {
+// Disconnect 删除网络端点宿主机一侧的 veth 设备，另一端在容器中的设备会被一起删除
+func (d *BridgeNetworkDriver) Disconnect(endpoint *Endpoint) error {
 	// 根据名字找到对应的 Veth 设备
-	vethNme := endpointID[:5] // 由于 Linux 接口名的限制,取 endpointID 的前 5 位
-	veth, err := netlink.LinkByName(vethNme)
+	vethName := endpoint.Device.Name
+	veth, err := netlink.LinkByName(vethName)
 	if err != nil {
-		return err
+		return errors.WithMessagef(err, "find veth [%s] failed", vethName)
 	}
 	// 从网桥解绑
 	err = netlink.LinkSetNoMaster(veth)
 	if err != nil {
-		return errors.WithMessagef(err, "find veth [%s] failed", vethNme)
+		return errors.WithMessagef(err, "unset master of veth [%s] failed", vethName)
 	}
 	// 删除 veth-pair
-	// 一端为 xxx,另一端为 cif-xxx
 	err = netlink.LinkDel(veth)
 	if err != nil {
-		return errors.WithMessagef(err, "delete veth [%s] failed", vethNme)
-	}
-	veth2Name := "cif-" + vethNme
-	veth2, err := netlink.LinkByName(veth2Name)
-	if err != nil {
-		return errors.WithMessagef(err, "find veth [%s] failed", veth2Name)
+		return errors.WithMessagef(err, "delete veth [%s] failed", vethName)
 	}
-	err = netlink.LinkDel(veth2)
-	if err != nil {
-		return errors.WithMessagef(err, "delete veth [%s] failed", veth2Name)
-	}
-
 	return nil
 }
@@ -3,57 +3,68 @@ package network
 import (
 	"net"
 	"testing"
+
+	"github.com/vishvananda/netlink"
 )
 
 var testName = "testbridge"
 
 func TestBridgeCreate(t *testing.T) {
 	d := BridgeNetworkDriver{}
-	n, err := d.Create("192.168.0.1/24", testName)
+	ip, ipRange, _ := net.ParseCIDR("192.168.0.1/24")
+	ipRange.IP = ip
+	n := &Network{Name: testName, IPRange: ipRange}
+	err := d.Create(n)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("create network :%v", n)
 }
 
-func TestBridgeDelete(t *testing.T) {
-	d := BridgeNetworkDriver{}
-	_, ipRange, _ := net.ParseCIDR("192.168.0.1/24")
-	n := &Network{
-		Name:    testName,
-		IPRange: ipRange,
-	}
-	err := d.Delete(n)
-	if err != nil {
-		t.Fatal(err)
-	}
-	t.Logf("delete network :%v", testName)
-}
-
 func TestBridgeConnect(t *testing.T) {
+	hostVeth, peerVeth := vethNames("testcontainer", "eth0")
 	ep := &Endpoint{
-		ID: "testcontainer",
+		ID:     "testcontainer",
+		Device: netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostVeth}, PeerName: peerVeth},
 	}
 
 	n := Network{
-		Name: testName,
+		Name:   testName,
+		Bridge: bridgeName(testName),
 	}
 
 	d := BridgeNetworkDriver{}
-	err := d.Connect(n.Name, ep)
+	err := d.Connect(&n, ep)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestBridgeDisconnect(t *testing.T) {
+	hostVeth, _ := vethNames("testcontainer", "eth0")
 	ep := Endpoint{
-		ID: "testcontainer",
+		ID:     "testcontainer",
+		Device: netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostVeth}},
 	}
 
 	d := BridgeNetworkDriver{}
-	err := d.Disconnect(ep.ID)
+	err := d.Disconnect(&ep)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestBridgeDelete(t *testing.T) {
+	d := BridgeNetworkDriver{}
+	_, ipRange, _ := net.ParseCIDR("192.168.0.1/24")
+	n := &Network{
+		Name:    testName,
+		IPRange: ipRange,
+		Bridge:  bridgeName(testName),
+	}
+	err := d.Delete(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("delete network :%v", testName)
+}
@@ -0,0 +1,433 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DNSServerCommand 启动 DNS 进程的 tiny-docker 子命令
+	DNSServerCommand = "dns-server"
+
+	dnsPidDir         = "/var/lib/tiny-docker/network/dns/"
+	hostResolvConf    = "/etc/resolv.conf"
+	dnsPort           = 53
+	dnsForwardTimeout = 3 * time.Second
+	// dnsMaxMessageLen UDP DNS 报文的最大长度
+	dnsMaxMessageLen = 65535
+)
+
+// defaultUpstreams 宿主机没有配置 DNS 服务器时使用的上游服务器
+var defaultUpstreams = []string{"8.8.8.8", "8.8.4.4"}
+
+// resolvConf resolv.conf 中用到的配置
+type resolvConf struct {
+	Nameservers []string
+	Search      []string
+	Options     []string
+}
+
+// parseResolvConf 解析 resolv.conf 文件内容
+func parseResolvConf(content string) *resolvConf {
+	conf := &resolvConf{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1])
+		case "search":
+			conf.Search = fields[1:]
+		case "domain":
+			// domain 和 search 同时出现时以最后一个为准
+			conf.Search = fields[1:2]
+		case "options":
+			conf.Options = append(conf.Options, fields[1:]...)
+		}
+	}
+	return conf
+}
+
+// loadHostResolvConf 读取宿主机的 resolv.conf，读取失败时返回空配置
+func loadHostResolvConf() *resolvConf {
+	content, err := os.ReadFile(hostResolvConf)
+	if err != nil {
+		logrus.Warnf("read %s failed, detail: %v", hostResolvConf, err)
+		return &resolvConf{}
+	}
+	return parseResolvConf(string(content))
+}
+
+// dnsServers 返回网络内置 DNS 监听的地址，即网桥的网关地址，只有 bridge 网络提供内置 DNS
+func (nw *Network) dnsServers() []net.IP {
+	if nw.Driver != (&BridgeNetworkDriver{}).Name() {
+		return nil
+	}
+	servers := make([]net.IP, 0, 2)
+	for _, ipRange := range nw.ipRanges() {
+		servers = append(servers, ipRange.IP)
+	}
+	return servers
+}
+
+// DNSServers 返回网络内置 DNS 的地址，网络不提供内置 DNS 时返回空
+func DNSServers(networkName string) ([]net.IP, error) {
+	nw, err := getNetwork(networkName)
+	if err != nil {
+		return nil, err
+	}
+	return nw.dnsServers(), nil
+}
+
+// getNetwork 根据网络名加载网络信息
+func getNetwork(networkName string) (*Network, error) {
+	networks, err := loadNetwork()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load network from file failed")
+	}
+	nw, ok := networks[networkName]
+	if !ok {
+		return nil, errors.WithMessagef(os.ErrNotExist, "no such network %s", networkName)
+	}
+	return nw, nil
+}
+
+// WriteResolvConf 在容器的 rootfs 中写入 resolv.conf，将 DNS 服务器指向网络的内置 DNS，search 和 options 沿用宿主机的配置
+func WriteResolvConf(networkName string, rootfs string) error {
+	servers, err := DNSServers(networkName)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+	host := loadHostResolvConf()
+	var buf bytes.Buffer
+	for _, server := range servers {
+		fmt.Fprintf(&buf, "nameserver %s\n", server)
+	}
+	if len(host.Search) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(host.Search, " "))
+	}
+	if len(host.Options) > 0 {
+		fmt.Fprintf(&buf, "options %s\n", strings.Join(host.Options, " "))
+	}
+
+	// 镜像中的 /etc 或 resolv.conf 可能是指向绝对路径的符号链接，不能跟随链接写到宿主机上
+	etcDir := path.Join(rootfs, "etc")
+	if fi, err := os.Lstat(etcDir); err == nil && !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", etcDir)
+	}
+	if err = os.MkdirAll(etcDir, constant.Perm0755); err != nil {
+		return errors.Wrapf(err, "create %s failed", etcDir)
+	}
+	resolvPath := path.Join(etcDir, "resolv.conf")
+	if err = os.Remove(resolvPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove %s failed", resolvPath)
+	}
+	if err = os.WriteFile(resolvPath, buf.Bytes(), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", resolvPath)
+	}
+	return nil
+}
+
+func dnsPidPath(networkName string) string {
+	return path.Join(dnsPidDir, networkName+".pid")
+}
+
+// dnsServerPid 返回网络的 DNS 进程 pid，进程没有运行时返回 0
+func dnsServerPid(networkName string) int {
+	content, err := os.ReadFile(dnsPidPath(networkName))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0
+	}
+	// 重启后 pid 可能被其他进程复用，通过命令行参数确认是这个网络的 DNS 进程
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return 0
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	if len(args) < 2 || args[len(args)-2] != DNSServerCommand || args[len(args)-1] != networkName {
+		return 0
+	}
+	return pid
+}
+
+// DNSRunning 判断网络的 DNS 进程是否正在运行
+func DNSRunning(networkName string) bool {
+	return dnsServerPid(networkName) != 0
+}
+
+// stopDNS 结束网络的 DNS 进程
+func stopDNS(networkName string) {
+	if pid := dnsServerPid(networkName); pid != 0 {
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+			logrus.Warnf("stop dns server of network %s failed, detail: %v", networkName, err)
+		}
+	}
+	_ = os.Remove(dnsPidPath(networkName))
+}
+
+// dnsServer 网络的内置 DNS 服务
+type dnsServer struct {
+	network   string
+	upstreams []string
+	// internal 内部网络的容器不能访问外部网络，DNS 也只解析网络中的容器，不转发给上游服务器
+	internal bool
+}
+
+// ServeDNS 在网络的网关地址上提供 DNS 服务，直到收到 SIGTERM 或 SIGINT
+/*
+每个 bridge 网络由一个单独的 dns-server 进程提供 DNS 服务，容器的 resolv.conf 指向网桥的网关地址。
+查询同一网络中容器的容器名或别名时直接根据容器信息返回容器地址，其余查询转发给宿主机 /etc/resolv.conf 中配置的上游服务器，
+内部网络的其余查询直接返回 REFUSED。
+DNS 进程在创建网络和容器连接网络时按需启动，删除网络时结束。开始监听或监听失败后调用 ready 通知启动结果。
+*/
+func ServeDNS(networkName string, ready func(err error)) error {
+	nw, err := getNetwork(networkName)
+	if err != nil {
+		ready(err)
+		return err
+	}
+	servers := nw.dnsServers()
+	conns, err := listenDNS(networkName, servers)
+	ready(err)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dnsPidDir, constant.Perm0755); err != nil {
+		logrus.Warnf("create %s failed, detail: %v", dnsPidDir, err)
+	}
+	if err = os.WriteFile(dnsPidPath(networkName), []byte(strconv.Itoa(os.Getpid())), constant.Perm0644); err != nil {
+		logrus.Warnf("write dns server pid failed, detail: %v", err)
+	}
+
+	s := &dnsServer{network: networkName, internal: nw.Internal}
+	if !s.internal {
+		// 上游服务器不能是自己监听的地址，否则转发会形成循环
+		for _, upstream := range loadHostResolvConf().Nameservers {
+			if !containsIP(servers, net.ParseIP(upstream)) {
+				s.upstreams = append(s.upstreams, upstream)
+			}
+		}
+		if len(s.upstreams) == 0 {
+			s.upstreams = defaultUpstreams
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		logrus.Infof("receive signal %v, stop dns server of network %s", sig, networkName)
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			s.serve(conn)
+		}(conn)
+	}
+	wg.Wait()
+	// 网络被删除时 pid 文件已经被删除，只删除仍然属于自己的 pid 文件
+	if dnsServerPid(networkName) == os.Getpid() {
+		_ = os.Remove(dnsPidPath(networkName))
+	}
+	return nil
+}
+
+// containsIP 判断 ips 中是否包含 ip
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, item := range ips {
+		if item.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// listenDNS 在网络的每个网关地址上监听 UDP 53 端口
+func listenDNS(networkName string, servers []net.IP) ([]*net.UDPConn, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("network %s does not support embedded dns", networkName)
+	}
+	conns := make([]*net.UDPConn, 0, len(servers))
+	for _, server := range servers {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: server, Port: dnsPort})
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, errors.Wrapf(err, "listen dns on %s failed", server)
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// serve 读取查询报文并处理，连接关闭时返回
+func (s *dnsServer) serve(conn *net.UDPConn) {
+	buf := make([]byte, dnsMaxMessageLen)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.Errorf("read dns query failed, detail: %v", err)
+			}
+			return
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		go s.handle(conn, addr, msg)
+	}
+}
+
+// handle 回复网络中容器名和别名的 A/AAAA 查询，其余查询转发给上游服务器，内部网络拒绝其余查询
+func (s *dnsServer) handle(conn *net.UDPConn, addr *net.UDPAddr, msg []byte) {
+	if len(msg) < dnsHeaderLen {
+		return
+	}
+	q, err := parseDNSQuery(msg)
+	if err == nil && q.Class == dnsClassIN && (q.Type == dnsTypeA || q.Type == dnsTypeAAAA) {
+		if ips, found := s.lookup(addr.IP, q.Name, q.Type); found {
+			// 容器存在但没有对应地址族的地址时返回空的回复
+			_, _ = conn.WriteToUDP(buildDNSResponse(msg, q, dnsRcodeSuccess, ips), addr)
+			return
+		}
+	}
+	if s.internal {
+		// 无法解析的报文直接丢弃
+		if q != nil {
+			_, _ = conn.WriteToUDP(buildDNSResponse(msg, q, dnsRcodeRefused, nil), addr)
+		}
+		return
+	}
+	resp, err := s.forward(msg)
+	if err != nil {
+		logrus.Warnf("forward dns query failed, detail: %v", err)
+		if q != nil {
+			_, _ = conn.WriteToUDP(buildDNSResponse(msg, q, dnsRcodeServFail, nil), addr)
+		}
+		return
+	}
+	_, _ = conn.WriteToUDP(resp, addr)
+}
+
+// lookup 查找容器名或别名为 name 的容器，返回 qtype 对应地址族的地址
+// 查询方同时连接了多个网络时，可以解析到这些网络中的所有容器，返回目标容器在共同网络中的地址
+func (s *dnsServer) lookup(client net.IP, name string, qtype uint16) ([]net.IP, bool) {
+	infos, err := container.ListInfos()
+	if err != nil {
+		logrus.Errorf("list container info failed, detail: %v", err)
+		return nil, false
+	}
+	// 查询方容器连接的网络
+	networks := map[string]bool{s.network: true}
+	for _, info := range infos {
+		if ep := info.Endpoint(s.network); ep != nil && endpointHasIP(ep, client) {
+			for _, other := range info.Endpoints {
+				networks[other.Network] = true
+			}
+		}
+	}
+	var ips []net.IP
+	found := false
+	for _, info := range infos {
+		for _, ep := range info.Endpoints {
+			if !networks[ep.Network] || !matchName(info, ep, name) {
+				continue
+			}
+			found = true
+			address := ep.IP
+			if qtype == dnsTypeAAAA {
+				address = ep.IPv6
+			}
+			// 同一个容器只返回一个地址
+			if ip := net.ParseIP(address); ip != nil {
+				ips = append(ips, ip)
+				break
+			}
+		}
+	}
+	return ips, found
+}
+
+// endpointHasIP 判断网络端点的地址是否为 ip
+func endpointHasIP(ep *container.Endpoint, ip net.IP) bool {
+	return ip.Equal(net.ParseIP(ep.IP)) || ip.Equal(net.ParseIP(ep.IPv6))
+}
+
+// matchName 判断容器名或容器在网络中的别名是否为 name
+func matchName(info *container.Info, ep *container.Endpoint, name string) bool {
+	if strings.EqualFold(info.Name, name) {
+		return true
+	}
+	for _, alias := range ep.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward 依次尝试上游服务器，返回第一个成功的回复
+func (s *dnsServer) forward(msg []byte) ([]byte, error) {
+	var lastErr error
+	for _, upstream := range s.upstreams {
+		resp, err := exchange(net.JoinHostPort(upstream, strconv.Itoa(dnsPort)), msg)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchange 向 DNS 服务器发送查询并等待回复
+func exchange(server string, msg []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", server, dnsForwardTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial %s failed", server)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(dnsForwardTimeout))
+	if _, err = conn.Write(msg); err != nil {
+		return nil, errors.Wrapf(err, "send query to %s failed", server)
+	}
+	buf := make([]byte, dnsMaxMessageLen)
+	// 丢弃 ID 不匹配的回复
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read reply from %s failed", server)
+		}
+		if n >= dnsHeaderLen && bytes.Equal(buf[:2], msg[:2]) {
+			return buf[:n], nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 内置 DNS 只需要解析查询中的问题并构造 A/AAAA 回复，其余报文原样转发给上游服务器，这里只实现用到的部分
+const (
+	dnsHeaderLen = 12
+
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeRefused  = 5
+
+	// dnsTTL 回复中记录的有效时间，容器重启后地址会变化，不宜缓存太久
+	dnsTTL = 60
+)
+
+// dnsQuestion 查询报文中的问题
+type dnsQuestion struct {
+	Name  string // 查询的域名，统一为小写且不带末尾的点
+	Type  uint16
+	Class uint16
+	raw   []byte // 问题部分的原始内容，回复时原样带回
+}
+
+// parseDNSQuery 解析只包含一个问题的查询报文
+func parseDNSQuery(msg []byte) (*dnsQuestion, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, fmt.Errorf("dns message too short")
+	}
+	if msg[2]&0x80 != 0 {
+		return nil, fmt.Errorf("dns message is not a query")
+	}
+	if count := binary.BigEndian.Uint16(msg[4:]); count != 1 {
+		return nil, fmt.Errorf("dns query has %d questions", count)
+	}
+	offset := dnsHeaderLen
+	labels := make([]string, 0, 4)
+	for {
+		if offset >= len(msg) {
+			return nil, fmt.Errorf("dns question name is truncated")
+		}
+		length := int(msg[offset])
+		if length == 0 {
+			offset++
+			break
+		}
+		// 查询报文的问题部分不会使用压缩指针
+		if length&0xc0 != 0 {
+			return nil, fmt.Errorf("unsupported dns label type %#x", length&0xc0)
+		}
+		if offset+1+length > len(msg) {
+			return nil, fmt.Errorf("dns question name is truncated")
+		}
+		labels = append(labels, string(msg[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	if offset+4 > len(msg) {
+		return nil, fmt.Errorf("dns question is truncated")
+	}
+	return &dnsQuestion{
+		Name:  strings.ToLower(strings.Join(labels, ".")),
+		Type:  binary.BigEndian.Uint16(msg[offset:]),
+		Class: binary.BigEndian.Uint16(msg[offset+2:]),
+		raw:   msg[dnsHeaderLen : offset+4],
+	}, nil
+}
+
+// buildDNSResponse 根据查询报文构造回复，ips 中的 IPv4 地址作为 A 记录，IPv6 地址作为 AAAA 记录
+func buildDNSResponse(query []byte, q *dnsQuestion, rcode byte, ips []net.IP) []byte {
+	resp := make([]byte, dnsHeaderLen, dnsHeaderLen+len(q.raw)+len(ips)*28)
+	// 沿用查询的 ID、Opcode 和 RD，设置 QR 和 AA
+	copy(resp, query[:2])
+	resp[2] = 0x80 | 0x04 | query[2]&0x79
+	// RA 以及返回码
+	resp[3] = 0x80 | rcode&0x0f
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(ips)))
+	resp = append(resp, q.raw...)
+	for _, ip := range ips {
+		recordType, data := uint16(dnsTypeAAAA), ip.To16()
+		if v4 := ip.To4(); v4 != nil {
+			recordType, data = dnsTypeA, v4
+		}
+		// 记录名使用指向问题中域名的压缩指针
+		resp = append(resp, 0xc0, dnsHeaderLen)
+		resp = binary.BigEndian.AppendUint16(resp, recordType)
+		resp = binary.BigEndian.AppendUint16(resp, dnsClassIN)
+		resp = binary.BigEndian.AppendUint32(resp, dnsTTL)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(data)))
+		resp = append(resp, data...)
+	}
+	return resp
+}
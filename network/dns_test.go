@@ -0,0 +1,147 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newDNSQuery 构造只包含一个问题的查询报文
+func newDNSQuery(id uint16, name string, qtype uint16) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	// RD=1，一个问题
+	msg = append(msg, 0x01, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0)
+	for _, label := range bytes.Split([]byte(name), []byte(".")) {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN)
+}
+
+func TestParseDNSQuery(t *testing.T) {
+	q, err := parseDNSQuery(newDNSQuery(1, "Web.Example", dnsTypeAAAA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "web.example" || q.Type != dnsTypeAAAA || q.Class != dnsClassIN {
+		t.Fatalf("parse query got %+v", q)
+	}
+
+	valid := newDNSQuery(1, "web", dnsTypeA)
+	reply := append([]byte{}, valid...)
+	reply[2] |= 0x80
+	twoQuestions := append([]byte{}, valid...)
+	twoQuestions[5] = 2
+	compressed := append(append([]byte{}, valid[:dnsHeaderLen]...), 0xc0, 0x0c, 0, 1, 0, 1)
+	for _, msg := range [][]byte{valid[:8], valid[:len(valid)-2], valid[:dnsHeaderLen+2], reply, twoQuestions, compressed} {
+		if _, err := parseDNSQuery(msg); err == nil {
+			t.Fatalf("parse malformed query %v should fail", msg)
+		}
+	}
+}
+
+func TestBuildDNSResponse(t *testing.T) {
+	query := newDNSQuery(0x1234, "web", dnsTypeA)
+	q, err := parseDNSQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := buildDNSResponse(query, q, dnsRcodeSuccess, []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fd00::2")})
+	if binary.BigEndian.Uint16(resp) != 0x1234 {
+		t.Fatalf("response id should match query")
+	}
+	// QR、AA、RD、RA 以及返回码
+	if resp[2] != 0x85 || resp[3] != 0x80 {
+		t.Fatalf("response flags are %#x %#x", resp[2], resp[3])
+	}
+	if binary.BigEndian.Uint16(resp[4:]) != 1 || binary.BigEndian.Uint16(resp[6:]) != 2 {
+		t.Fatalf("response should have 1 question and 2 answers")
+	}
+	offset := dnsHeaderLen + len(q.raw)
+	if !bytes.Equal(resp[dnsHeaderLen:offset], q.raw) {
+		t.Fatalf("response should carry the question")
+	}
+	answers := []struct {
+		rtype uint16
+		data  []byte
+	}{
+		{dnsTypeA, net.ParseIP("10.0.0.2").To4()},
+		{dnsTypeAAAA, net.ParseIP("fd00::2").To16()},
+	}
+	for _, answer := range answers {
+		record := resp[offset:]
+		if record[0] != 0xc0 || record[1] != dnsHeaderLen {
+			t.Fatalf("answer name should point to the question")
+		}
+		if binary.BigEndian.Uint16(record[2:]) != answer.rtype || binary.BigEndian.Uint32(record[6:]) != dnsTTL {
+			t.Fatalf("answer type or ttl is wrong: %v", record[:10])
+		}
+		length := int(binary.BigEndian.Uint16(record[10:]))
+		if !bytes.Equal(record[12:12+length], answer.data) {
+			t.Fatalf("answer data is %v, want %v", record[12:12+length], answer.data)
+		}
+		offset += 12 + length
+	}
+	if offset != len(resp) {
+		t.Fatalf("response has %d trailing bytes", len(resp)-offset)
+	}
+
+	failed := buildDNSResponse(query, q, dnsRcodeServFail, nil)
+	if failed[3]&0x0f != dnsRcodeServFail || binary.BigEndian.Uint16(failed[6:]) != 0 {
+		t.Fatalf("servfail response should have no answers")
+	}
+}
+
+func TestInternalDNSRefuseForward(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 内部网络没有上游服务器，不存在的容器名不能转发出去
+	s := &dnsServer{network: "testinternal", internal: true}
+	s.handle(server, client.LocalAddr().(*net.UDPAddr), newDNSQuery(0x4321, "example.com", dnsTypeA))
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, dnsMaxMessageLen)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("read reply of internal dns error %v", err)
+	}
+	if binary.BigEndian.Uint16(buf) != 0x4321 || buf[3]&0x0f != dnsRcodeRefused || binary.BigEndian.Uint16(buf[6:]) != 0 {
+		t.Fatalf("internal dns should refuse query, got %v", buf[:n])
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	content := `# generated
+nameserver 127.0.0.53
+nameserver fd00::53
+search a.example b.example
+; comment
+options edns0 trust-ad
+options ndots:2
+`
+	conf := parseResolvConf(content)
+	want := &resolvConf{
+		Nameservers: []string{"127.0.0.53", "fd00::53"},
+		Search:      []string{"a.example", "b.example"},
+		Options:     []string{"edns0", "trust-ad", "ndots:2"},
+	}
+	if !reflect.DeepEqual(conf, want) {
+		t.Fatalf("parse resolv.conf got %+v, want %+v", conf, want)
+	}
+	if conf = parseResolvConf("search a.example\ndomain c.example\n"); !reflect.DeepEqual(conf.Search, []string{"c.example"}) {
+		t.Fatalf("the last of search and domain should win, got %v", conf.Search)
+	}
+}
@@ -0,0 +1,314 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// tiny-docker 的规则只会添加到专用链中，内置链中只有跳转到专用链的规则
+// 部分失败或容器异常退出时残留的规则可以通过清空专用链后重建的方式清除
+const (
+	// chainDNAT nat 表中端口映射的 DNAT 规则，PREROUTING 和 OUTPUT 中目的地址为本机地址的报文跳转到这里
+	chainDNAT = "TINY-DOCKER"
+	// chainPostrouting nat 表中网络的 MASQUERADE 规则，POSTROUTING 跳转到这里
+	chainPostrouting = "TINY-DOCKER-POSTROUTING"
+	// chainIsolation1 filter 表中网络之间以及网络内部的隔离规则，FORWARD 跳转到这里
+	// 从网络的网桥转发到其他网卡的报文会跳转到 chainIsolation2 检查出口是否为其他网络的网桥
+	chainIsolation1 = "TINY-DOCKER-ISOLATION-STAGE-1"
+	// chainIsolation2 filter 表中丢弃转发到任意网络网桥的报文
+	chainIsolation2 = "TINY-DOCKER-ISOLATION-STAGE-2"
+)
+
+// firewallChains 全部专用链
+var firewallChains = []string{chainDNAT, chainPostrouting, chainIsolation1, chainIsolation2}
+
+// chainTable 返回专用链所在的表
+func chainTable(chain string) string {
+	switch chain {
+	case chainIsolation1, chainIsolation2:
+		return "filter"
+	default:
+		return "nat"
+	}
+}
+
+// 防火墙后端
+const (
+	FirewallAuto     = "auto" // 内核支持时使用 nftables，否则使用 iptables
+	FirewallIPTables = "iptables"
+	FirewallNFTables = "nftables"
+)
+
+// firewallConfigPath 保存宿主机使用的防火墙后端
+var firewallConfigPath = "/var/lib/tiny-docker/network/firewall"
+
+// rule 一条规则，由防火墙后端转换为 iptables 参数或者 nftables 表达式
+type rule struct {
+	chain       string
+	ipv6        bool       // 规则属于 IPv6 地址族
+	src         *net.IPNet // 匹配的源地址段
+	dst         net.IP     // 匹配的目的地址
+	inIface     string     // 匹配的入口网卡
+	notInIface  bool       // 匹配入口不是 inIface 的报文
+	outIface    string     // 匹配的出口网卡
+	notOutIface bool       // 匹配出口不是 outIface 的报文
+	ctDNAT      bool       // 只匹配经过 DNAT 的连接
+	proto       string     // 匹配的协议，tcp、udp 或 sctp
+	dport       int        // 匹配的目的端口，需要同时指定 proto
+
+	masquerade bool   // 将源地址转换为出口网卡的地址
+	dnatIP     net.IP // DNAT 的目的地址
+	dnatPort   int    // DNAT 的目的端口
+	drop       bool   // 丢弃报文
+	jump       string // 跳转到另一条专用链
+}
+
+// firewall 防火墙后端，每条规则都带有所属对象的标记，例如 network:testnet，便于找到并删除
+type firewall interface {
+	// name 后端名
+	name() string
+	// setup 幂等地创建专用链以及内置链到专用链的跳转
+	setup() error
+	// flush 清空专用链中的所有规则
+	flush() error
+	// addRules 添加 owner 的规则
+	addRules(owner string, rules []*rule) error
+	// deleteRules 删除 owner 的规则，规则不存在时忽略
+	deleteRules(owner string, rules []*rule) error
+}
+
+// FirewallInfo 宿主机的防火墙后端
+type FirewallInfo struct {
+	Backend string `json:"backend"` // 配置的后端，auto、iptables 或者 nftables
+	Active  string `json:"active"`  // 实际使用的后端，nftables 不可用时回退到 iptables
+}
+
+// GetFirewallInfo 返回宿主机配置的防火墙后端以及实际使用的后端
+func GetFirewallInfo() (*FirewallInfo, error) {
+	info := &FirewallInfo{Backend: FirewallAuto}
+	content, err := os.ReadFile(firewallConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "read %s failed", firewallConfigPath)
+	}
+	if backend := strings.TrimSpace(string(content)); backend != "" {
+		info.Backend = backend
+	}
+	switch info.Backend {
+	case FirewallIPTables:
+		info.Active = FirewallIPTables
+	case FirewallAuto, FirewallNFTables:
+		info.Active = FirewallNFTables
+		// nftables 不可用时回退到 iptables
+		if err = (&nftablesFirewall{}).available(); err != nil {
+			if info.Backend == FirewallNFTables {
+				logrus.Warnf("nftables is not available, fall back to iptables: %v", err)
+			}
+			info.Active = FirewallIPTables
+		}
+	default:
+		return nil, fmt.Errorf("unknown firewall backend %s in %s", info.Backend, firewallConfigPath)
+	}
+	return info, nil
+}
+
+// SetFirewallBackend 修改宿主机使用的防火墙后端，并将现有的规则迁移到新的后端
+func SetFirewallBackend(backend string) error {
+	if backend != FirewallAuto && backend != FirewallIPTables && backend != FirewallNFTables {
+		return fmt.Errorf("unknown firewall backend %s, should be one of auto, iptables, nftables", backend)
+	}
+	if err := os.MkdirAll(path.Dir(firewallConfigPath), constant.Perm0755); err != nil {
+		return errors.Wrapf(err, "create dir of %s failed", firewallConfigPath)
+	}
+	if err := os.WriteFile(firewallConfigPath, []byte(backend+"\n"), constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", firewallConfigPath)
+	}
+	return Reconcile()
+}
+
+// getFirewall 返回当前使用的防火墙后端
+func getFirewall() (firewall, error) {
+	info, err := GetFirewallInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.Active == FirewallNFTables {
+		return &nftablesFirewall{}, nil
+	}
+	return &iptablesFirewall{}, nil
+}
+
+// addFirewallRules 通过当前的防火墙后端添加 owner 的规则
+func addFirewallRules(owner string, rules []*rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	fw, err := getFirewall()
+	if err != nil {
+		return err
+	}
+	if err = fw.setup(); err != nil {
+		return errors.WithMessagef(err, "setup %s chains failed", fw.name())
+	}
+	return fw.addRules(owner, rules)
+}
+
+// deleteFirewallRules 通过当前的防火墙后端删除 owner 的规则
+func deleteFirewallRules(owner string, rules []*rule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	fw, err := getFirewall()
+	if err != nil {
+		return err
+	}
+	return fw.deleteRules(owner, rules)
+}
+
+// networkOwner 网络规则的标记
+func networkOwner(networkName string) string {
+	return "network:" + networkName
+}
+
+// endpointOwner 网络端点规则的标记
+func endpointOwner(endpointId string) string {
+	return "endpoint:" + endpointId
+}
+
+// networkRules 返回 bridge 网络的 MASQUERADE 规则和隔离规则，网络开启了 IPv6 时两个地址族各有一组规则
+func networkRules(nw *Network) []*rule {
+	var rules []*rule
+	for _, ipRange := range nw.ipRanges() {
+		// 规则中使用网段地址，而不是 IPRange 中的网关地址
+		subnet := &net.IPNet{IP: ipRange.IP.Mask(ipRange.Mask), Mask: ipRange.Mask}
+		ipv6 := ipRange.IP.To4() == nil
+		// 内部网络的容器不能访问外部网络，也不支持端口映射，不需要 nat 规则
+		if !nw.Internal {
+			rules = append(rules,
+				// 容器访问外网时将源地址转换为宿主机地址
+				&rule{chain: chainPostrouting, ipv6: ipv6, src: subnet, outIface: nw.Bridge, notOutIface: true, masquerade: true},
+				// 容器通过映射的端口访问同一网桥上的容器(包括自己)时，将源地址转换为网关地址
+				// 这样响应会先回到宿主机还原 DNAT，而不是由目的容器直接发回给源容器
+				&rule{chain: chainPostrouting, ipv6: ipv6, src: subnet, outIface: nw.Bridge, ctDNAT: true, masquerade: true},
+			)
+			// 宿主机通过 127.0.0.1 访问映射的端口时，容器无法响应 127.0.0.1，同样转换为网关地址
+			if !ipv6 {
+				_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+				rules = append(rules, &rule{chain: chainPostrouting, src: loopback, outIface: nw.Bridge, masquerade: true})
+			}
+		}
+
+		rules = append(rules,
+			// 从这个网络转发出去的报文，如果出口是其他网络的网桥就丢弃
+			&rule{chain: chainIsolation1, ipv6: ipv6, inIface: nw.Bridge, outIface: nw.Bridge, notOutIface: true, jump: chainIsolation2},
+			&rule{chain: chainIsolation2, ipv6: ipv6, outIface: nw.Bridge, drop: true},
+		)
+		// 内部网络只允许网络内部的通信
+		if nw.Internal {
+			rules = append(rules,
+				&rule{chain: chainIsolation1, ipv6: ipv6, inIface: nw.Bridge, outIface: nw.Bridge, notOutIface: true, drop: true},
+				&rule{chain: chainIsolation1, ipv6: ipv6, inIface: nw.Bridge, notInIface: true, outIface: nw.Bridge, drop: true},
+			)
+		}
+		// 禁止同一网络中的容器互相访问
+		if !nw.icc() {
+			rules = append(rules, &rule{chain: chainIsolation1, ipv6: ipv6, inIface: nw.Bridge, outIface: nw.Bridge, drop: true})
+		}
+	}
+	return rules
+}
+
+// portMappingRules 返回网络端点端口映射的 DNAT 规则
+// 访问宿主机端口的请求会被转发到容器的地址和端口上，包括宿主机自己和同一网桥上的容器发出的请求
+func portMappingRules(ep *Endpoint) []*rule {
+	var rules []*rule
+	for _, pm := range ep.PortMapping {
+		bindings, err := ParsePortMapping(pm)
+		if err != nil {
+			logrus.Errorf("port mapping format error, %v", err)
+			continue
+		}
+		for _, binding := range bindings {
+			for _, family := range ep.addressFamilies() {
+				// 指定了宿主机地址时只配置对应地址族的规则
+				hostIP := net.ParseIP(binding.HostIP)
+				if hostIP != nil && (hostIP.To4() == nil) != (family.ip.To4() == nil) {
+					continue
+				}
+				rules = append(rules, &rule{
+					chain:    chainDNAT,
+					ipv6:     family.ip.To4() == nil,
+					dst:      hostIP,
+					proto:    binding.Proto,
+					dport:    binding.HostPort,
+					dnatIP:   family.ip,
+					dnatPort: binding.ContainerPort,
+				})
+			}
+		}
+	}
+	return rules
+}
+
+// Reconcile 清空专用链后根据记录的网络和网络端点重建规则，清除部分失败或容器异常退出时残留的规则
+// 同时释放不再被任何网络端点使用的宿主机端口，只在 daemon 启动和切换后端时调用，此时不应有正在连接网络的容器
+func Reconcile() error {
+	fw, err := getFirewall()
+	if err != nil {
+		return err
+	}
+	if err = fw.setup(); err != nil {
+		return errors.WithMessagef(err, "setup %s chains failed", fw.name())
+	}
+	if err = fw.flush(); err != nil {
+		return errors.WithMessagef(err, "flush %s chains failed", fw.name())
+	}
+	// 切换过后端时，另一个后端中可能还有之前的规则
+	for _, other := range []firewall{&iptablesFirewall{}, &nftablesFirewall{}} {
+		if other.name() != fw.name() {
+			if err := other.flush(); err != nil {
+				logrus.Debugf("flush %s chains, detail: %v", other.name(), err)
+			}
+		}
+	}
+
+	networks, err := loadNetwork()
+	if err != nil {
+		return errors.WithMessage(err, "load network from file failed")
+	}
+	for _, nw := range networks {
+		if nw.Driver != (&BridgeNetworkDriver{}).Name() {
+			continue
+		}
+		if err = fw.addRules(networkOwner(nw.Name), networkRules(nw)); err != nil {
+			logrus.Errorf("restore rules of network %s failed, detail: %v", nw.Name, err)
+		}
+	}
+
+	infos, err := container.ListInfos()
+	if err != nil {
+		return errors.WithMessage(err, "list container info failed")
+	}
+	endpoints := map[string]bool{}
+	for _, info := range infos {
+		for _, record := range info.Endpoints {
+			nw, ok := networks[record.Network]
+			if !ok {
+				continue
+			}
+			ep := endpointFromRecord(info, record, nw)
+			endpoints[ep.ID] = true
+			if err = fw.addRules(endpointOwner(ep.ID), portMappingRules(ep)); err != nil {
+				logrus.Errorf("restore port mapping of endpoint %s failed, detail: %v", ep.ID, err)
+			}
+		}
+	}
+	return portAllocator.retain(endpoints)
+}
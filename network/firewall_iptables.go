@@ -0,0 +1,185 @@
+package network
+
+import (
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var _ firewall = (*iptablesFirewall)(nil)
+
+// iptablesFirewall 通过 iptables 和 ip6tables 命令配置规则，规则使用 -m comment 记录所属对象
+type iptablesFirewall struct {
+}
+
+// iptablesJump 内置链到专用链的跳转规则
+type iptablesJump struct {
+	table  string
+	chain  string
+	insert bool // 插入到内置链的最前面，避免报文先被其他规则接受
+	args   []string
+}
+
+// 专用链以及跳转到专用链的规则，DNAT 只处理目的地址为本机地址的报文
+var iptablesJumps = []iptablesJump{
+	{table: "nat", chain: "PREROUTING", args: []string{"-m", "addrtype", "--dst-type", "LOCAL", "-j", chainDNAT}},
+	{table: "nat", chain: "OUTPUT", args: []string{"-m", "addrtype", "--dst-type", "LOCAL", "-j", chainDNAT}},
+	{table: "nat", chain: "POSTROUTING", args: []string{"-j", chainPostrouting}},
+	{table: "filter", chain: "FORWARD", insert: true, args: []string{"-j", chainIsolation1}},
+}
+
+func (f *iptablesFirewall) name() string {
+	return FirewallIPTables
+}
+
+// setup 创建专用链并在内置链中添加跳转规则，已经存在时不会重复添加
+// 宿主机不支持 IPv6 时只打印 ip6tables 的错误
+func (f *iptablesFirewall) setup() error {
+	for _, command := range []string{"iptables", "ip6tables"} {
+		err := setupIPTablesChains(command)
+		if err == nil {
+			continue
+		}
+		if command == "iptables" {
+			return err
+		}
+		logrus.Warnf("setup ip6tables chains failed, IPv6 rules will not work, detail: %v", err)
+	}
+	return nil
+}
+
+func setupIPTablesChains(command string) error {
+	for _, chain := range firewallChains {
+		// iptables -t nat -L TINY-DOCKER -n 检查链是否存在
+		if runIPTables(command, "-t", chainTable(chain), "-L", chain, "-n") == nil {
+			continue
+		}
+		if err := runIPTables(command, "-t", chainTable(chain), "-N", chain); err != nil {
+			return err
+		}
+	}
+	for _, jump := range iptablesJumps {
+		// iptables -C 检查规则是否存在
+		check := append([]string{"-t", jump.table, "-C", jump.chain}, jump.args...)
+		if runIPTables(command, check...) == nil {
+			continue
+		}
+		action := "-A"
+		if jump.insert {
+			action = "-I"
+		}
+		add := append([]string{"-t", jump.table, action, jump.chain}, jump.args...)
+		if err := runIPTables(command, add...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush 清空专用链，链不存在时忽略
+func (f *iptablesFirewall) flush() error {
+	for _, command := range []string{"iptables", "ip6tables"} {
+		for _, chain := range firewallChains {
+			if runIPTables(command, "-t", chainTable(chain), "-L", chain, "-n") != nil {
+				continue
+			}
+			if err := runIPTables(command, "-t", chainTable(chain), "-F", chain); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *iptablesFirewall) addRules(owner string, rules []*rule) error {
+	for _, r := range rules {
+		args := append([]string{"-t", chainTable(r.chain), "-A", r.chain}, r.iptablesArgs(owner)...)
+		if err := runIPTables(r.iptablesCommand(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRules 删除规则，iptables 返回 1 表示规则不存在，此时继续删除剩下的规则
+func (f *iptablesFirewall) deleteRules(owner string, rules []*rule) error {
+	for _, r := range rules {
+		args := append([]string{"-t", chainTable(r.chain), "-D", r.chain}, r.iptablesArgs(owner)...)
+		err := runIPTables(r.iptablesCommand(), args...)
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesCommand 根据地址族返回配置规则使用的命令，IPv6 规则需要通过 ip6tables 配置
+func (r *rule) iptablesCommand() string {
+	if r.ipv6 {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// iptablesArgs 返回规则的匹配条件和动作，例如
+// -s 172.18.0.0/24 ! -o tdbr0123456789a -m comment --comment network:testnet -j MASQUERADE
+// -p tcp -m tcp --dport 8080 -m comment --comment endpoint:xxx -j DNAT --to-destination 172.18.0.2:80
+// -i tdbr0123456789a -o tdbr0123456789a -m comment --comment network:testnet -j DROP
+func (r *rule) iptablesArgs(owner string) []string {
+	var args []string
+	if r.src != nil {
+		args = append(args, "-s", r.src.String())
+	}
+	if r.dst != nil {
+		args = append(args, "-d", r.dst.String())
+	}
+	if r.inIface != "" {
+		if r.notInIface {
+			args = append(args, "!")
+		}
+		args = append(args, "-i", r.inIface)
+	}
+	if r.outIface != "" {
+		if r.notOutIface {
+			args = append(args, "!")
+		}
+		args = append(args, "-o", r.outIface)
+	}
+	if r.ctDNAT {
+		args = append(args, "-m", "conntrack", "--ctstate", "DNAT")
+	}
+	if r.proto != "" {
+		args = append(args, "-p", r.proto)
+		if r.dport != 0 {
+			args = append(args, "-m", r.proto, "--dport", strconv.Itoa(r.dport))
+		}
+	}
+	args = append(args, "-m", "comment", "--comment", owner)
+	switch {
+	case r.masquerade:
+		args = append(args, "-j", "MASQUERADE")
+	case r.dnatIP != nil:
+		args = append(args, "-j", "DNAT", "--to-destination", net.JoinHostPort(r.dnatIP.String(), strconv.Itoa(r.dnatPort)))
+	case r.drop:
+		args = append(args, "-j", "DROP")
+	case r.jump != "":
+		args = append(args, "-j", r.jump)
+	}
+	return args
+}
+
+// runIPTables 执行 iptables 命令，出错时返回命令的输出
+func runIPTables(command string, args ...string) error {
+	cmd := exec.Command(command, args...)
+	logrus.Debugf("iptables cmd: %v", cmd.String())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s failed: %s", cmd.String(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package network
+
+import (
+	"net"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var _ firewall = (*nftablesFirewall)(nil)
+
+// nftablesFirewall 通过 netlink 直接配置 nftables 规则，不依赖 nft 命令
+// 所有规则都在 inet 族的 tiny-docker 表中，同时处理 IPv4 和 IPv6，规则的注释中记录所属对象
+// 相当于
+//
+//	table inet tiny-docker {
+//		chain prerouting { type nat hook prerouting priority dstnat; fib daddr type local jump TINY-DOCKER }
+//		chain output { type nat hook output priority -100; fib daddr type local jump TINY-DOCKER }
+//		chain postrouting { type nat hook postrouting priority srcnat; jump TINY-DOCKER-POSTROUTING }
+//		chain forward { type filter hook forward priority filter; jump TINY-DOCKER-ISOLATION-STAGE-1 }
+//		chain TINY-DOCKER { ... }
+//		chain TINY-DOCKER-POSTROUTING { ... }
+//		chain TINY-DOCKER-ISOLATION-STAGE-1 { ... }
+//		chain TINY-DOCKER-ISOLATION-STAGE-2 { ... }
+//	}
+type nftablesFirewall struct {
+}
+
+const nftablesTableName = "tiny-docker"
+
+var nftablesTable = &nftables.Table{Name: nftablesTableName, Family: nftables.TableFamilyINet}
+
+// nftablesBaseChain 挂载到 netfilter hook 上的链，以及它跳转到的专用链
+type nftablesBaseChain struct {
+	chain     *nftables.Chain
+	localOnly bool // 只跳转目的地址为本机地址的报文
+	jump      string
+}
+
+var nftablesBaseChains = []nftablesBaseChain{
+	{
+		chain: &nftables.Chain{Name: "prerouting", Table: nftablesTable, Type: nftables.ChainTypeNAT,
+			Hooknum: nftables.ChainHookPrerouting, Priority: nftables.ChainPriorityNATDest},
+		localOnly: true,
+		jump:      chainDNAT,
+	},
+	{
+		chain: &nftables.Chain{Name: "output", Table: nftablesTable, Type: nftables.ChainTypeNAT,
+			Hooknum: nftables.ChainHookOutput, Priority: nftables.ChainPriorityNATDest},
+		localOnly: true,
+		jump:      chainDNAT,
+	},
+	{
+		chain: &nftables.Chain{Name: "postrouting", Table: nftablesTable, Type: nftables.ChainTypeNAT,
+			Hooknum: nftables.ChainHookPostrouting, Priority: nftables.ChainPriorityNATSource},
+		jump: chainPostrouting,
+	},
+	{
+		chain: &nftables.Chain{Name: "forward", Table: nftablesTable, Type: nftables.ChainTypeFilter,
+			Hooknum: nftables.ChainHookForward, Priority: nftables.ChainPriorityFilter},
+		jump: chainIsolation1,
+	},
+}
+
+// nftablesChain 返回 tiny-docker 表中的专用链
+func nftablesChain(name string) *nftables.Chain {
+	return &nftables.Chain{Name: name, Table: nftablesTable}
+}
+
+func (f *nftablesFirewall) name() string {
+	return FirewallNFTables
+}
+
+// available 检查内核是否支持通过 netlink 配置 nftables
+func (f *nftablesFirewall) available() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	_, err = conn.ListTablesOfFamily(nftables.TableFamilyINet)
+	return err
+}
+
+// tableExists 检查 tiny-docker 表是否已经创建
+func (f *nftablesFirewall) tableExists(conn *nftables.Conn) (bool, error) {
+	tables, err := conn.ListTablesOfFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return false, errors.Wrap(err, "list nftables tables failed")
+	}
+	for _, table := range tables {
+		if table.Name == nftablesTableName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setup 创建表和链，并在同一个批次中重建基础链中的跳转规则，重复执行不会产生重复的规则
+func (f *nftablesFirewall) setup() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	conn.AddTable(nftablesTable)
+	for _, name := range firewallChains {
+		conn.AddChain(nftablesChain(name))
+	}
+	for _, base := range nftablesBaseChains {
+		conn.AddChain(base.chain)
+		conn.FlushChain(base.chain)
+		var exprs []expr.Any
+		if base.localOnly {
+			// fib daddr type local
+			exprs = append(exprs,
+				&expr.Fib{Register: 1, FlagDADDR: true, ResultADDRTYPE: true},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(unix.RTN_LOCAL)},
+			)
+		}
+		exprs = append(exprs, &expr.Verdict{Kind: expr.VerdictJump, Chain: base.jump})
+		conn.AddRule(&nftables.Rule{Table: nftablesTable, Chain: base.chain, Exprs: exprs})
+	}
+	return errors.Wrap(conn.Flush(), "setup nftables chains failed")
+}
+
+// flush 清空专用链，表不存在时忽略
+func (f *nftablesFirewall) flush() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	exists, err := f.tableExists(conn)
+	if err != nil || !exists {
+		return err
+	}
+	for _, name := range firewallChains {
+		conn.FlushChain(nftablesChain(name))
+	}
+	return errors.Wrap(conn.Flush(), "flush nftables chains failed")
+}
+
+// addRules 在同一个批次中添加全部规则，任意一条失败时都不会添加
+func (f *nftablesFirewall) addRules(owner string, rules []*rule) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		conn.AddRule(&nftables.Rule{
+			Table:    nftablesTable,
+			Chain:    nftablesChain(r.chain),
+			Exprs:    r.nftablesExprs(),
+			UserData: userdata.AppendString(nil, userdata.TypeComment, owner),
+		})
+	}
+	return errors.Wrapf(conn.Flush(), "add nftables rules of %s failed", owner)
+}
+
+// deleteRules 根据规则注释中记录的所属对象删除规则，不需要规则的内容
+func (f *nftablesFirewall) deleteRules(owner string, _ []*rule) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	exists, err := f.tableExists(conn)
+	if err != nil || !exists {
+		return err
+	}
+	for _, name := range firewallChains {
+		rules, err := conn.GetRules(nftablesTable, nftablesChain(name))
+		if err != nil {
+			return errors.Wrapf(err, "list nftables rules of chain %s failed", name)
+		}
+		for _, r := range rules {
+			if comment, ok := userdata.GetString(r.UserData, userdata.TypeComment); ok && comment == owner {
+				if err = conn.DelRule(r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return errors.Wrapf(conn.Flush(), "delete nftables rules of %s failed", owner)
+}
+
+// nftablesExprs 将规则转换为 nftables 表达式，例如
+// meta nfproto ipv4 ip saddr 172.18.0.0/24 oifname != "tdbr0123456789a" masquerade
+// meta nfproto ipv4 meta l4proto tcp tcp dport 8080 dnat ip to 172.18.0.2:80
+func (r *rule) nftablesExprs() []expr.Any {
+	nfproto, addrLen, srcOffset, dstOffset := byte(unix.NFPROTO_IPV4), uint32(net.IPv4len), uint32(12), uint32(16)
+	if r.ipv6 {
+		nfproto, addrLen, srcOffset, dstOffset = unix.NFPROTO_IPV6, net.IPv6len, 8, 24
+	}
+	// inet 表同时处理 IPv4 和 IPv6 报文，先匹配地址族
+	exprs := []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nfproto}},
+	}
+	if r.src != nil {
+		// IPv4 地址段的掩码可能是 16 字节，取最后 addrLen 字节
+		mask := r.src.Mask[len(r.src.Mask)-int(addrLen):]
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: srcOffset, Len: addrLen},
+			&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: addrLen, Mask: mask, Xor: make([]byte, addrLen)},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: nftablesIP(r.src.IP.Mask(r.src.Mask), r.ipv6)},
+		)
+	}
+	if r.dst != nil {
+		exprs = append(exprs,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: dstOffset, Len: addrLen},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: nftablesIP(r.dst, r.ipv6)},
+		)
+	}
+	if r.inIface != "" {
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+			&expr.Cmp{Op: nftablesCmpOp(r.notInIface), Register: 1, Data: nftablesIfname(r.inIface)},
+		)
+	}
+	if r.outIface != "" {
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+			&expr.Cmp{Op: nftablesCmpOp(r.notOutIface), Register: 1, Data: nftablesIfname(r.outIface)},
+		)
+	}
+	if r.ctDNAT {
+		// ct status dnat
+		exprs = append(exprs,
+			&expr.Ct{Register: 1, Key: expr.CtKeySTATUS},
+			&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4,
+				Mask: binaryutil.NativeEndian.PutUint32(ipsDstNAT), Xor: make([]byte, 4)},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: make([]byte, 4)},
+		)
+	}
+	if r.proto != "" {
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nftablesL4Proto(r.proto)}},
+		)
+		if r.dport != 0 {
+			// tcp、udp 和 sctp 的目的端口都在传输层头部偏移 2 字节处
+			exprs = append(exprs,
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(uint16(r.dport))},
+			)
+		}
+	}
+	switch {
+	case r.masquerade:
+		exprs = append(exprs, &expr.Masq{})
+	case r.dnatIP != nil:
+		exprs = append(exprs,
+			&expr.Immediate{Register: 1, Data: nftablesIP(r.dnatIP, r.ipv6)},
+			&expr.Immediate{Register: 2, Data: binaryutil.BigEndian.PutUint16(uint16(r.dnatPort))},
+			// 目的地址和端口都是单个值，范围的上限与下限使用同一个寄存器，与内核返回的规则一致
+			&expr.NAT{Type: expr.NATTypeDestNAT, Family: uint32(nfproto), RegAddrMin: 1, RegAddrMax: 1, RegProtoMin: 2, RegProtoMax: 2},
+		)
+	case r.drop:
+		exprs = append(exprs, &expr.Verdict{Kind: expr.VerdictDrop})
+	case r.jump != "":
+		exprs = append(exprs, &expr.Verdict{Kind: expr.VerdictJump, Chain: r.jump})
+	}
+	return exprs
+}
+
+// ipsDstNAT 连接状态中表示经过 DNAT 的标志位，即内核中的 IPS_DST_NAT
+const ipsDstNAT = 1 << 5
+
+// nftablesIP 返回规则中使用的地址，IPv4 地址为 4 字节
+func nftablesIP(ip net.IP, ipv6 bool) []byte {
+	if ipv6 {
+		return ip.To16()
+	}
+	return ip.To4()
+}
+
+// nftablesCmpOp 返回匹配条件使用的比较方式
+func nftablesCmpOp(not bool) expr.CmpOp {
+	if not {
+		return expr.CmpOpNeq
+	}
+	return expr.CmpOpEq
+}
+
+// nftablesIfname 网卡名需要补齐到 IFNAMSIZ 字节
+func nftablesIfname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
+
+// nftablesL4Proto 返回协议号
+func nftablesL4Proto(proto string) byte {
+	switch proto {
+	case "udp":
+		return unix.IPPROTO_UDP
+	case "sctp":
+		return unix.IPPROTO_SCTP
+	default:
+		return unix.IPPROTO_TCP
+	}
+}
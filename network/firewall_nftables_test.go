@@ -0,0 +1,121 @@
+package network
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/userdata"
+)
+
+// nftablesRulesOf 返回 tiny-docker 表中注释为 owner 的规则，key 为链名
+func nftablesRulesOf(t *testing.T, owner string) map[string][]*nftables.Rule {
+	conn, err := nftables.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string][]*nftables.Rule)
+	for _, name := range firewallChains {
+		rules, err := conn.GetRules(nftablesTable, nftablesChain(name))
+		if err != nil {
+			t.Fatalf("list rules of chain %s error %v", name, err)
+		}
+		for _, r := range rules {
+			if comment, _ := userdata.GetString(r.UserData, userdata.TypeComment); comment == owner {
+				result[name] = append(result[name], r)
+			}
+		}
+	}
+	return result
+}
+
+func TestNFTablesFirewall(t *testing.T) {
+	ip, ipRange, _ := net.ParseCIDR("172.18.0.1/24")
+	ipRange.IP = ip
+	ip6, ipv6Range, _ := net.ParseCIDR("fd00::1/64")
+	ipv6Range.IP = ip6
+	nw := &Network{Name: "testnet", Bridge: "tdbr0123", IPRange: ipRange, IPv6Range: ipv6Range}
+	ep := &Endpoint{
+		ID:          "c1-testnet",
+		IPAddress:   net.ParseIP("172.18.0.2"),
+		IPv6Address: net.ParseIP("fd00::2"),
+		Network:     nw,
+		PortMapping: []string{"8080:80/tcp", "127.0.0.1:5353:53/udp", "[::1]:9090:90/tcp"},
+	}
+
+	withTestNetNS(t, "tdparent0", func() {
+		f := &nftablesFirewall{}
+		if err := f.available(); err != nil {
+			t.Skipf("nftables is not available: %v", err)
+		}
+		// 重复 setup 不会在基础链中产生重复的跳转规则
+		for i := 0; i < 2; i++ {
+			if err := f.setup(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		conn, err := nftables.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, base := range nftablesBaseChains {
+			rules, err := conn.GetRules(nftablesTable, base.chain)
+			if err != nil || len(rules) != 1 {
+				t.Fatalf("base chain %s should have one rule, got %d, %v", base.chain.Name, len(rules), err)
+			}
+		}
+
+		cases := []struct {
+			owner string
+			rules []*rule
+		}{
+			{networkOwner(nw.Name), networkRules(nw)},
+			{endpointOwner(ep.ID), portMappingRules(ep)},
+		}
+		for _, c := range cases {
+			if err := f.addRules(c.owner, c.rules); err != nil {
+				t.Fatal(err)
+			}
+			// 内核返回的表达式与添加时一致，说明 masquerade、ct status dnat 以及 dnat 的地址和端口都按预期下发
+			got := nftablesRulesOf(t, c.owner)
+			for _, r := range c.rules {
+				if len(got[r.chain]) == 0 {
+					t.Fatalf("%s: missing rule %+v in chain %s", c.owner, *r, r.chain)
+				}
+				exprs, want := got[r.chain][0].Exprs, r.nftablesExprs()
+				if len(exprs) != len(want) {
+					t.Fatalf("%s: rule in chain %s has %d expressions, want %d", c.owner, r.chain, len(exprs), len(want))
+				}
+				for i := range want {
+					if !reflect.DeepEqual(exprs[i], want[i]) {
+						t.Fatalf("%s: expression %d of rule in chain %s got %+v, want %+v", c.owner, i, r.chain, exprs[i], want[i])
+					}
+				}
+				got[r.chain] = got[r.chain][1:]
+			}
+			for chain, rules := range got {
+				if len(rules) != 0 {
+					t.Fatalf("%s: chain %s has %d unexpected rules", c.owner, chain, len(rules))
+				}
+			}
+		}
+
+		// 删除一个对象的规则不影响其他对象的规则
+		if err := f.deleteRules(endpointOwner(ep.ID), nil); err != nil {
+			t.Fatal(err)
+		}
+		if rules := nftablesRulesOf(t, endpointOwner(ep.ID)); len(rules) != 0 {
+			t.Fatalf("rules of endpoint should be deleted, got %v", rules)
+		}
+		if rules := nftablesRulesOf(t, networkOwner(nw.Name)); len(rules[chainPostrouting]) == 0 {
+			t.Fatalf("rules of network should be kept after deleting endpoint rules")
+		}
+		if err := f.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if rules := nftablesRulesOf(t, networkOwner(nw.Name)); len(rules) != 0 {
+			t.Fatalf("chains should be empty after flush, got %v", rules)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNetworkRulesIPTablesArgs(t *testing.T) {
+	ip, ipRange, _ := net.ParseCIDR("172.18.0.1/24")
+	ipRange.IP = ip
+	ip6, ipv6Range, _ := net.ParseCIDR("fd00::1/64")
+	ipv6Range.IP = ip6
+
+	cases := []struct {
+		name string
+		nw   *Network
+		want []string // 链名 命令 参数
+	}{
+		{
+			name: "dual stack",
+			nw:   &Network{Name: "testnet", Bridge: "tdbr0123", IPRange: ipRange, IPv6Range: ipv6Range},
+			want: []string{
+				"TINY-DOCKER-POSTROUTING iptables -s 172.18.0.0/24 ! -o tdbr0123 -m comment --comment network:testnet -j MASQUERADE",
+				"TINY-DOCKER-POSTROUTING iptables -s 172.18.0.0/24 -o tdbr0123 -m conntrack --ctstate DNAT -m comment --comment network:testnet -j MASQUERADE",
+				"TINY-DOCKER-POSTROUTING iptables -s 127.0.0.0/8 -o tdbr0123 -m comment --comment network:testnet -j MASQUERADE",
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables -i tdbr0123 ! -o tdbr0123 -m comment --comment network:testnet -j TINY-DOCKER-ISOLATION-STAGE-2",
+				"TINY-DOCKER-ISOLATION-STAGE-2 iptables -o tdbr0123 -m comment --comment network:testnet -j DROP",
+				"TINY-DOCKER-POSTROUTING ip6tables -s fd00::/64 ! -o tdbr0123 -m comment --comment network:testnet -j MASQUERADE",
+				"TINY-DOCKER-POSTROUTING ip6tables -s fd00::/64 -o tdbr0123 -m conntrack --ctstate DNAT -m comment --comment network:testnet -j MASQUERADE",
+				"TINY-DOCKER-ISOLATION-STAGE-1 ip6tables -i tdbr0123 ! -o tdbr0123 -m comment --comment network:testnet -j TINY-DOCKER-ISOLATION-STAGE-2",
+				"TINY-DOCKER-ISOLATION-STAGE-2 ip6tables -o tdbr0123 -m comment --comment network:testnet -j DROP",
+			},
+		},
+		{
+			name: "internal",
+			nw:   &Network{Name: "internal", Bridge: "tdbr4567", IPRange: ipRange, Internal: true},
+			want: []string{
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables -i tdbr4567 ! -o tdbr4567 -m comment --comment network:internal -j TINY-DOCKER-ISOLATION-STAGE-2",
+				"TINY-DOCKER-ISOLATION-STAGE-2 iptables -o tdbr4567 -m comment --comment network:internal -j DROP",
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables -i tdbr4567 ! -o tdbr4567 -m comment --comment network:internal -j DROP",
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables ! -i tdbr4567 -o tdbr4567 -m comment --comment network:internal -j DROP",
+			},
+		},
+		{
+			name: "icc disabled",
+			nw:   &Network{Name: "noicc", Bridge: "tdbr89ab", IPRange: ipRange, Options: map[string]string{"icc": "false"}},
+			want: []string{
+				"TINY-DOCKER-POSTROUTING iptables -s 172.18.0.0/24 ! -o tdbr89ab -m comment --comment network:noicc -j MASQUERADE",
+				"TINY-DOCKER-POSTROUTING iptables -s 172.18.0.0/24 -o tdbr89ab -m conntrack --ctstate DNAT -m comment --comment network:noicc -j MASQUERADE",
+				"TINY-DOCKER-POSTROUTING iptables -s 127.0.0.0/8 -o tdbr89ab -m comment --comment network:noicc -j MASQUERADE",
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables -i tdbr89ab ! -o tdbr89ab -m comment --comment network:noicc -j TINY-DOCKER-ISOLATION-STAGE-2",
+				"TINY-DOCKER-ISOLATION-STAGE-2 iptables -o tdbr89ab -m comment --comment network:noicc -j DROP",
+				"TINY-DOCKER-ISOLATION-STAGE-1 iptables -i tdbr89ab -o tdbr89ab -m comment --comment network:noicc -j DROP",
+			},
+		},
+	}
+	for _, c := range cases {
+		rules := networkRules(c.nw)
+		if len(rules) != len(c.want) {
+			t.Fatalf("%s: got %d rules, want %d", c.name, len(rules), len(c.want))
+		}
+		for i, r := range rules {
+			got := r.chain + " " + r.iptablesCommand() + " " + strings.Join(r.iptablesArgs(networkOwner(c.nw.Name)), " ")
+			if got != c.want[i] {
+				t.Fatalf("%s: rule %d got %q, want %q", c.name, i, got, c.want[i])
+			}
+		}
+	}
+}
+
+func TestValidateBridgeOptions(t *testing.T) {
+	cases := []struct {
+		options map[string]string
+		ok      bool
+	}{
+		{nil, true},
+		{map[string]string{"icc": "false"}, true},
+		{map[string]string{"icc": "true"}, true},
+		{map[string]string{"icc": "no"}, false},
+		{map[string]string{"mtu": "1500"}, false},
+	}
+	for _, c := range cases {
+		if err := validateBridgeOptions(c.options); (err == nil) != c.ok {
+			t.Fatalf("validate %v got error %v, want ok %v", c.options, err, c.ok)
+		}
+	}
+}
+
+func TestPortMappingRulesIPTablesArgs(t *testing.T) {
+	_, ipRange, _ := net.ParseCIDR("172.18.0.1/24")
+	_, ipv6Range, _ := net.ParseCIDR("fd00::1/64")
+	ep := &Endpoint{
+		ID:          "c1-testnet",
+		IPAddress:   net.ParseIP("172.18.0.2"),
+		IPv6Address: net.ParseIP("fd00::2"),
+		Network:     &Network{Name: "testnet", IPRange: ipRange, IPv6Range: ipv6Range},
+		PortMapping: []string{"8080:80/tcp", "127.0.0.1:5353:53/udp", "[::1]:9090:90/tcp"},
+	}
+
+	want := []string{
+		"iptables -p tcp -m tcp --dport 8080 -m comment --comment endpoint:c1-testnet -j DNAT --to-destination 172.18.0.2:80",
+		"ip6tables -p tcp -m tcp --dport 8080 -m comment --comment endpoint:c1-testnet -j DNAT --to-destination [fd00::2]:80",
+		"iptables -d 127.0.0.1 -p udp -m udp --dport 5353 -m comment --comment endpoint:c1-testnet -j DNAT --to-destination 172.18.0.2:53",
+		"ip6tables -d ::1 -p tcp -m tcp --dport 9090 -m comment --comment endpoint:c1-testnet -j DNAT --to-destination [fd00::2]:90",
+	}
+	rules := portMappingRules(ep)
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i, r := range rules {
+		if r.chain != chainDNAT {
+			t.Fatalf("rule %d in chain %s, want %s", i, r.chain, chainDNAT)
+		}
+		got := r.iptablesCommand() + " " + strings.Join(r.iptablesArgs(endpointOwner(ep.ID)), " ")
+		if got != want[i] {
+			t.Fatalf("rule %d got %q, want %q", i, got, want[i])
+		}
+	}
+}
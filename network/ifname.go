@@ -0,0 +1,36 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// 内核限制网卡名最长为 IFNAMSIZ-1 个字节
+	maxInterfaceNameLen = unix.IFNAMSIZ - 1
+	// tiny-docker 创建的网卡统一使用的名字前缀，便于与宿主机上其他的设备区分
+	bridgePrefix   = "tdbr"
+	hostVethPrefix = "tdveth"
+	peerVethPrefix = "tdpeer"
+)
+
+// interfaceName 根据 key 的哈希值生成以 prefix 开头的网卡名，长度不超过内核的限制
+// 同样的 key 总是得到同样的名字，不同的 key 几乎不会冲突
+func interfaceName(prefix string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:])[:maxInterfaceNameLen-len(prefix)]
+}
+
+// bridgeName 返回网络对应的网桥设备名，网络名可能超过内核对网卡名长度的限制，因此使用网络名的哈希值
+func bridgeName(networkName string) string {
+	return interfaceName(bridgePrefix, networkName)
+}
+
+// vethNames 返回网络端点宿主机一侧和容器一侧的 veth 设备名，容器一侧的设备移动到容器中后会重命名为 iface
+// 容器id的前几位可能重复，因此使用容器id和网卡名的哈希值
+func vethNames(containerId string, iface string) (string, string) {
+	key := containerId + "/" + iface
+	return interfaceName(hostVethPrefix, key), interfaceName(peerVethPrefix, key)
+}
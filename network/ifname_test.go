@@ -0,0 +1,46 @@
+package network
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVethNames(t *testing.T) {
+	// 前 5 位相同的容器id
+	first, second := "12345aaaaaaaaaaa", "12345bbbbbbbbbbb"
+	names := map[string]bool{}
+	for _, id := range []string{first, second} {
+		for _, iface := range []string{"eth0", "eth1"} {
+			host, peer := vethNames(id, iface)
+			for _, name := range []string{host, peer} {
+				if len(name) > maxInterfaceNameLen {
+					t.Fatalf("interface name %s is longer than %d", name, maxInterfaceNameLen)
+				}
+				if names[name] {
+					t.Fatalf("interface name %s is duplicated", name)
+				}
+				names[name] = true
+			}
+			if !strings.HasPrefix(host, hostVethPrefix) || !strings.HasPrefix(peer, peerVethPrefix) {
+				t.Fatalf("veth names %s %s should use the reserved prefix", host, peer)
+			}
+		}
+	}
+	host, peer := vethNames(first, "eth0")
+	if again, againPeer := vethNames(first, "eth0"); again != host || againPeer != peer {
+		t.Fatalf("veth names should be deterministic")
+	}
+}
+
+func TestBridgeName(t *testing.T) {
+	tests := []string{"a", "testbridge", "a-network-name-longer-than-ifnamsiz"}
+	for _, name := range tests {
+		bridge := bridgeName(name)
+		if len(bridge) > maxInterfaceNameLen || !strings.HasPrefix(bridge, bridgePrefix) {
+			t.Fatalf("bridge name of %s is %s", name, bridge)
+		}
+		if bridge != bridgeName(name) {
+			t.Fatalf("bridge name of %s should be deterministic", name)
+		}
+	}
+}
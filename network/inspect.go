@@ -0,0 +1,145 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// EndpointInfo 容器网络端点的详细信息
+type EndpointInfo struct {
+	Network        string   `json:"network"`
+	EndpointID     string   `json:"endpointId"`
+	HostVeth       string   `json:"hostVeth"`      // 宿主机一侧的 veth 设备名
+	ContainerVeth  string   `json:"containerVeth"` // 容器内的网卡名
+	MacAddress     string   `json:"macAddress"`    // 容器一侧 veth 的 MAC 地址，容器未运行时为空
+	HostMacAddress string   `json:"hostMacAddress"`
+	IPAddress      string   `json:"ipAddress"`
+	Gateway        string   `json:"gateway"`
+	Subnet         string   `json:"subnet"`
+	IPv6Address    string   `json:"ipv6Address,omitempty"`
+	IPv6Gateway    string   `json:"ipv6Gateway,omitempty"`
+	IPv6Subnet     string   `json:"ipv6Subnet,omitempty"`
+	Aliases        []string `json:"aliases,omitempty"`
+	PortMapping    []string `json:"portMapping"`
+}
+
+// NetworkInspect 网络的详细信息
+type NetworkInspect struct {
+	Name        string `json:"name"`
+	Driver      string `json:"driver"`
+	Bridge      string `json:"bridge,omitempty"` // 网桥设备名
+	Subnet      string `json:"subnet"`
+	Gateway     string `json:"gateway"`
+	EnableIPv6  bool   `json:"enableIPv6"`
+	IPv6Subnet  string `json:"ipv6Subnet,omitempty"`
+	IPv6Gateway string `json:"ipv6Gateway,omitempty"`
+	Internal    bool   `json:"internal"`
+	// Options 驱动参数
+	Options map[string]string `json:"options,omitempty"`
+	// Containers 连接到这个网络的容器，key 为容器id
+	Containers map[string]*EndpointInfo `json:"containers"`
+}
+
+// gatewayAndSubnet 返回地址段的网关地址和网段，ipRange 中的 IP 即为网关地址
+func gatewayAndSubnet(ipRange *net.IPNet) (string, string) {
+	if ipRange == nil {
+		return "", ""
+	}
+	subnet := &net.IPNet{IP: ipRange.IP.Mask(ipRange.Mask), Mask: ipRange.Mask}
+	return ipRange.IP.String(), subnet.String()
+}
+
+// InspectEndpoints 获取容器连接的所有网络端点信息
+func InspectEndpoints(info *container.Info) ([]*EndpointInfo, error) {
+	if len(info.Endpoints) == 0 {
+		return nil, nil
+	}
+	networks, err := loadNetwork()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load network from file failed")
+	}
+	endpoints := make([]*EndpointInfo, 0, len(info.Endpoints))
+	for _, record := range info.Endpoints {
+		network, ok := networks[record.Network]
+		if !ok {
+			return nil, fmt.Errorf("no Such Network: %s", record.Network)
+		}
+		endpoints = append(endpoints, inspectEndpoint(network, info, record))
+	}
+	return endpoints, nil
+}
+
+func inspectEndpoint(network *Network, info *container.Info, record *container.Endpoint) *EndpointInfo {
+	ep := &EndpointInfo{
+		Network:       network.Name,
+		EndpointID:    endpointID(info.Id, network.Name),
+		HostVeth:      record.HostInterface,
+		ContainerVeth: record.Interface,
+		IPAddress:     record.IP,
+		IPv6Address:   record.IPv6,
+		Aliases:       record.Aliases,
+		PortMapping:   record.PortMapping,
+	}
+	ep.Gateway, ep.Subnet = gatewayAndSubnet(network.IPRange)
+	if record.IPv6 != "" {
+		ep.IPv6Gateway, ep.IPv6Subnet = gatewayAndSubnet(network.IPv6Range)
+	}
+	if link, err := netlink.LinkByName(record.HostInterface); err == nil {
+		ep.HostMacAddress = link.Attrs().HardwareAddr.String()
+	}
+	ep.MacAddress = containerMacAddress(info.Pid, record.Interface)
+	return ep
+}
+
+// containerMacAddress 在容器的 Net Namespace 中查找 veth 设备的 MAC 地址，找不到时返回空字符串
+func containerMacAddress(pid string, linkName string) string {
+	handle, err := containerNetlinkHandle(pid)
+	if err != nil {
+		return ""
+	}
+	defer handle.Delete()
+	link, err := handle.LinkByName(linkName)
+	if err != nil {
+		return ""
+	}
+	return link.Attrs().HardwareAddr.String()
+}
+
+// InspectNetwork 获取网络以及连接到这个网络的容器信息，网络不存在时返回的错误满足 os.ErrNotExist
+func InspectNetwork(name string) (*NetworkInspect, error) {
+	networks, err := loadNetwork()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load network from file failed")
+	}
+	network, ok := networks[name]
+	if !ok {
+		return nil, errors.WithMessagef(os.ErrNotExist, "no such network %s", name)
+	}
+	result := &NetworkInspect{
+		Name:       network.Name,
+		Driver:     network.Driver,
+		Bridge:     network.Bridge,
+		EnableIPv6: network.IPv6Range != nil,
+		Internal:   network.Internal,
+		Options:    network.Options,
+		Containers: make(map[string]*EndpointInfo),
+	}
+	result.Gateway, result.Subnet = gatewayAndSubnet(network.IPRange)
+	result.IPv6Gateway, result.IPv6Subnet = gatewayAndSubnet(network.IPv6Range)
+
+	infos, err := container.ListInfos()
+	if err != nil {
+		return nil, errors.WithMessage(err, "list container info failed")
+	}
+	for _, info := range infos {
+		if record := info.Endpoint(name); record != nil {
+			result.Containers[info.Id] = inspectEndpoint(network, info, record)
+		}
+	}
+	return result, nil
+}
@@ -3,21 +3,60 @@ package network
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"net"
-	"os"
-	"path"
-	"strings"
 
-	"github.com/ChenMiaoQiu/tiny-docker/constant"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 const ipamDefaultAllocatorPath = "/var/lib/tiny-docker/network/ipam/subnet.json"
 
+var (
+	// ErrNoAvailableIP 网段中的地址已经全部分配
+	ErrNoAvailableIP = errors.New("no available ip in subnet")
+	// ErrSubnetInUse 网段与已有网络的网段重叠
+	ErrSubnetInUse = errors.New("subnet overlaps with an existing network")
+	// ErrIPOutOfRange 地址不在网段的可分配范围内
+	ErrIPOutOfRange = errors.New("ip is out of subnet range")
+	// ErrIPInUse 地址已经被分配
+	ErrIPInUse = errors.New("ip is already in use")
+)
+
+// IPAM 基于位图的地址分配器，分配信息保存在 SubnetAllocatorPath 中
+// 每次分配和释放都在文件锁的保护下完成 读取-修改-写回，多个 tiny-docker 进程同时操作时不会分配出相同的地址
 type IPAM struct {
-	SubnetAllocatorPath string             // 分配文件存放位置
-	Subnets             *map[string]string // 网段和位图算法的数组 map, key 是网段， value 是分配的位图数组
+	SubnetAllocatorPath string // 分配文件存放位置
+}
+
+// subnetAllocation 一个网段的分配信息
+type subnetAllocation struct {
+	Gateway   net.IP `json:"gateway,omitempty"` // 网关地址，释放网段时才会释放
+	Range     string `json:"range,omitempty"`   // 自动分配地址的范围，为空时从整个网段中分配
+	Allocated bitmap `json:"allocated"`         // 已分配地址的位图，第 n 位对应网段中偏移为 n 的地址
+	// Sparse 位图之外的已分配偏移，位图只会逐字节连续增长，跳到高位的地址记录在这里
+	Sparse offsetSet `json:"sparse,omitempty"`
+}
+
+// SubnetOptions 登记网段时指定的网关地址和自动分配地址的范围
+type SubnetOptions struct {
+	Gateway net.IP     // 网关地址，为空时使用网段中第一个可用地址
+	IPRange *net.IPNet // 自动分配地址的范围，必须在网段内，为空时从整个网段中分配
+}
+
+// UnmarshalJSON 兼容旧版本以 '0'/'1' 字符串保存的位图，旧格式中首尾两位是网络地址和广播地址的占位
+func (a *subnetAllocation) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		for i := 1; i < len(legacy)-1; i++ {
+			if legacy[i] == '1' {
+				a.allocate(uint64(i))
+			}
+		}
+		return nil
+	}
+	type plain subnetAllocation
+	return json.Unmarshal(data, (*plain)(a))
 }
 
 // 初始化一个IPAM的对象，默认使用/var/lib/tiny-docker/network/ipam/subnet.json作为分配信息存储位置
@@ -25,144 +64,288 @@ var ipAllocator = &IPAM{
 	SubnetAllocatorPath: ipamDefaultAllocatorPath,
 }
 
-// Allocate 在网段中分配一个可用的 IP 地址
-func (ipam *IPAM) Allocate(subnet *net.IPNet) (ip net.IP, err error) {
-	// 初始化数组
-	ipam.Subnets = &map[string]string{}
-
-	// 加载信息
-	err = ipam.load()
-	if err != nil {
-		return nil, errors.Wrap(err, "load subnet allocation info error")
-	}
-	// net.IPNet.Mask.Size函数会返回网段的子网掩码的总长度和网段前面的固定位的长度
-	// 比如“127.0.0.0/8”网段的子网掩码是“255.0.0.0”
-	// 那么subnet.Mask.Size()的返回值就是前面255所对应的位数和总位数，即8和24
-	_, subnet, _ = net.ParseCIDR(subnet.String())
-	one, size := subnet.Mask.Size()
-	// 如果之前没有分配过这个网段，则初始化网段的分配配置
-	if _, exist := (*ipam.Subnets)[subnet.String()]; !exist {
-		// ／用“0”填满这个网段的配置，uint8(size - one)表示这个网段中有多少个可用地址
-		// size - one是子网掩码后面的网络位数，2^(size - one)表示网段中的可用IP数
-		// 而2^(size - one)等价于1 << (size - one) - 广播地址 - 网络地址
-		// size <= 32
-		ipCount := 1 << (size - one)
-		// 减去 0和 255这俩个不可分配地址，所有可分配的 IP 地址
-		ipalloc := strings.Repeat("0", ipCount-2)
-		// 初始化分配配置，标记 .0 和 .255 位置为不可分配，直接置为 1
-		(*ipam.Subnets)[subnet.String()] = fmt.Sprintf("1%s1", ipalloc)
-	}
-	// 遍历网段的位图数组
-	for c := range (*ipam.Subnets)[subnet.String()] {
-		// 找到数组中为“0”的项和数组序号，即可以分配的 IP
-		if (*ipam.Subnets)[subnet.String()][c] == '0' {
-			// 设置这个为“0”的序号值为“1” 即标记这个IP已经分配过了
-			// Go 的字符串，创建之后就不能修改 所以通过转换成 byte 数组，修改后再转换成字符串赋值
-			ipalloc := []byte((*ipam.Subnets)[subnet.String()])
-			ipalloc[c] = '1'
-			(*ipam.Subnets)[subnet.String()] = string(ipalloc)
-			// 这里的 subnet.IP只是初始IP，比如对于网段192 168.0.0/16 ，这里就是192.168.0.0
-			ip = subnet.IP
-			/*
-				还需要通过网段的IP与上面的偏移相加计算出分配的IP地址，由于IP地址是uint的一个数组，
-				需要通过数组中的每一项加所需要的值，比如网段是172.16.0.0/12，数组序号是65555,
-				那么在[172,16,0,0] 上依次加[uint8(65555 >> 24)、uint8(65555 >> 16)、
-				uint8(65555 >> 8)、uint8(65555 >> 0)]， 即[0, 1, 0, 19]， 那么获得的IP就
-				是172.17.0.19.
-			*/
-			// 转换成256进制再加
-
-			// 由于此处IP是从1开始分配的（0被网关占了），所以最后再加1，最终得到分配的IP 172.17.0.20
-			for t := uint(4); t > 0; t-- {
-				// uint8 = 只看c二进制后面8位
-				[]byte(ip)[4-t] += uint8(c >> ((t - 1) * 8))
-			}
-			break
+// AllocateSubnet 登记网络使用的网段并保留网关地址，返回网关地址
+// 没有指定网关时保留网段中第一个可用地址，网段与其他网络的网段重叠时返回 ErrSubnetInUse
+func (ipam *IPAM) AllocateSubnet(subnet *net.IPNet, opts SubnetOptions) (gateway net.IP, err error) {
+	subnet = normalizeSubnet(subnet)
+	first, last := subnetRange(subnet)
+	gatewayOffset := first
+	if opts.Gateway != nil {
+		if gatewayOffset, err = ipOffset(subnet, opts.Gateway); err != nil {
+			return nil, err
+		}
+		if gatewayOffset < first || gatewayOffset > last {
+			return nil, errors.WithMessagef(ErrIPOutOfRange, "gateway %s is reserved in subnet %s", opts.Gateway, subnet)
 		}
 	}
-	// 最后调用dump将分配结果保存到文件中
-	err = ipam.dump()
-	if err != nil {
-		logrus.Error("Allocate: dump ipam error", err)
+	var ipRange string
+	if opts.IPRange != nil {
+		r := normalizeSubnet(opts.IPRange)
+		if subnetOnes, _ := subnet.Mask.Size(); !subnet.Contains(r.IP) || len(r.Mask) != len(subnet.Mask) || maskOnes(r) < subnetOnes {
+			return nil, errors.WithMessagef(ErrIPOutOfRange, "ip range %s is not in subnet %s", opts.IPRange, subnet)
+		}
+		if _, _, err = rangeOffsets(subnet, r); err != nil {
+			return nil, err
+		}
+		ipRange = r.String()
 	}
-	return
+	err = ipam.update(func(subnets map[string]*subnetAllocation) error {
+		for key, allocation := range subnets {
+			_, other, parseErr := net.ParseCIDR(key)
+			if parseErr != nil || !subnetsOverlap(subnet, other) {
+				continue
+			}
+			// 旧版本删除网络时不会删除网段记录，没有分配任何地址的记录可以直接覆盖
+			if allocation.Gateway == nil && allocation.count() == 0 {
+				delete(subnets, key)
+				continue
+			}
+			return errors.WithMessagef(ErrSubnetInUse, "subnet %s overlaps with %s", subnet, key)
+		}
+		allocation := newSubnetAllocation(subnet, gatewayOffset)
+		allocation.Range = ipRange
+		subnets[subnet.String()] = allocation
+		gateway = allocation.Gateway
+		return nil
+	})
+	return gateway, err
+}
+
+// ReleaseSubnet 删除网段的分配信息，包括网关地址
+func (ipam *IPAM) ReleaseSubnet(subnet *net.IPNet) error {
+	subnet = normalizeSubnet(subnet)
+	return ipam.update(func(subnets map[string]*subnetAllocation) error {
+		delete(subnets, subnet.String())
+		return nil
+	})
+}
+
+// Allocate 在网段中分配一个可用的 IP 地址，总是分配分配范围内偏移最小的可用地址
+// 网段还没有登记时会先登记并保留网关地址，地址耗尽时返回 ErrNoAvailableIP
+func (ipam *IPAM) Allocate(subnet *net.IPNet) (ip net.IP, err error) {
+	subnet = normalizeSubnet(subnet)
+	err = ipam.update(func(subnets map[string]*subnetAllocation) error {
+		allocation, ok := subnets[subnet.String()]
+		if !ok {
+			first, _ := subnetRange(subnet)
+			allocation = newSubnetAllocation(subnet, first)
+			subnets[subnet.String()] = allocation
+		}
+		first, last := allocation.allocationRange(subnet)
+		offset, found := allocation.firstFree(first, last)
+		if !found {
+			return errors.WithMessagef(ErrNoAvailableIP, "subnet %s", subnet)
+		}
+		allocation.allocate(offset)
+		ip = ipAtOffset(subnet, offset)
+		return nil
+	})
+	return ip, err
 }
 
-// Release 回收分配的ip地址
+// Reserve 分配网段中指定的地址，地址已被分配或者是网关地址时返回 ErrIPInUse
+func (ipam *IPAM) Reserve(subnet *net.IPNet, ip net.IP) error {
+	subnet = normalizeSubnet(subnet)
+	return ipam.update(func(subnets map[string]*subnetAllocation) error {
+		allocation, ok := subnets[subnet.String()]
+		if !ok {
+			first, _ := subnetRange(subnet)
+			allocation = newSubnetAllocation(subnet, first)
+			subnets[subnet.String()] = allocation
+		}
+		offset, err := ipOffset(subnet, ip)
+		if err != nil {
+			return err
+		}
+		if first, last := subnetRange(subnet); offset < first || offset > last {
+			return errors.WithMessagef(ErrIPOutOfRange, "%s is reserved in subnet %s", ip, subnet)
+		}
+		if allocation.allocated(offset) {
+			return errors.WithMessagef(ErrIPInUse, "%s in subnet %s", ip, subnet)
+		}
+		allocation.allocate(offset)
+		return nil
+	})
+}
+
+// Release 回收分配的ip地址，网段或地址没有分配时直接返回，网关地址只能通过 ReleaseSubnet 释放
 func (ipam *IPAM) Release(subnet *net.IPNet, ipaddr *net.IP) error {
-	ipam.Subnets = &map[string]string{}
-	_, subnet, _ = net.ParseCIDR(subnet.String())
+	subnet = normalizeSubnet(subnet)
+	return ipam.update(func(subnets map[string]*subnetAllocation) error {
+		allocation, ok := subnets[subnet.String()]
+		if !ok {
+			return nil
+		}
+		if allocation.Gateway.Equal(*ipaddr) {
+			return fmt.Errorf("can not release gateway %s of subnet %s", ipaddr, subnet)
+		}
+		offset, err := ipOffset(subnet, *ipaddr)
+		if err != nil {
+			return err
+		}
+		allocation.release(offset)
+		return nil
+	})
+}
 
-	err := ipam.load()
-	if err != nil {
-		return errors.Wrap(err, "load subnet allocation info error")
+// newSubnetAllocation 初始化网段的分配信息，并保留偏移为 gatewayOffset 的网关地址
+func newSubnetAllocation(subnet *net.IPNet, gatewayOffset uint64) *subnetAllocation {
+	allocation := &subnetAllocation{Gateway: ipAtOffset(subnet, gatewayOffset)}
+	allocation.allocate(gatewayOffset)
+	return allocation
+}
+
+// allocated 判断偏移为 n 的地址是否已被分配
+func (a *subnetAllocation) allocated(n uint64) bool {
+	return a.Allocated.test(n) || a.Sparse.contains(n)
+}
+
+// allocate 将偏移为 n 的地址标记为已分配
+// 位图最多增长一个字节，更高的偏移记录在 Sparse 中，指定 IPv6 网段末尾的地址时不会分配巨大的位图
+func (a *subnetAllocation) allocate(n uint64) {
+	if n/8 > uint64(len(a.Allocated)) {
+		a.Sparse.add(n)
+		return
+	}
+	a.Allocated.set(n)
+	// 位图增长后，落入位图范围的稀疏偏移移回位图
+	limit := uint64(len(a.Allocated)) * 8
+	for len(a.Sparse) > 0 && a.Sparse[0] < limit {
+		a.Allocated.set(a.Sparse[0])
+		a.Sparse = a.Sparse[1:]
 	}
+}
+
+// release 将偏移为 n 的地址标记为空闲
+func (a *subnetAllocation) release(n uint64) {
+	a.Allocated.clear(n)
+	a.Sparse.remove(n)
+}
 
-	c := 0
-	releaseIP := ipaddr.To4()
-	for t := uint(4); t > 0; t-- {
-		c += int(releaseIP[t-1]-subnet.IP[t-1]) << ((4 - t) * 8)
+// firstFree 返回 [from, to] 范围内第一个空闲地址的偏移
+func (a *subnetAllocation) firstFree(from, to uint64) (uint64, bool) {
+	n, ok := a.Allocated.firstClear(from, to)
+	for ok && a.Sparse.contains(n) {
+		if n == to {
+			return 0, false
+		}
+		n, ok = a.Allocated.firstClear(n+1, to)
 	}
+	return n, ok
+}
 
-	// 对应位置0
-	ipalloc := []byte((*ipam.Subnets)[subnet.String()])
-	ipalloc[c] = '0'
-	(*ipam.Subnets)[subnet.String()] = string(ipalloc)
+// count 返回已分配的地址数量
+func (a *subnetAllocation) count() int {
+	return a.Allocated.count() + len(a.Sparse)
+}
 
-	// 最后调用dump将分配结果保存到文件中
-	err = ipam.dump()
+// allocationRange 返回自动分配地址的偏移范围，即分配范围与网段可分配范围的交集
+// 分配范围无法表示为偏移时返回空的范围，不能退回到整个网段
+func (a *subnetAllocation) allocationRange(subnet *net.IPNet) (first, last uint64) {
+	first, last = subnetRange(subnet)
+	if a.Range == "" {
+		return first, last
+	}
+	_, ipRange, err := net.ParseCIDR(a.Range)
 	if err != nil {
-		logrus.Error("Allocate: dump ipam error", err)
+		return 1, 0
 	}
-	return nil
+	start, end, err := rangeOffsets(subnet, normalizeSubnet(ipRange))
+	if err != nil {
+		return 1, 0
+	}
+	return max(first, start), min(last, end)
 }
 
-// load 加载网段地址分配信息
-func (ipam *IPAM) load() error {
-	// 检查存储文件状态，如果不存在，则说明之前没有分配，则不需要加载
-	if _, err := os.Stat(ipam.SubnetAllocatorPath); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-		return nil
+// rangeOffsets 返回分配范围的第一个和最后一个地址在网段中的偏移
+// 分配地址的偏移使用 uint64 表示，IPv6 网段中距离网段起始地址 2^64 及以上的分配范围返回 ErrIPOutOfRange
+func rangeOffsets(subnet, ipRange *net.IPNet) (start, end uint64, err error) {
+	if start, err = ipOffset(subnet, ipRange.IP); err != nil {
+		return 0, 0, err
 	}
-	subnetConfigFile, err := os.Open(ipam.SubnetAllocatorPath)
-	if err != nil {
-		return err
+	// 这里需要的是整个范围，包括分配范围自身的网络地址和广播地址
+	ones, bits := ipRange.Mask.Size()
+	hostBits := bits - ones
+	if hostBits >= 64 && start == 0 {
+		return start, math.MaxUint64, nil
 	}
-	defer subnetConfigFile.Close()
+	if hostBits >= 64 || start > math.MaxUint64-(1<<hostBits-1) {
+		return 0, 0, errors.WithMessagef(ErrIPOutOfRange, "ip range %s is too far from the start of subnet %s", ipRange, subnet)
+	}
+	return start, start + 1<<hostBits - 1, nil
+}
 
-	subnetJson := make([]byte, 2000)
-	n, err := subnetConfigFile.Read(subnetJson)
-	if err != nil {
-		return err
+// update 在文件锁的保护下读取分配信息，调用 fn 修改后写回
+func (ipam *IPAM) update(fn func(subnets map[string]*subnetAllocation) error) error {
+	subnets := map[string]*subnetAllocation{}
+	return updateLockedJSON(ipam.SubnetAllocatorPath, &subnets, func() error {
+		return fn(subnets)
+	})
+}
+
+// normalizeSubnet 去掉网段地址中的主机位，IPv4 地址统一使用 4 字节表示
+func normalizeSubnet(subnet *net.IPNet) *net.IPNet {
+	ip := subnet.IP.To4()
+	mask := subnet.Mask
+	if ip == nil {
+		ip = subnet.IP.To16()
+	} else if len(mask) == net.IPv6len {
+		mask = mask[12:]
 	}
-	err = json.Unmarshal(subnetJson[:n], ipam.Subnets)
-	return errors.Wrap(err, "err dump allocation info")
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
 }
 
-// dump 存储网段信息
-func (ipam *IPAM) dump() error {
-	ipamConfigFileDir, _ := path.Split(ipam.SubnetAllocatorPath)
-	// 判断是否存在文件夹，如果不存在则创建
-	if _, err := os.Stat(ipamConfigFileDir); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-		if err = os.MkdirAll(ipamConfigFileDir, constant.Perm0644); err != nil {
-			return err
-		}
+// subnetRange 返回网段中可分配地址的偏移范围
+// IPv4 网段排除网络地址和广播地址，/31 和 /32 没有这两个地址；IPv6 网段只排除偏移为 0 的地址
+func subnetRange(subnet *net.IPNet) (first, last uint64) {
+	ones, bits := subnet.Mask.Size()
+	hostBits := bits - ones
+	var lastOffset uint64 = math.MaxUint64
+	if hostBits < 64 {
+		lastOffset = 1<<hostBits - 1
 	}
-	// 打开存储文件 O_TRUNC 表示如果存在则消空， os O_CREATE 表示如果不存在则创建
-	subnetConfigFile, err := os.OpenFile(ipam.SubnetAllocatorPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, constant.Perm0644)
-	if err != nil {
-		return err
+	switch {
+	case hostBits == 0:
+		return 0, 0
+	case bits == 8*net.IPv4len && hostBits == 1:
+		return 0, 1
+	case bits == 8*net.IPv4len:
+		return 1, lastOffset - 1
+	default:
+		return 1, lastOffset
 	}
-	defer subnetConfigFile.Close()
-	ipamConfigJson, err := json.Marshal(ipam.Subnets)
-	if err != nil {
-		return err
+}
+
+// ipAtOffset 返回网段中偏移为 offset 的地址
+func ipAtOffset(subnet *net.IPNet, offset uint64) net.IP {
+	value := new(big.Int).SetBytes(subnet.IP)
+	value.Add(value, new(big.Int).SetUint64(offset))
+	return value.FillBytes(make(net.IP, len(subnet.IP)))
+}
+
+// ipOffset 返回地址在网段中的偏移
+func ipOffset(subnet *net.IPNet, ip net.IP) (uint64, error) {
+	if v4 := ip.To4(); v4 != nil && len(subnet.IP) == net.IPv4len {
+		ip = v4
+	}
+	if !subnet.Contains(ip) {
+		return 0, errors.WithMessagef(ErrIPOutOfRange, "%s is not in subnet %s", ip, subnet)
 	}
-	_, err = subnetConfigFile.Write(ipamConfigJson)
-	return err
+	value := new(big.Int).SetBytes(ip.To16())
+	value.Sub(value, new(big.Int).SetBytes(subnet.IP.To16()))
+	if !value.IsUint64() {
+		return 0, errors.WithMessagef(ErrIPOutOfRange, "%s is too far from the start of subnet %s", ip, subnet)
+	}
+	return value.Uint64(), nil
+}
+
+// maskOnes 返回网段掩码的长度
+func maskOnes(subnet *net.IPNet) int {
+	ones, _ := subnet.Mask.Size()
+	return ones
+}
+
+// subnetsOverlap 判断两个网段是否重叠
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
 }
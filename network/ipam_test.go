@@ -2,22 +2,454 @@ package network
 
 import (
 	"net"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/pkg/errors"
 )
 
+// newTestIPAM 返回使用临时文件保存分配信息的 IPAM，避免影响宿主机上的网络
+func newTestIPAM(t *testing.T) *IPAM {
+	return &IPAM{SubnetAllocatorPath: path.Join(t.TempDir(), "subnet.json")}
+}
+
 func TestAllocate(t *testing.T) {
-	_, ipNet, _ := net.ParseCIDR("192.168.0.1/24")
-	ip, err := ipAllocator.Allocate(ipNet)
-	if err != nil {
+	cases := []struct {
+		subnet  string
+		gateway string
+		ips     []string // 依次分配到的地址，之后再分配应当耗尽
+		more    bool     // 分配完 ips 之后是否还有可用地址
+	}{
+		{"192.168.0.0/24", "192.168.0.1", []string{"192.168.0.2", "192.168.0.3"}, true},
+		{"10.20.0.0/30", "10.20.0.1", []string{"10.20.0.2"}, false},
+		{"10.30.0.0/31", "10.30.0.0", []string{"10.30.0.1"}, false},
+		{"10.40.0.7/32", "10.40.0.7", nil, false},
+		{"172.16.0.0/16", "172.16.0.1", []string{"172.16.0.2"}, true},
+		{"10.0.0.0/8", "10.0.0.1", []string{"10.0.0.2"}, true},
+		{"fd00::/120", "fd00::1", []string{"fd00::2", "fd00::3"}, true},
+		{"fd00:1::/64", "fd00:1::1", []string{"fd00:1::2", "fd00:1::3"}, true},
+	}
+	for _, c := range cases {
+		ipam := newTestIPAM(t)
+		_, subnet, _ := net.ParseCIDR(c.subnet)
+		gateway, err := ipam.AllocateSubnet(subnet, SubnetOptions{})
+		if err != nil {
+			t.Fatalf("allocate subnet %s error %v", c.subnet, err)
+		}
+		if gateway.String() != c.gateway {
+			t.Fatalf("subnet %s gateway is %s, want %s", c.subnet, gateway, c.gateway)
+		}
+		for _, want := range c.ips {
+			ip, err := ipam.Allocate(subnet)
+			if err != nil {
+				t.Fatalf("allocate ip in %s error %v", c.subnet, err)
+			}
+			if ip.String() != want {
+				t.Fatalf("allocate ip in %s got %s, want %s", c.subnet, ip, want)
+			}
+		}
+		_, err = ipam.Allocate(subnet)
+		if c.more && err != nil {
+			t.Fatalf("subnet %s should have available ip, got %v", c.subnet, err)
+		}
+		if !c.more && !errors.Is(err, ErrNoAvailableIP) {
+			t.Fatalf("subnet %s should be exhausted, got %v", c.subnet, err)
+		}
+	}
+}
+
+func TestAllocateExhaustion(t *testing.T) {
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/22")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("alloc ip: %v", ip)
+	// /22 共 1024 个地址，去掉网络地址、广播地址和网关
+	seen := make(map[string]bool)
+	for i := 0; i < 1021; i++ {
+		ip, err := ipam.Allocate(subnet)
+		if err != nil {
+			t.Fatalf("allocate %d ip error %v", i, err)
+		}
+		if seen[ip.String()] || !subnet.Contains(ip) {
+			t.Fatalf("allocate invalid or duplicate ip %s", ip)
+		}
+		seen[ip.String()] = true
+	}
+	if seen["10.1.3.255"] || seen["10.1.0.0"] || seen["10.1.0.1"] {
+		t.Fatalf("network, broadcast or gateway address should not be allocated")
+	}
+	if _, err := ipam.Allocate(subnet); !errors.Is(err, ErrNoAvailableIP) {
+		t.Fatalf("subnet should be exhausted, got %v", err)
+	}
 }
 
 func TestRelease(t *testing.T) {
-	ip, ipNet, _ := net.ParseCIDR("192.168.0.1/24")
-	err := ipAllocator.Release(ipNet, &ip)
+	cases := []struct {
+		subnet  string
+		release []string
+		next    []string // 释放后依次分配到的地址，总是先分配最小的地址
+	}{
+		{"192.168.0.0/24", []string{"192.168.0.3"}, []string{"192.168.0.3", "192.168.0.6"}},
+		{"192.168.0.0/24", []string{"192.168.0.5", "192.168.0.2"}, []string{"192.168.0.2", "192.168.0.5"}},
+		{"192.168.0.0/24", []string{"192.168.0.5", "192.168.0.5"}, []string{"192.168.0.5", "192.168.0.6"}},
+	}
+	for _, c := range cases {
+		ipam := newTestIPAM(t)
+		_, subnet, _ := net.ParseCIDR(c.subnet)
+		if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			if _, err := ipam.Allocate(subnet); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, raw := range c.release {
+			ip := net.ParseIP(raw)
+			if err := ipam.Release(subnet, &ip); err != nil {
+				t.Fatalf("release %s error %v", raw, err)
+			}
+		}
+		for _, want := range c.next {
+			ip, err := ipam.Allocate(subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ip.String() != want {
+				t.Fatalf("after releasing %v got %s, want %s", c.release, ip, want)
+			}
+		}
+	}
+
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("192.168.0.0/24")
+	gateway, _ := ipam.AllocateSubnet(subnet, SubnetOptions{})
+	if err := ipam.Release(subnet, &gateway); err == nil {
+		t.Fatalf("gateway should only be released with the subnet")
+	}
+	outside := net.ParseIP("192.168.1.2")
+	if err := ipam.Release(subnet, &outside); !errors.Is(err, ErrIPOutOfRange) {
+		t.Fatalf("release ip outside subnet should fail, got %v", err)
+	}
+}
+
+func TestAllocateSubnet(t *testing.T) {
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("10.10.0.0/16")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, cidr := range []string{"10.10.0.0/16", "10.10.5.0/24", "10.0.0.0/8"} {
+		_, other, _ := net.ParseCIDR(cidr)
+		if _, err := ipam.AllocateSubnet(other, SubnetOptions{}); !errors.Is(err, ErrSubnetInUse) {
+			t.Fatalf("subnet %s overlaps with %s, got %v", cidr, subnet, err)
+		}
+	}
+	_, other, _ := net.ParseCIDR("10.11.0.0/16")
+	if _, err := ipam.AllocateSubnet(other, SubnetOptions{}); err != nil {
+		t.Fatalf("subnet %s should not overlap, got %v", other, err)
+	}
+	if err := ipam.ReleaseSubnet(subnet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
+		t.Fatalf("released subnet %s should be reusable, got %v", subnet, err)
+	}
+}
+
+func TestAllocateSubnetOptions(t *testing.T) {
+	cases := []struct {
+		subnet  string
+		gateway string // 指定的网关地址
+		ipRange string // 指定的分配范围
+		want    string // 实际的网关地址
+		ips     []string
+	}{
+		{"10.50.0.0/24", "10.50.0.254", "10.50.0.128/30", "10.50.0.254", []string{"10.50.0.128", "10.50.0.129", "10.50.0.130", "10.50.0.131"}},
+		{"10.50.0.0/24", "", "10.50.0.0/30", "10.50.0.1", []string{"10.50.0.2", "10.50.0.3"}},
+		{"10.50.0.0/24", "10.50.0.129", "10.50.0.128/30", "10.50.0.129", []string{"10.50.0.128", "10.50.0.130", "10.50.0.131"}},
+		{"10.50.0.0/24", "10.50.0.252", "10.50.0.252/30", "10.50.0.252", []string{"10.50.0.253", "10.50.0.254"}},
+		{"fd00::/64", "fd00::1", "fd00::100/126", "fd00::1", []string{"fd00::100", "fd00::101", "fd00::102", "fd00::103"}},
+	}
+	for _, c := range cases {
+		ipam := newTestIPAM(t)
+		_, subnet, _ := net.ParseCIDR(c.subnet)
+		var opts SubnetOptions
+		opts.Gateway = net.ParseIP(c.gateway)
+		_, opts.IPRange, _ = net.ParseCIDR(c.ipRange)
+		gateway, err := ipam.AllocateSubnet(subnet, opts)
+		if err != nil {
+			t.Fatalf("allocate subnet %s with %+v error %v", c.subnet, opts, err)
+		}
+		if gateway.String() != c.want {
+			t.Fatalf("subnet %s gateway is %s, want %s", c.subnet, gateway, c.want)
+		}
+		for _, want := range c.ips {
+			ip, err := ipam.Allocate(subnet)
+			if err != nil {
+				t.Fatalf("allocate ip in %s range %s error %v", c.subnet, c.ipRange, err)
+			}
+			if ip.String() != want {
+				t.Fatalf("allocate ip in %s range %s got %s, want %s", c.subnet, c.ipRange, ip, want)
+			}
+		}
+		if _, err = ipam.Allocate(subnet); !errors.Is(err, ErrNoAvailableIP) {
+			t.Fatalf("range %s should be exhausted, got %v", c.ipRange, err)
+		}
+	}
+
+	// 分配范围只限制自动分配，指定地址时可以使用网段中的其他地址
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("10.60.0.0/24")
+	_, ipRange, _ := net.ParseCIDR("10.60.0.128/25")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{IPRange: ipRange}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(subnet, net.ParseIP("10.60.0.10")); err != nil {
+		t.Fatalf("reserve ip outside range should succeed, got %v", err)
+	}
+
+	invalid := []SubnetOptions{
+		{Gateway: net.ParseIP("10.60.0.0")},
+		{Gateway: net.ParseIP("10.60.0.255")},
+		{Gateway: net.ParseIP("10.61.0.1")},
+		{IPRange: &net.IPNet{IP: net.ParseIP("10.61.0.0").To4(), Mask: net.CIDRMask(25, 32)}},
+		{IPRange: &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(8, 32)}},
+	}
+	for _, opts := range invalid {
+		if _, err := newTestIPAM(t).AllocateSubnet(subnet, opts); !errors.Is(err, ErrIPOutOfRange) {
+			t.Fatalf("allocate subnet %s with %+v should fail, got %v", subnet, opts, err)
+		}
+	}
+
+	// 地址偏移使用 uint64 表示，距离 IPv6 网段起始地址 2^64 及以上的分配范围不能退回到整个网段
+	_, subnet6, _ := net.ParseCIDR("fd00::/48")
+	_, farRange, _ := net.ParseCIDR("fd00:0:0:1::/64")
+	if _, err := newTestIPAM(t).AllocateSubnet(subnet6, SubnetOptions{IPRange: farRange}); !errors.Is(err, ErrIPOutOfRange) {
+		t.Fatalf("allocate subnet %s with range %s should fail, got %v", subnet6, farRange, err)
+	}
+	ipam = newTestIPAM(t)
+	_, nearRange, _ := net.ParseCIDR("fd00::1:0/112")
+	if _, err := ipam.AllocateSubnet(subnet6, SubnetOptions{IPRange: nearRange}); err != nil {
+		t.Fatalf("allocate subnet %s with range %s error %v", subnet6, nearRange, err)
+	}
+	if ip, err := ipam.Allocate(subnet6); err != nil || ip.String() != "fd00::1:0" {
+		t.Fatalf("allocate ip in range %s got %s, %v", nearRange, ip, err)
+	}
+}
+
+func TestConcurrentAllocate(t *testing.T) {
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("172.30.0.0/24")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	const workers, perWorker = 8, 25
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ips = make(map[string]bool)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 每个 IPAM 对象各自打开锁文件，和多个 tiny-docker 进程同时分配时的情况一致
+			worker := &IPAM{SubnetAllocatorPath: ipam.SubnetAllocatorPath}
+			for j := 0; j < perWorker; j++ {
+				ip, err := worker.Allocate(subnet)
+				if err != nil {
+					t.Errorf("allocate ip error %v", err)
+					return
+				}
+				mu.Lock()
+				if ips[ip.String()] {
+					t.Errorf("ip %s allocated twice", ip)
+				}
+				ips[ip.String()] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(ips) != workers*perWorker {
+		t.Fatalf("allocated %d ips, want %d", len(ips), workers*perWorker)
+	}
+}
+
+func TestLoadLegacyAllocation(t *testing.T) {
+	ipam := newTestIPAM(t)
+	// 旧版本的位图: 网络地址占位、.1 网关、.2 已分配、.3 空闲，最后一位是广播地址占位
+	legacy := `{"192.168.9.0/24":"1110` + strings.Repeat("0", 251) + `1"}`
+	if err := os.WriteFile(ipam.SubnetAllocatorPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, subnet, _ := net.ParseCIDR("192.168.9.0/24")
+	ip, err := ipam.Allocate(subnet)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if ip.String() != "192.168.9.3" {
+		t.Fatalf("allocate from legacy bitmap got %s, want 192.168.9.3", ip)
+	}
+}
+
+func TestBitmap(t *testing.T) {
+	var b bitmap
+	for _, n := range []uint64{0, 1, 2, 3, 4, 5, 6, 7, 9} {
+		b.set(n)
+	}
+	if got, ok := b.firstClear(0, 100); !ok || got != 8 {
+		t.Fatalf("first clear bit is %d, want 8", got)
+	}
+	if got, ok := b.firstClear(9, 100); !ok || got != 10 {
+		t.Fatalf("first clear bit from 9 is %d, want 10", got)
+	}
+	if _, ok := b.firstClear(0, 7); ok {
+		t.Fatalf("bits 0-7 are all set")
+	}
+	if b.count() != 9 {
+		t.Fatalf("bitmap count is %d, want 9", b.count())
+	}
+	b.clear(9)
+	if len(b) != 1 {
+		t.Fatalf("trailing zero bytes should be trimmed, len %d", len(b))
+	}
+	b.set(1 << 20)
+	if !b.test(1<<20) || b.test(1<<20+1) || b.test(1<<30) {
+		t.Fatalf("test bits beyond the first byte failed")
+	}
+}
+
+func TestOffsetSet(t *testing.T) {
+	var s offsetSet
+	for _, n := range []uint64{30, 10, 20, 10, 1 << 63} {
+		s.add(n)
+	}
+	if !reflect.DeepEqual(s, offsetSet{10, 20, 30, 1 << 63}) {
+		t.Fatalf("offset set is %v, want sorted without duplicates", s)
+	}
+	s.remove(20)
+	s.remove(25)
+	if s.contains(20) || !s.contains(30) || len(s) != 3 {
+		t.Fatalf("offset set after remove is %v", s)
+	}
+}
+
+func TestSparseAllocation(t *testing.T) {
+	// 网关在 /8 网段的末尾，不能把位图扩展到网关的偏移
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/8")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{Gateway: net.ParseIP("10.255.255.254")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(subnet, net.ParseIP("10.128.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"10.0.0.1", "10.0.0.2"} {
+		if ip, err := ipam.Allocate(subnet); err != nil || ip.String() != want {
+			t.Fatalf("allocate ip in %s got %s, %v, want %s", subnet, ip, err, want)
+		}
+	}
+	if fi, err := os.Stat(ipam.SubnetAllocatorPath); err != nil || fi.Size() > 512 {
+		t.Fatalf("allocation file should stay small, got %v, %v", fi.Size(), err)
+	}
+	if err := ipam.Reserve(subnet, net.ParseIP("10.128.0.1")); !errors.Is(err, ErrIPInUse) {
+		t.Fatalf("reserve ip twice should fail, got %v", err)
+	}
+	ip := net.ParseIP("10.128.0.1")
+	if err := ipam.Release(subnet, &ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(subnet, ip); err != nil {
+		t.Fatalf("reserve released ip error %v", err)
+	}
+
+	// 位图连续增长到稀疏偏移时，稀疏偏移移回位图，之后的自动分配会跳过它
+	a := &subnetAllocation{}
+	a.allocate(0)
+	a.allocate(17)
+	if len(a.Sparse) != 1 {
+		t.Fatalf("offset 17 should be sparse, got %+v", a)
+	}
+	for n := uint64(1); n < 16; n++ {
+		a.allocate(n)
+	}
+	if got, ok := a.firstFree(0, 100); !ok || got != 16 {
+		t.Fatalf("first free offset is %d, want 16", got)
+	}
+	a.allocate(16)
+	if len(a.Sparse) != 0 || !a.allocated(17) || a.count() != 18 {
+		t.Fatalf("sparse offset should be moved into bitmap, got %+v", a)
+	}
+	if got, ok := a.firstFree(0, 100); !ok || got != 18 {
+		t.Fatalf("first free offset is %d, want 18", got)
+	}
+}
+
+func TestIPv6SparseReserve(t *testing.T) {
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("fd00::/64")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{Gateway: net.ParseIP("fd00::ffff:ffff:ffff:fffe")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"fd00::ffff:ffff:ffff:fffd", "fd00::1:2:3:4"} {
+		if err := ipam.Reserve(subnet, net.ParseIP(ip)); err != nil {
+			t.Fatalf("reserve %s error %v", ip, err)
+		}
+	}
+	if ip, err := ipam.Allocate(subnet); err != nil || ip.String() != "fd00::1" {
+		t.Fatalf("allocate ip in %s got %s, %v", subnet, ip, err)
+	}
+	runtime.ReadMemStats(&after)
+	// 只是读写几次分配文件，不应该分配与偏移大小相关的内存
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("reserve high ipv6 addresses allocated %d bytes", allocated)
+	}
+	if fi, err := os.Stat(ipam.SubnetAllocatorPath); err != nil || fi.Size() > 512 {
+		t.Fatalf("allocation file should stay small, got %v, %v", fi.Size(), err)
+	}
+	if err := ipam.Reserve(subnet, net.ParseIP("fd00::ffff:ffff:ffff:fffe")); !errors.Is(err, ErrIPInUse) {
+		t.Fatalf("reserve gateway should fail, got %v", err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ipam := newTestIPAM(t)
+	_, subnet, _ := net.ParseCIDR("192.168.5.0/24")
+	if _, err := ipam.AllocateSubnet(subnet, SubnetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip   string
+		want error
+	}{
+		{"192.168.5.3", nil},
+		{"192.168.5.3", ErrIPInUse},
+		{"192.168.5.1", ErrIPInUse},
+		{"192.168.5.0", ErrIPOutOfRange},
+		{"192.168.5.255", ErrIPOutOfRange},
+		{"192.168.6.3", ErrIPOutOfRange},
+	}
+	for _, c := range cases {
+		err := ipam.Reserve(subnet, net.ParseIP(c.ip))
+		if c.want == nil && err != nil || c.want != nil && !errors.Is(err, c.want) {
+			t.Fatalf("reserve %s got %v, want %v", c.ip, err, c.want)
+		}
+	}
+	// 自动分配时跳过已经指定的地址
+	for _, want := range []string{"192.168.5.2", "192.168.5.4"} {
+		ip, err := ipam.Allocate(subnet)
+		if err != nil || ip.String() != want {
+			t.Fatalf("allocate got %s %v, want %s", ip, err, want)
+		}
+	}
 }
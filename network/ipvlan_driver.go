@@ -0,0 +1,83 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+var _ Driver = (*IPVlanNetworkDriver)(nil)
+
+// ipvlanModeOption ipvlan 驱动的参数，子设备的工作模式，默认为 l2
+const ipvlanModeOption = "ipvlan_mode"
+
+// ipvlan 驱动支持的工作模式
+var ipvlanModes = map[string]netlink.IPVlanMode{
+	"l2": netlink.IPVLAN_MODE_L2,
+	"l3": netlink.IPVLAN_MODE_L3,
+}
+
+// IPVlanNetworkDriver 在宿主机的父设备上为每个容器创建一个 ipvlan 子设备，子设备与父设备共用 MAC 地址
+// l2 模式下子设备处理 ARP，与 macvlan 类似；l3 模式下父设备按 IP 地址三层转发，子设备之间没有广播和邻居
+type IPVlanNetworkDriver struct {
+}
+
+func (d *IPVlanNetworkDriver) Name() string {
+	return "ipvlan"
+}
+
+// Create 检查父设备是否存在以及工作模式是否合法，ipvlan 网络不需要在宿主机上创建设备
+func (d *IPVlanNetworkDriver) Create(n *Network) error {
+	n.Driver = d.Name()
+	return validateSubInterfaceNetwork(n, map[string]func(value string) error{
+		ipvlanModeOption: func(value string) error {
+			if _, ok := ipvlanModes[value]; !ok {
+				return fmt.Errorf("invalid value %s of option %s, should be l2 or l3", value, ipvlanModeOption)
+			}
+			return nil
+		},
+	})
+}
+
+// Delete ipvlan 网络在宿主机上没有需要清理的设备和规则
+func (d *IPVlanNetworkDriver) Delete(network *Network) error {
+	return nil
+}
+
+// Connect 在父设备上创建 ipvlan 子设备，设备名为 endpoint.Device.PeerName，之后由调用方移动到容器中
+// ipvlan 端点在宿主机一侧没有设备，endpoint.Device.Name 为空
+func (d *IPVlanNetworkDriver) Connect(network *Network, endpoint *Endpoint) error {
+	parent, err := parentLink(network)
+	if err != nil {
+		return err
+	}
+	la := netlink.NewLinkAttrs()
+	la.Name = endpoint.Device.PeerName
+	la.ParentIndex = parent.Attrs().Index
+	link := &netlink.IPVlan{LinkAttrs: la, Mode: network.ipvlanMode()}
+	if err = netlink.LinkAdd(link); err != nil {
+		return errors.Wrapf(err, "add ipvlan [%s] on parent %s failed", la.Name, parent.Attrs().Name)
+	}
+	endpoint.Device.Name = ""
+	return nil
+}
+
+// Disconnect 删除容器中的 ipvlan 子设备
+func (d *IPVlanNetworkDriver) Disconnect(endpoint *Endpoint) error {
+	return deleteSubInterface(endpoint, "ipvlan")
+}
+
+// ipvlanMode 返回 ipvlan 网络的工作模式
+func (nw *Network) ipvlanMode() netlink.IPVlanMode {
+	if mode, ok := ipvlanModes[nw.Options[ipvlanModeOption]]; ok {
+		return mode
+	}
+	return netlink.IPVLAN_MODE_L2
+}
+
+// onLinkDefaultRoute 判断容器的默认路由是否直接指向网卡而不经过网关
+// ipvlan l3 模式下子设备不处理 ARP，无法解析网关的 MAC 地址，由父设备所在的宿主机负责转发
+func (nw *Network) onLinkDefaultRoute() bool {
+	return nw.Driver == (&IPVlanNetworkDriver{}).Name() && nw.ipvlanMode() == netlink.IPVLAN_MODE_L3
+}
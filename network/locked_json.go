@@ -0,0 +1,57 @@
+package network
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/ChenMiaoQiu/tiny-docker/constant"
+	"github.com/pkg/errors"
+)
+
+// updateLockedJSON 在文件锁的保护下将 JSON 文件读取到 v 中，调用 fn 修改 v 后写回
+// 文件不存在或为空时 v 保持原值，IPAM 和 PortAllocator 都通过它完成 读取-修改-写回
+func updateLockedJSON(filePath string, v any, fn func() error) error {
+	dir := path.Dir(filePath)
+	if err := os.MkdirAll(dir, constant.Perm0755); err != nil {
+		return errors.Wrapf(err, "create dir %s failed", dir)
+	}
+	// 写回时通过 rename 替换文件，因此使用单独的锁文件
+	lockPath := filePath + ".lock"
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, constant.Perm0644)
+	if err != nil {
+		return errors.Wrapf(err, "open lock file %s failed", lockPath)
+	}
+	defer lockFile.Close()
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrapf(err, "lock %s failed", lockPath)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "read %s failed", filePath)
+	}
+	if len(content) > 0 {
+		if err = json.Unmarshal(content, v); err != nil {
+			return errors.Wrapf(err, "unmarshal %s failed", filePath)
+		}
+	}
+	if err = fn(); err != nil {
+		return err
+	}
+
+	// 先写入临时文件再 rename，避免写到一半时进程退出导致文件损坏
+	if content, err = json.Marshal(v); err != nil {
+		return errors.Wrapf(err, "marshal %s failed", filePath)
+	}
+	tmpPath := filePath + ".tmp"
+	if err = os.WriteFile(tmpPath, content, constant.Perm0644); err != nil {
+		return errors.Wrapf(err, "write %s failed", tmpPath)
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return errors.Wrapf(err, "rename %s failed", tmpPath)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+var _ Driver = (*MacvlanNetworkDriver)(nil)
+
+// parentOption macvlan 和 ipvlan 驱动的参数，容器网卡挂载的宿主机父设备，例如 parent=eth1
+const parentOption = "parent"
+
+// MacvlanNetworkDriver 在宿主机的父设备上为每个容器创建一个 bridge 模式的 macvlan 子设备
+// 容器拥有独立的 MAC 地址，直接出现在父设备所在的二层网络中，网关通常是这个二层网络中已有的路由器
+// 内核不会在父设备和它的 macvlan 子设备之间转发报文，因此宿主机不能通过父设备直接访问容器
+type MacvlanNetworkDriver struct {
+}
+
+func (d *MacvlanNetworkDriver) Name() string {
+	return "macvlan"
+}
+
+// Create 检查父设备是否存在，macvlan 网络不需要在宿主机上创建设备
+func (d *MacvlanNetworkDriver) Create(n *Network) error {
+	n.Driver = d.Name()
+	return validateSubInterfaceNetwork(n, nil)
+}
+
+// Delete macvlan 网络在宿主机上没有需要清理的设备和规则
+func (d *MacvlanNetworkDriver) Delete(network *Network) error {
+	return nil
+}
+
+// Connect 在父设备上创建 macvlan 子设备，设备名为 endpoint.Device.PeerName，之后由调用方移动到容器中
+// macvlan 端点在宿主机一侧没有设备，endpoint.Device.Name 为空
+func (d *MacvlanNetworkDriver) Connect(network *Network, endpoint *Endpoint) error {
+	parent, err := parentLink(network)
+	if err != nil {
+		return err
+	}
+	la := netlink.NewLinkAttrs()
+	la.Name = endpoint.Device.PeerName
+	la.ParentIndex = parent.Attrs().Index
+	// bridge 模式下同一父设备上的子设备之间可以直接通信
+	link := &netlink.Macvlan{LinkAttrs: la, Mode: netlink.MACVLAN_MODE_BRIDGE}
+	if err = netlink.LinkAdd(link); err != nil {
+		return errors.Wrapf(err, "add macvlan [%s] on parent %s failed", la.Name, parent.Attrs().Name)
+	}
+	endpoint.Device.Name = ""
+	return nil
+}
+
+// Disconnect 删除容器中的 macvlan 子设备
+func (d *MacvlanNetworkDriver) Disconnect(endpoint *Endpoint) error {
+	return deleteSubInterface(endpoint, "macvlan")
+}
+
+// validateSubInterfaceNetwork 检查 macvlan 和 ipvlan 网络的参数，除 parent 外只允许 extra 中的参数
+// 这两种网络的容器直接使用父设备所在网络的网关，不支持内部网络
+func validateSubInterfaceNetwork(n *Network, extra map[string]func(value string) error) error {
+	if n.Internal {
+		return fmt.Errorf("%s driver does not support internal network", n.Driver)
+	}
+	for key, value := range n.Options {
+		if key == parentOption {
+			continue
+		}
+		validate, ok := extra[key]
+		if !ok {
+			return fmt.Errorf("unknown option %s of %s driver", key, n.Driver)
+		}
+		if err := validate(value); err != nil {
+			return err
+		}
+	}
+	_, err := parentLink(n)
+	return err
+}
+
+// parentLink 返回网络的父设备
+func parentLink(n *Network) (netlink.Link, error) {
+	name := n.Options[parentOption]
+	if name == "" {
+		return nil, fmt.Errorf("missing option %s of %s driver, e.g. --opt %s=eth1", parentOption, n.Driver, parentOption)
+	}
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "find parent interface [%s] failed", name)
+	}
+	return link, nil
+}
+
+// deleteSubInterface 删除网络端点的 macvlan 或 ipvlan 子设备
+// 连接失败时子设备可能还在宿主机中，否则到容器的 Net Namespace 中删除，容器退出后子设备已经随 Net Namespace 一起被删除
+func deleteSubInterface(endpoint *Endpoint, linkType string) error {
+	if link, err := netlink.LinkByName(endpoint.Device.PeerName); err == nil {
+		return netlink.LinkDel(link)
+	}
+	if endpoint.ContainerPid == "" {
+		return nil
+	}
+	handle, err := containerNetlinkHandle(endpoint.ContainerPid)
+	if err != nil {
+		return err
+	}
+	defer handle.Delete()
+	link, err := handle.LinkByName(endpoint.Interface)
+	if err != nil {
+		return errors.WithMessagef(err, "find %s [%s] in container failed", linkType, endpoint.Interface)
+	}
+	// 容器进程退出后 pid 可能被复用，只删除类型相同的设备
+	if link.Type() != linkType {
+		return fmt.Errorf("interface %s in container is %s, not %s", endpoint.Interface, link.Type(), linkType)
+	}
+	return handle.LinkDel(link)
+}
@@ -0,0 +1,131 @@
+package network
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// withTestNetNS 在新的 Net Namespace 中执行 fn，并在其中创建名为 parent 的 dummy 设备作为父设备
+// 内核没有 dummy 模块时使用 veth 设备代替
+func withTestNetNS(t *testing.T, parent string, fn func()) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origns, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origns.Close()
+	newns, err := netns.New()
+	if err != nil {
+		t.Skipf("create net namespace failed: %v", err)
+	}
+	defer newns.Close()
+	defer netns.Set(origns)
+
+	var link netlink.Link = &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: parent}}
+	if err = netlink.LinkAdd(link); errors.Is(err, unix.EOPNOTSUPP) {
+		link = &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: parent}, PeerName: parent + "p"}
+		err = netlink.LinkAdd(link)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+	fn()
+}
+
+func TestSubInterfaceDrivers(t *testing.T) {
+	cases := []struct {
+		driver  Driver
+		options map[string]string
+		check   func(link netlink.Link) bool
+	}{
+		{&MacvlanNetworkDriver{}, map[string]string{"parent": "tdparent0"}, func(link netlink.Link) bool {
+			macvlan, ok := link.(*netlink.Macvlan)
+			return ok && macvlan.Mode == netlink.MACVLAN_MODE_BRIDGE
+		}},
+		{&IPVlanNetworkDriver{}, map[string]string{"parent": "tdparent0"}, func(link netlink.Link) bool {
+			ipvlan, ok := link.(*netlink.IPVlan)
+			return ok && ipvlan.Mode == netlink.IPVLAN_MODE_L2
+		}},
+		{&IPVlanNetworkDriver{}, map[string]string{"parent": "tdparent0", "ipvlan_mode": "l3"}, func(link netlink.Link) bool {
+			ipvlan, ok := link.(*netlink.IPVlan)
+			return ok && ipvlan.Mode == netlink.IPVLAN_MODE_L3
+		}},
+	}
+	withTestNetNS(t, "tdparent0", func() {
+		for _, c := range cases {
+			n := &Network{Name: "testvlan", Options: c.options}
+			if err := c.driver.Create(n); err != nil {
+				t.Fatalf("create %s network with %v error %v", c.driver.Name(), c.options, err)
+			}
+			hostVeth, peerVeth := vethNames("testcontainer", "eth0")
+			ep := &Endpoint{
+				ID:        "testcontainer",
+				Device:    netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostVeth}, PeerName: peerVeth},
+				Interface: "eth0",
+				Network:   n,
+			}
+			err := c.driver.Connect(n, ep)
+			if errors.Is(err, unix.EOPNOTSUPP) {
+				t.Logf("kernel does not support %s, skip", c.driver.Name())
+				continue
+			}
+			if err != nil {
+				t.Fatalf("connect %s network with %v error %v", c.driver.Name(), c.options, err)
+			}
+			if ep.Device.Name != "" {
+				t.Fatalf("%s endpoint should not have host interface, got %s", c.driver.Name(), ep.Device.Name)
+			}
+			link, err := netlink.LinkByName(peerVeth)
+			if err != nil {
+				t.Fatalf("find %s link error %v", c.driver.Name(), err)
+			}
+			if !c.check(link) {
+				t.Fatalf("%s link with %v is %#v", c.driver.Name(), c.options, link)
+			}
+			if err = c.driver.Disconnect(ep); err != nil {
+				t.Fatalf("disconnect %s network error %v", c.driver.Name(), err)
+			}
+			if _, err = netlink.LinkByName(peerVeth); err == nil {
+				t.Fatalf("%s link should be deleted after disconnect", c.driver.Name())
+			}
+			if err = c.driver.Delete(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSubInterfaceDriverOptions(t *testing.T) {
+	cases := []struct {
+		driver   Driver
+		options  map[string]string
+		internal bool
+		ok       bool
+	}{
+		{&MacvlanNetworkDriver{}, map[string]string{"parent": "tdparent0"}, false, true},
+		{&MacvlanNetworkDriver{}, nil, false, false},
+		{&MacvlanNetworkDriver{}, map[string]string{"parent": "nonexist0"}, false, false},
+		{&MacvlanNetworkDriver{}, map[string]string{"parent": "tdparent0", "ipvlan_mode": "l3"}, false, false},
+		{&MacvlanNetworkDriver{}, map[string]string{"parent": "tdparent0"}, true, false},
+		{&IPVlanNetworkDriver{}, map[string]string{"parent": "tdparent0", "ipvlan_mode": "l2"}, false, true},
+		{&IPVlanNetworkDriver{}, map[string]string{"parent": "tdparent0", "ipvlan_mode": "l4"}, false, false},
+		{&IPVlanNetworkDriver{}, map[string]string{"parent": "tdparent0", "icc": "false"}, false, false},
+	}
+	withTestNetNS(t, "tdparent0", func() {
+		for _, c := range cases {
+			n := &Network{Name: "testvlan", Options: c.options, Internal: c.internal}
+			if err := c.driver.Create(n); (err == nil) != c.ok {
+				t.Fatalf("create %s network with %v internal %v got error %v, want ok %v", c.driver.Name(), c.options, c.internal, err, c.ok)
+			}
+		}
+	})
+}
@@ -7,30 +7,41 @@ import (
 )
 
 type Network struct {
-	Name    string     // 网络名
-	IPRange *net.IPNet // 地址段
-	Driver  string     // 设备驱动名
+	Name      string            // 网络名
+	IPRange   *net.IPNet        // IPv4 地址段，IP 为网关地址，只有 IPv6 地址的网络为空
+	IPv6Range *net.IPNet        `json:",omitempty"` // IPv6 地址段，IP 为网关地址，没有开启 IPv6 时为空
+	Driver    string            // 设备驱动名
+	Bridge    string            `json:",omitempty"` // 网桥设备名，由 bridge 驱动创建网络时生成
+	Internal  bool              `json:",omitempty"` // 内部网络，容器不能访问外部网络，也没有默认路由
+	Options   map[string]string `json:",omitempty"` // 驱动参数，例如 bridge 驱动的 icc=false
 }
 
 type Endpoint struct {
 	ID          string           `json:"id"`
 	Device      netlink.Veth     `json:"dev"`
 	IPAddress   net.IP           `json:"ip"`
+	IPv6Address net.IP           `json:"ipv6"`
 	MacAddress  net.HardwareAddr `json:"mac"`
+	Interface   string           `json:"interface"` // 容器内的网卡名
 	Network     *Network
 	PortMapping []string
+	// ContainerPid 容器进程的 pid，macvlan、ipvlan 驱动断开连接时需要进入容器的 Net Namespace 删除设备
+	ContainerPid string `json:"-"`
 }
 
 // 网络驱动
 type Driver interface {
 	Name() string
-	Create(subnet string, name string) (*Network, error)
+	Create(network *Network) error
 	Delete(network *Network) error
-	Connect(networkName string, endpoint *Endpoint) error
-	Disconnect(endpointID string) error
+	Connect(network *Network, endpoint *Endpoint) error
+	Disconnect(endpoint *Endpoint) error
 }
 
 type IPAMer interface {
-	Allocate(subnet *net.IPNet) (ip net.IP, err error) // 从指定的 subnet 网段中分配 IP 地址
-	Release(subnet *net.IPNet, ipaddr *net.IP) error   //  从指定的 subnet 网段中释放掉指定的 IP 地址。
+	AllocateSubnet(subnet *net.IPNet, opts SubnetOptions) (gateway net.IP, err error) // 登记网络的 subnet 网段，并保留网关地址
+	ReleaseSubnet(subnet *net.IPNet) error                                            // 删除 subnet 网段的分配信息
+	Allocate(subnet *net.IPNet) (ip net.IP, err error)                                // 从指定的 subnet 网段中分配 IP 地址
+	Reserve(subnet *net.IPNet, ip net.IP) error                                       // 分配 subnet 网段中指定的 IP 地址
+	Release(subnet *net.IPNet, ipaddr *net.IP) error                                  //  从指定的 subnet 网段中释放掉指定的 IP 地址。
 }
@@ -5,15 +5,17 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/ChenMiaoQiu/tiny-docker/constant"
 	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/events"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
@@ -29,6 +31,10 @@ func init() {
 	// 加载网络驱动
 	var bridgeDriver = BridgeNetworkDriver{}
 	drivers[bridgeDriver.Name()] = &bridgeDriver
+	var macvlanDriver = MacvlanNetworkDriver{}
+	drivers[macvlanDriver.Name()] = &macvlanDriver
+	var ipvlanDriver = IPVlanNetworkDriver{}
+	drivers[ipvlanDriver.Name()] = &ipvlanDriver
 
 	// 查找网络文件信息
 	if _, err := os.Stat(defaultNetworkPath); err != nil {
@@ -101,8 +107,14 @@ func (net *Network) load(dumpPath string) error {
 		return err
 	}
 
-	err = json.Unmarshal(netJson[:n], net)
-	return errors.Wrapf(err, "unmarshal %s failed", netJson[:n])
+	if err = json.Unmarshal(netJson[:n], net); err != nil {
+		return errors.Wrapf(err, "unmarshal %s failed", netJson[:n])
+	}
+	// 旧版本创建的 bridge 网络直接以网络名作为网桥名
+	if net.Driver == (&BridgeNetworkDriver{}).Name() && net.Bridge == "" {
+		net.Bridge = net.Name
+	}
+	return nil
 }
 
 // LoadFromFile 读取 defaultNetworkPath 目录下的 Network 信息存放到内存中，便于使用
@@ -132,52 +144,198 @@ func loadNetwork() (map[string]*Network, error) {
 	return networks, err
 }
 
+// ParseSubnets 解析创建网络时指定的网段，每种地址族最多一个网段
+// 只有 enableIPv6 为 true 时才能使用 IPv6 网段，开启 IPv6 时必须指定 IPv6 网段
+func ParseSubnets(subnets []string, enableIPv6 bool) (ipv4 *net.IPNet, ipv6 *net.IPNet, err error) {
+	for _, subnet := range subnets {
+		_, cidr, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid subnet %s", subnet)
+		}
+		if cidr.IP.To4() != nil {
+			if ipv4 != nil {
+				return nil, nil, fmt.Errorf("only one IPv4 subnet is allowed, got %s and %s", ipv4, cidr)
+			}
+			ipv4 = cidr
+			continue
+		}
+		if !enableIPv6 {
+			return nil, nil, fmt.Errorf("IPv6 subnet %s requires --ipv6", subnet)
+		}
+		if ipv6 != nil {
+			return nil, nil, fmt.Errorf("only one IPv6 subnet is allowed, got %s and %s", ipv6, cidr)
+		}
+		ipv6 = cidr
+	}
+	if enableIPv6 && ipv6 == nil {
+		return nil, nil, fmt.Errorf("missing IPv6 subnet, e.g. --subnet fd00::/64")
+	}
+	if ipv4 == nil && ipv6 == nil {
+		return nil, nil, fmt.Errorf("missing subnet")
+	}
+	return ipv4, ipv6, nil
+}
+
+// ParseSubnetOptions 解析创建网络时指定的网关地址和地址分配范围，按地址族对应到 ipv4 和 ipv6 网段
+// 每个网段最多指定一个网关和一个分配范围，网关和分配范围必须在对应的网段内
+func ParseSubnetOptions(gateways []string, ipRanges []string, ipv4 *net.IPNet, ipv6 *net.IPNet) (opts4 SubnetOptions, opts6 SubnetOptions, err error) {
+	// subnetOf 返回 ip 所属地址族的网段和参数
+	subnetOf := func(ip net.IP) (*net.IPNet, *SubnetOptions) {
+		if ip.To4() != nil {
+			return ipv4, &opts4
+		}
+		return ipv6, &opts6
+	}
+	for _, gateway := range gateways {
+		ip := net.ParseIP(gateway)
+		if ip == nil {
+			return opts4, opts6, fmt.Errorf("invalid gateway %s", gateway)
+		}
+		subnet, opts := subnetOf(ip)
+		if subnet == nil || !subnet.Contains(ip) {
+			return opts4, opts6, fmt.Errorf("gateway %s is not in any subnet", gateway)
+		}
+		if opts.Gateway != nil {
+			return opts4, opts6, fmt.Errorf("only one gateway is allowed for subnet %s, got %s and %s", subnet, opts.Gateway, ip)
+		}
+		opts.Gateway = ip
+	}
+	for _, ipRange := range ipRanges {
+		_, cidr, err := net.ParseCIDR(ipRange)
+		if err != nil {
+			return opts4, opts6, fmt.Errorf("invalid ip range %s", ipRange)
+		}
+		subnet, opts := subnetOf(cidr.IP)
+		if subnet == nil || !subnet.Contains(cidr.IP) || maskOnes(cidr) < maskOnes(subnet) {
+			return opts4, opts6, fmt.Errorf("ip range %s is not in any subnet", ipRange)
+		}
+		if opts.IPRange != nil {
+			return opts4, opts6, fmt.Errorf("only one ip range is allowed for subnet %s, got %s and %s", subnet, opts.IPRange, cidr)
+		}
+		opts.IPRange = cidr
+	}
+	return opts4, opts6, nil
+}
+
+// CreateConfig 创建网络的参数
+type CreateConfig struct {
+	Driver      string
+	Name        string
+	IPv4        *net.IPNet        // IPv4 网段，IPv4 和 IPv6 网段至少指定一个
+	IPv6        *net.IPNet        // IPv6 网段
+	IPv4Options SubnetOptions     // IPv4 网段的网关和地址分配范围
+	IPv6Options SubnetOptions     // IPv6 网段的网关和地址分配范围
+	Internal    bool              // 内部网络，容器不能访问外部网络
+	Options     map[string]string // 驱动参数
+}
+
 // CreateNetwork 根据不同 driver 创建 Network
-func CreateNetwork(driver string, subnet string, name string) error {
+func CreateNetwork(config *CreateConfig) error {
 	// 判断是否存在对应driver
-	_, ok := drivers[driver]
+	driver, ok := drivers[config.Driver]
 	if !ok {
 		return fmt.Errorf("not found driver matched")
 	}
-	// 将网段的字符串转换成net. IPNet的对象
-	_, cidr, _ := net.ParseCIDR(subnet)
-	// 通过IPAM分配网关IP，获取到网段中第一个IP作为网关的IP
-	ip, err := ipAllocator.Allocate(cidr)
-	if err != nil {
-		return err
+	nw := &Network{Name: config.Name, Driver: config.Driver, Internal: config.Internal, Options: config.Options}
+	ipv4, ipv6 := config.IPv4, config.IPv6
+	var err error
+	// 通过IPAM登记网段，没有指定网关时获取到网段中第一个IP作为网关的IP
+	if ipv4 != nil {
+		if nw.IPRange, err = allocateGateway(ipv4, config.IPv4Options); err != nil {
+			return err
+		}
+	}
+	if ipv6 != nil {
+		if nw.IPv6Range, err = allocateGateway(ipv6, config.IPv6Options); err != nil {
+			nw.releaseSubnets()
+			return err
+		}
 	}
-	cidr.IP = ip
 
 	// 调用指定的网络驱动创建网络，这里的 drivers 字典是各个网络驱动的实例字典 通过调用网络驱动
 	// Create 方法创建网络
-	net, err := drivers[driver].Create(cidr.String(), name)
-	if err != nil {
+	if err = driver.Create(nw); err != nil {
+		nw.releaseSubnets()
 		return err
 	}
 	// 保存网络信息，将网络的信息保存在文件系统中，以便查询和在网络上连接网络端点
-	return net.dump(defaultNetworkPath)
+	return nw.dump(defaultNetworkPath)
+}
+
+// allocateGateway 登记网段并返回 IP 为网关地址的网段
+func allocateGateway(subnet *net.IPNet, opts SubnetOptions) (*net.IPNet, error) {
+	gateway, err := ipAllocator.AllocateSubnet(subnet, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &net.IPNet{IP: gateway, Mask: subnet.Mask}, nil
+}
+
+// ipRanges 返回网络的全部地址段
+func (nw *Network) ipRanges() []*net.IPNet {
+	ranges := make([]*net.IPNet, 0, 2)
+	for _, ipRange := range []*net.IPNet{nw.IPRange, nw.IPv6Range} {
+		if ipRange != nil {
+			ranges = append(ranges, ipRange)
+		}
+	}
+	return ranges
+}
+
+// releaseSubnets 释放网络登记的全部网段
+func (nw *Network) releaseSubnets() error {
+	for _, ipRange := range nw.ipRanges() {
+		if err := ipAllocator.ReleaseSubnet(ipRange); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListNetworks 返回当前全部 Network 信息，按网络名排序
+func ListNetworks() ([]*Network, error) {
+	networks, err := loadNetwork()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load network from file failed")
+	}
+	result := make([]*Network, 0, len(networks))
+	for _, net := range networks {
+		result = append(result, net)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
 }
 
 // ListNetwork 打印出当前全部 Network 信息
 func ListNetwork() {
-	networks, err := loadNetwork()
+	networks, err := ListNetworks()
 	if err != nil {
-		logrus.Errorf("load network from file failed,detail: %v", err)
+		logrus.Errorf("list network failed,detail: %v", err)
 		return
 	}
+	PrintNetworks(networks)
+}
+
+// PrintNetworks 以表格形式打印 Network 信息
+func PrintNetworks(networks []*Network) {
 	// 通过tabwriter库把信息打印到屏幕上
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	fmt.Fprint(w, "NAME\tIpRange\tDriver\n")
 	for _, net := range networks {
+		ranges := make([]string, 0, 2)
+		for _, ipRange := range net.ipRanges() {
+			ranges = append(ranges, ipRange.String())
+		}
 		fmt.Fprintf(w, "%s\t%s\t%s\n",
 			net.Name,
-			net.IPRange.String(),
+			strings.Join(ranges, ","),
 			net.Driver,
 		)
 	}
-	if err = w.Flush(); err != nil {
+	if err := w.Flush(); err != nil {
 		logrus.Errorf("Flush error %v", err)
-		return
 	}
 }
 
@@ -192,9 +350,21 @@ func DeleteNetwork(networkName string) error {
 	if !ok {
 		return fmt.Errorf("no Such Network: %s", networkName)
 	}
-	// 调用IPAM的实例ipAllocator释放网络网关的IP
-	if err = ipAllocator.Release(net.IPRange, &net.IPRange.IP); err != nil {
-		return errors.Wrap(err, "remove Network gateway ip failed")
+	// 还有容器连接这个网络时不允许删除
+	infos, err := container.ListInfos()
+	if err != nil {
+		return errors.WithMessage(err, "list container info failed")
+	}
+	for _, info := range infos {
+		if info.Endpoint(networkName) != nil {
+			return fmt.Errorf("network %s has active endpoints, container %s is still connected", networkName, info.Name)
+		}
+	}
+	// 结束网络的 DNS 进程，之后才能删除它监听的网关地址
+	stopDNS(networkName)
+	// 调用IPAM的实例ipAllocator释放网段，包括网络网关的IP
+	if err = net.releaseSubnets(); err != nil {
+		return errors.Wrap(err, "release network subnet failed")
 	}
 	// 调用网络驱动删除网络创建的设备与配置
 	if err = drivers[net.Driver].Delete(net); err != nil {
@@ -204,68 +374,286 @@ func DeleteNetwork(networkName string) error {
 	return net.remove(defaultNetworkPath)
 }
 
+// ConnectOptions 容器连接网络的参数
+type ConnectOptions struct {
+	IP          net.IP   // 指定容器的 IPv4 或 IPv6 地址，为空时自动分配
+	Aliases     []string // 容器在网络中的别名
+	PortMapping []string // 发布到宿主机的端口，格式为 [hostIP:]hostPort[-end]:containerPort[-end][/proto]
+}
+
 // Connect 连接容器到之前创建的网络 mydocker run -net testnet -p 8080:80 xxxx
-func Connect(networkName string, info *container.Info) (net.IP, error) {
-	networks, err := loadNetwork()
+// 容器每连接一个网络都会在容器中创建一个新的网卡，依次命名为 eth0、eth1...，第一个非内部网络作为容器的默认路由
+// 网络开启了 IPv6 时同时分配 IPv4 和 IPv6 地址，返回需要记录到容器信息中的网络端点
+// 内部网络以及 macvlan、ipvlan 网络不支持端口映射，指定的端口映射会被忽略
+// 宿主机端口已经被其他容器映射时返回 ErrPortInUse，记录的端口映射中包含随机分配的宿主机端口
+func Connect(networkName string, info *container.Info, opts *ConnectOptions) (*container.Endpoint, error) {
+	if opts == nil {
+		opts = &ConnectOptions{}
+	}
+	network, err := getNetwork(networkName)
 	if err != nil {
-		return nil, errors.WithMessage(err, "load network from file failed")
+		return nil, err
 	}
-	// 从networks字典中取到容器连接的网络的信息，networks字典中保存了当前己经创建的网络
-	network, ok := networks[networkName]
-	if !ok {
-		return nil, fmt.Errorf("no Such Network: %s", networkName)
+	if info.Endpoint(networkName) != nil {
+		return nil, fmt.Errorf("container %s is already connected to network %s", info.Id, networkName)
 	}
 
-	// 分配容器IP地址
-	ip, err := ipAllocator.Allocate(network.IPRange)
-	if err != nil {
-		return ip, errors.Wrapf(err, "allocate ip")
+	portMapping := opts.PortMapping
+	if network.Internal && len(portMapping) > 0 {
+		logrus.Warnf("network %s is internal, ignore port mapping %v", networkName, portMapping)
+		portMapping = nil
+	}
+	// macvlan、ipvlan 网络的容器地址在父设备所在的网络中可以直接访问，不需要端口映射
+	if network.Driver != (&BridgeNetworkDriver{}).Name() && len(portMapping) > 0 {
+		logrus.Warnf("network %s uses %s driver, ignore port mapping %v", networkName, network.Driver, portMapping)
+		portMapping = nil
 	}
+
 	// 创建网络端点
+	iface := info.NextInterface()
+	hostVeth, peerVeth := vethNames(info.Id, iface)
 	ep := &Endpoint{
-		ID:          fmt.Sprintf("%s-%s", info.Id, networkName),
-		IPAddress:   ip,
-		Network:     network,
-		PortMapping: info.PortMapping,
+		ID:           endpointID(info.Id, networkName),
+		Device:       netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostVeth}, PeerName: peerVeth},
+		Interface:    iface,
+		Network:      network,
+		PortMapping:  portMapping,
+		ContainerPid: info.Pid,
+	}
+	// 分配容器IP地址
+	if err = allocateEndpointIPs(ep, opts.IP); err != nil {
+		return nil, err
+	}
+	// 登记宿主机端口，端口冲突时在创建设备之前失败
+	if err = reservePorts(ep); err != nil {
+		releaseEndpointIPs(ep)
+		return nil, err
 	}
 	// 调用网络驱动挂载和配置网络端点
-	if err = drivers[network.Driver].Connect(network.Name, ep); err != nil {
-		return ip, err
+	if err = drivers[network.Driver].Connect(network, ep); err != nil {
+		releaseEndpoint(ep)
+		return nil, err
 	}
 	// 到容器的namespace配置容器网络设备IP地址
-	if err = configEndpointIpAddressAndRoute(ep, info); err != nil {
-		return ip, err
+	if err = configEndpointIpAddressAndRoute(ep, info, needDefaultRoute(network, info)); err != nil {
+		removeEndpoint(ep)
+		return nil, err
 	}
 	// 配置端口映射信息，例如 mydocker run -p 8080:80
-	return ip, addPortMapping(ep)
+	if err = addFirewallRules(endpointOwner(ep.ID), portMappingRules(ep)); err != nil {
+		removeEndpoint(ep)
+		return nil, err
+	}
+	events.Log(events.TypeNetwork, events.ActionConnect, networkName, map[string]string{"container": info.Id})
+	return ep.record(opts.Aliases), nil
 }
 
-// Disconnect 将容器中指定网络中移除
-func Disconnect(networkName string, info *container.Info) error {
-	networks, err := loadNetwork()
+// Disconnect 将容器从网络中断开，删除容器中对应的网卡，并释放地址和端口映射
+func Disconnect(info *container.Info, record *container.Endpoint) error {
+	network, err := getNetwork(record.Network)
 	if err != nil {
-		return errors.WithMessage(err, "load network from file failed")
+		return err
 	}
-	// 从networks字典中取到容器连接的网络的信息，networks字典中保存了当前己经创建的网络
-	network, ok := networks[networkName]
-	if !ok {
-		return fmt.Errorf("no Such Network: %s", networkName)
+	// veth 从 bridge 解绑并删除 veth-pair 设备对，容器退出后 veth 已经随容器的 Net Namespace 一起被删除
+	removeEndpoint(endpointFromRecord(info, record, network))
+	events.Log(events.TypeNetwork, events.ActionDisconnect, record.Network, map[string]string{"container": info.Id})
+	return nil
+}
+
+// needDefaultRoute 判断连接 network 时是否需要配置容器的默认路由
+// 容器连接的第一个非内部网络作为默认路由，内部网络不配置默认路由
+func needDefaultRoute(network *Network, info *container.Info) bool {
+	if network.Internal {
+		return false
+	}
+	for _, record := range info.Endpoints {
+		nw, err := getNetwork(record.Network)
+		if err != nil || !nw.Internal {
+			return false
+		}
 	}
-	// veth 从 bridge 解绑并删除 veth-pair 设备对
-	drivers[network.Driver].Disconnect(fmt.Sprintf("%s-%s", info.Id, networkName))
+	return true
+}
 
-	// 清理端口映射添加的 iptables 规则
-	ep := &Endpoint{
-		ID:          fmt.Sprintf("%s-%s", info.Id, networkName),
-		IPAddress:   net.ParseIP(info.IP),
-		Network:     network,
-		PortMapping: info.PortMapping,
+// endpointFromRecord 根据容器信息中记录的网络端点还原网络端点
+func endpointFromRecord(info *container.Info, record *container.Endpoint, network *Network) *Endpoint {
+	_, peerVeth := vethNames(info.Id, record.Interface)
+	return &Endpoint{
+		ID:           endpointID(info.Id, record.Network),
+		Device:       netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: record.HostInterface}, PeerName: peerVeth},
+		Interface:    record.Interface,
+		IPAddress:    net.ParseIP(record.IP),
+		IPv6Address:  net.ParseIP(record.IPv6),
+		Network:      network,
+		PortMapping:  record.PortMapping,
+		ContainerPid: info.Pid,
 	}
-	return deletePortMapping(ep)
 }
 
-// configEndpointIpAddressAndRoute 配置容器网络端点的地址和路由
-func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.Info) error {
+// removeEndpoint 删除网络端点的设备、端口映射并释放地址
+func removeEndpoint(ep *Endpoint) {
+	if err := drivers[ep.Network.Driver].Disconnect(ep); err != nil {
+		logrus.Debugf("remove endpoint %s device, detail: %v", ep.ID, err)
+	}
+	if err := deleteFirewallRules(endpointOwner(ep.ID), portMappingRules(ep)); err != nil {
+		logrus.Errorf("delete port mapping of endpoint %s failed, detail: %v", ep.ID, err)
+	}
+	releaseEndpoint(ep)
+}
+
+// releaseEndpoint 释放网络端点登记的宿主机端口和分配到的地址
+func releaseEndpoint(ep *Endpoint) {
+	if err := portAllocator.Release(ep.ID); err != nil {
+		logrus.Errorf("release host ports of endpoint %s failed, detail: %v", ep.ID, err)
+	}
+	releaseEndpointIPs(ep)
+}
+
+// reservePorts 解析网络端点的端口映射并登记宿主机端口，之后 ep.PortMapping 中每一项对应一个端口
+func reservePorts(ep *Endpoint) error {
+	if len(ep.PortMapping) == 0 {
+		return nil
+	}
+	bindings, err := parsePortBindings(ep.PortMapping)
+	if err != nil {
+		return err
+	}
+	if err = portAllocator.Reserve(ep.ID, bindings); err != nil {
+		return err
+	}
+	ep.PortMapping = make([]string, 0, len(bindings))
+	for _, binding := range bindings {
+		ep.PortMapping = append(ep.PortMapping, binding.String())
+	}
+	return nil
+}
+
+// endpointID 返回容器在网络中的网络端点id
+func endpointID(containerId string, networkName string) string {
+	return fmt.Sprintf("%s-%s", containerId, networkName)
+}
+
+// record 返回记录到容器信息中的网络端点
+func (ep *Endpoint) record(aliases []string) *container.Endpoint {
+	record := &container.Endpoint{
+		Network:       ep.Network.Name,
+		Interface:     ep.Interface,
+		HostInterface: ep.Device.Name,
+		Aliases:       aliases,
+		PortMapping:   ep.PortMapping,
+	}
+	if ep.IPAddress != nil {
+		record.IP = ep.IPAddress.String()
+	}
+	if ep.IPv6Address != nil {
+		record.IPv6 = ep.IPv6Address.String()
+	}
+	return record
+}
+
+// allocateEndpointIPs 为网络端点分配地址，指定了 ip 时对应的地址族使用指定的地址
+func allocateEndpointIPs(ep *Endpoint, ip net.IP) error {
+	network := ep.Network
+	if ip != nil {
+		ipRange := network.IPRange
+		if ip.To4() == nil {
+			ipRange = network.IPv6Range
+		}
+		if ipRange == nil || !ipRange.Contains(ip) {
+			return errors.WithMessagef(ErrIPOutOfRange, "%s is not in any subnet of network %s", ip, network.Name)
+		}
+		if err := ipAllocator.Reserve(ipRange, ip); err != nil {
+			return err
+		}
+		if ip.To4() != nil {
+			ep.IPAddress = ip.To4()
+		} else {
+			ep.IPv6Address = ip
+		}
+	}
+	var err error
+	if network.IPRange != nil && ep.IPAddress == nil {
+		if ep.IPAddress, err = ipAllocator.Allocate(network.IPRange); err != nil {
+			releaseEndpointIPs(ep)
+			return errors.WithMessage(err, "allocate ip")
+		}
+	}
+	if network.IPv6Range != nil && ep.IPv6Address == nil {
+		if ep.IPv6Address, err = ipAllocator.Allocate(network.IPv6Range); err != nil {
+			releaseEndpointIPs(ep)
+			return errors.WithMessage(err, "allocate ipv6")
+		}
+	}
+	return nil
+}
+
+// releaseEndpointIPs 释放网络端点分配到的 IPv4 和 IPv6 地址
+func releaseEndpointIPs(ep *Endpoint) {
+	if ep.IPAddress != nil && ep.Network.IPRange != nil {
+		if err := ipAllocator.Release(ep.Network.IPRange, &ep.IPAddress); err != nil {
+			logrus.Errorf("release container ip %s failed, detail: %v", ep.IPAddress, err)
+		}
+	}
+	if ep.IPv6Address != nil && ep.Network.IPv6Range != nil {
+		if err := ipAllocator.Release(ep.Network.IPv6Range, &ep.IPv6Address); err != nil {
+			logrus.Errorf("release container ipv6 %s failed, detail: %v", ep.IPv6Address, err)
+		}
+	}
+}
+
+// EndpointStats 容器网络端点的流量统计，以容器视角计算收发方向
+type EndpointStats struct {
+	RxBytes uint64 `json:"rxBytes"`
+	TxBytes uint64 `json:"txBytes"`
+}
+
+// GetEndpointStats 通过宿主机一侧 veth 的统计信息获取容器在所有网络中的流量
+// 宿主机一侧发送的数据即为容器接收的数据，反之亦然
+// macvlan、ipvlan 端点在宿主机一侧没有设备，直接读取容器中网卡的统计信息
+func GetEndpointStats(info *container.Info) (*EndpointStats, error) {
+	stats := &EndpointStats{}
+	for _, ep := range info.Endpoints {
+		if ep.HostInterface == "" {
+			statistics, err := containerLinkStatistics(info.Pid, ep.Interface)
+			if err != nil {
+				return nil, err
+			}
+			if statistics != nil {
+				stats.RxBytes += statistics.RxBytes
+				stats.TxBytes += statistics.TxBytes
+			}
+			continue
+		}
+		veth, err := netlink.LinkByName(ep.HostInterface)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "find veth [%s] failed", ep.HostInterface)
+		}
+		statistics := veth.Attrs().Statistics
+		if statistics == nil {
+			continue
+		}
+		stats.RxBytes += statistics.TxBytes
+		stats.TxBytes += statistics.RxBytes
+	}
+	return stats, nil
+}
+
+// containerLinkStatistics 获取容器 Net Namespace 中网卡的统计信息
+func containerLinkStatistics(pid string, linkName string) (*netlink.LinkStatistics, error) {
+	handle, err := containerNetlinkHandle(pid)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Delete()
+	link, err := handle.LinkByName(linkName)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "find interface [%s] in container failed", linkName)
+	}
+	return link.Attrs().Statistics, nil
+}
+
+// configEndpointIpAddressAndRoute 配置容器网络端点的地址和路由，defaultRoute 为 true 时将这个网络作为容器的默认路由
+func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.Info, defaultRoute bool) error {
 	// 根据名字找到对应Veth设备
 	peerLink, err := netlink.LinkByName(ep.Device.PeerName)
 	if err != nil {
@@ -275,18 +663,28 @@ func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.Info) error {
 	// 并使这个函数下面的操作都在这个网络空间中进行
 	// 执行完函数后，恢复为默认的网络空间，具体实现下面再做介绍
 	defer enterContainerNetNS(&peerLink, info)()
+	// 在容器中将 veth 设备重命名为 eth0、eth1...
+	link, err := netlink.LinkByName(ep.Device.PeerName)
+	if err != nil {
+		return errors.WithMessagef(err, "found veth [%s] in container failed", ep.Device.PeerName)
+	}
+	if err = netlink.LinkSetName(link, ep.Interface); err != nil {
+		return errors.Wrapf(err, "rename veth [%s] to %s failed", ep.Device.PeerName, ep.Interface)
+	}
 	// 获取到容器的IP地址及网段，用于配置容器内部接口地址
 	// 比如容器IP是192.168.1.2， 而网络的网段是192.168.1.0/24
 	// 那么这里产出的IP字符串就是192.168.1.2/24，用于容器内Veth端点配置
-
-	interfaceIP := *ep.Network.IPRange
-	interfaceIP.IP = ep.IPAddress
-	// 设置容器内Veth端点的IP
-	if err = setInterfaceIP(ep.Device.PeerName, interfaceIP.String()); err != nil {
-		return fmt.Errorf("%v,%s", ep.Network, err)
+	// 网络开启了 IPv6 时同样配置 IPv6 地址，如 fd00::2/64
+	families := ep.addressFamilies()
+	for _, family := range families {
+		interfaceIP := &net.IPNet{IP: family.ip, Mask: family.ipRange.Mask}
+		// 设置容器内Veth端点的IP
+		if err = setInterfaceIP(ep.Interface, interfaceIP.String()); err != nil {
+			return fmt.Errorf("%v,%s", ep.Network, err)
+		}
 	}
 	// 启动容器内的Veth端点
-	if err = setInterfaceUP(ep.Device.PeerName); err != nil {
+	if err = setInterfaceUP(ep.Interface); err != nil {
 		return err
 	}
 	// Net Namespace 中默认本地地址 127.0.0.1 的网卡是关闭状态的
@@ -294,25 +692,53 @@ func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.Info) error {
 	if err = setInterfaceUP("lo"); err != nil {
 		return err
 	}
-	// 设置容器内的外部请求都通过容器内的Veth端点访问
-	// 0.0.0.0/0的网段，表示所有的IP地址段
-	_, cidr, _ := net.ParseCIDR("0.0.0.0/0")
-	// 构建要添加的路由数据，包括网络设备、网关IP及目的网段
-	// 相当于route add -net 0.0.0.0/0 gw (Bridge网桥地址) dev (容器内的Veth端点设备)
-	defaultRoute := &netlink.Route{
-		LinkIndex: peerLink.Attrs().Index,
-		Gw:        ep.Network.IPRange.IP,
-		Dst:       cidr,
-	}
-	// 调用netlink的RouteAdd,添加路由到容器的网络空间
-	// RouteAdd 函数相当于route add 命令
-	if err = netlink.RouteAdd(defaultRoute); err != nil {
-		return err
+	if !defaultRoute {
+		return nil
+	}
+	for _, family := range families {
+		// 设置容器内的外部请求都通过容器内的Veth端点访问
+		// IPv4 使用 0.0.0.0/0 的网段，IPv6 使用 ::/0 的网段，表示所有的IP地址段
+		_, cidr, _ := net.ParseCIDR(family.defaultDst)
+		// 构建要添加的路由数据，包括网络设备、网关IP及目的网段
+		// 相当于route add -net 0.0.0.0/0 gw (Bridge网桥地址) dev (容器内的Veth端点设备)
+		route := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Gw:        family.ipRange.IP,
+			Dst:       cidr,
+		}
+		// 相当于route add -net 0.0.0.0/0 dev (容器内的网卡)，由父设备所在的宿主机转发
+		if ep.Network.onLinkDefaultRoute() {
+			route.Gw = nil
+			route.Scope = netlink.SCOPE_LINK
+		}
+		// 调用netlink的RouteAdd,添加路由到容器的网络空间
+		// RouteAdd 函数相当于route add 命令
+		if err = netlink.RouteAdd(route); err != nil {
+			return errors.Wrapf(err, "add default route %s via %s failed", family.defaultDst, family.ipRange.IP)
+		}
 	}
-
 	return nil
 }
 
+// endpointAddress 网络端点的一个地址族的地址
+type endpointAddress struct {
+	ip         net.IP     // 容器地址
+	ipRange    *net.IPNet // 网络的地址段，IP 为网关地址
+	defaultDst string     // 默认路由的目的网段
+}
+
+// addressFamilies 返回网络端点已经分配的 IPv4 和 IPv6 地址
+func (ep *Endpoint) addressFamilies() []endpointAddress {
+	families := make([]endpointAddress, 0, 2)
+	if ep.IPAddress != nil && ep.Network.IPRange != nil {
+		families = append(families, endpointAddress{ip: ep.IPAddress, ipRange: ep.Network.IPRange, defaultDst: "0.0.0.0/0"})
+	}
+	if ep.IPv6Address != nil && ep.Network.IPv6Range != nil {
+		families = append(families, endpointAddress{ip: ep.IPv6Address, ipRange: ep.Network.IPv6Range, defaultDst: "::/0"})
+	}
+	return families
+}
+
 // enterContainerNetNS 将容器的网络端点加入到容器的网络空间中
 // 并锁定当前程序所执行的线程，使当前线程进入到容器的网络空间
 // 返回值是一个函数指针，执行这个返回函数才会退出容器的网络空间，回归到宿主机的网络空间
@@ -360,44 +786,25 @@ func enterContainerNetNS(enLink *netlink.Link, info *container.Info) func() {
 	}
 }
 
-func addPortMapping(ep *Endpoint) error {
-	return configPortMapping(ep, false)
-}
-
-func deletePortMapping(ep *Endpoint) error {
-	return configPortMapping(ep, true)
-}
-
-// configPortMapping 配置端口映射
-func configPortMapping(ep *Endpoint, isDelete bool) error {
-	action := "-A"
-	if isDelete {
-		action = "-D"
+// containerNetlinkHandle 返回在容器 Net Namespace 中操作网络设备的 netlink 句柄，使用完需要调用 Delete 释放
+// 容器进程不在独立的 Net Namespace 中时返回错误，避免误操作宿主机的网络设备
+func containerNetlinkHandle(pid string) (*netlink.Handle, error) {
+	pidInt, err := strconv.Atoi(pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid container pid %s", pid)
 	}
-
-	var err error
-	// 遍历容器端口映射列表
-	for _, pm := range ep.PortMapping {
-		// 分割成宿主机的端口和容器的端口
-		portMapping := strings.Split(pm, ":")
-		if len(portMapping) != 2 {
-			logrus.Errorf("port mapping format error, %v", pm)
-			continue
-		}
-		// 由于iptables没有Go语言版本的实现，所以采用exec.Command的方式直接调用命令配置
-		// 在iptables的PREROUTING中添加DNAT规则
-		// 将宿主机的端口请求转发到容器的地址和端口上
-		// iptables -t nat -A PREROUTING ! -i testbridge -p tcp -m tcp --dport 8080 -j DNAT --to-destination 10.0.0.4:80
-		iptablesCmd := fmt.Sprintf("-t nat %s PREROUTING ! -i %s -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
-			action, ep.Network.Name, portMapping[0], ep.IPAddress.String(), portMapping[1])
-		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-		logrus.Infoln("配置端口映射 DNAT cmd:", cmd.String())
-		// 执行iptables命令,添加端口映射转发规则
-		output, err := cmd.Output()
-		if err != nil {
-			logrus.Errorf("iptables Output, %v", output)
-			continue
-		}
+	ns, err := netns.GetFromPid(pidInt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get net namespace of pid %s failed", pid)
+	}
+	defer ns.Close()
+	hostNS, err := netns.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "get current net namespace failed")
+	}
+	defer hostNS.Close()
+	if ns.Equal(hostNS) {
+		return nil, fmt.Errorf("process %s is not in a container net namespace", pid)
 	}
-	return err
+	return netlink.NewHandleAt(ns)
 }
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseSubnets(t *testing.T) {
+	cases := []struct {
+		subnets []string
+		ipv6    bool
+		want4   string
+		want6   string
+		fail    bool
+	}{
+		{[]string{"10.0.0.0/24"}, false, "10.0.0.0/24", "", false},
+		{[]string{"fd00::/64"}, true, "", "fd00::/64", false},
+		{[]string{"10.0.0.0/24", "fd00::/64"}, true, "10.0.0.0/24", "fd00::/64", false},
+		{[]string{"fd00::/64"}, false, "", "", true},
+		{[]string{"10.0.0.0/24"}, true, "", "", true},
+		{[]string{"10.0.0.0/24", "10.1.0.0/24"}, false, "", "", true},
+		{[]string{"fd00::/64", "fd01::/64"}, true, "", "", true},
+		{[]string{"10.0.0.300/24"}, false, "", "", true},
+		{nil, false, "", "", true},
+	}
+	for _, c := range cases {
+		ipv4, ipv6, err := ParseSubnets(c.subnets, c.ipv6)
+		if c.fail {
+			if err == nil {
+				t.Fatalf("parse %v with ipv6=%v should fail", c.subnets, c.ipv6)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse %v with ipv6=%v error %v", c.subnets, c.ipv6, err)
+		}
+		if got := ipNetString(ipv4); got != c.want4 {
+			t.Fatalf("parse %v ipv4 subnet is %s, want %s", c.subnets, got, c.want4)
+		}
+		if got := ipNetString(ipv6); got != c.want6 {
+			t.Fatalf("parse %v ipv6 subnet is %s, want %s", c.subnets, got, c.want6)
+		}
+	}
+}
+
+func TestParseSubnetOptions(t *testing.T) {
+	_, ipv4, _ := net.ParseCIDR("10.0.0.0/24")
+	_, ipv6, _ := net.ParseCIDR("fd00::/64")
+	cases := []struct {
+		gateways []string
+		ipRanges []string
+		want4    string // 网关 分配范围
+		want6    string
+		fail     bool
+	}{
+		{nil, nil, "<nil> ", "<nil> ", false},
+		{[]string{"10.0.0.254"}, []string{"10.0.0.128/25"}, "10.0.0.254 10.0.0.128/25", "<nil> ", false},
+		{[]string{"fd00::1", "10.0.0.1"}, []string{"fd00::100/120"}, "10.0.0.1 ", "fd00::1 fd00::100/120", false},
+		{[]string{"10.0.0.1", "10.0.0.2"}, nil, "", "", true},
+		{[]string{"10.1.0.1"}, nil, "", "", true},
+		{[]string{"gateway"}, nil, "", "", true},
+		{nil, []string{"10.0.0.0/16"}, "", "", true},
+		{nil, []string{"10.0.0.0/25", "10.0.0.128/25"}, "", "", true},
+		{nil, []string{"10.0.0.300/25"}, "", "", true},
+	}
+	for _, c := range cases {
+		opts4, opts6, err := ParseSubnetOptions(c.gateways, c.ipRanges, ipv4, ipv6)
+		if c.fail {
+			if err == nil {
+				t.Fatalf("parse gateways %v ip ranges %v should fail", c.gateways, c.ipRanges)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse gateways %v ip ranges %v error %v", c.gateways, c.ipRanges, err)
+		}
+		if got := opts4.Gateway.String() + " " + ipNetString(opts4.IPRange); got != c.want4 {
+			t.Fatalf("parse gateways %v ip ranges %v ipv4 options is %q, want %q", c.gateways, c.ipRanges, got, c.want4)
+		}
+		if got := opts6.Gateway.String() + " " + ipNetString(opts6.IPRange); got != c.want6 {
+			t.Fatalf("parse gateways %v ip ranges %v ipv6 options is %q, want %q", c.gateways, c.ipRanges, got, c.want6)
+		}
+	}
+}
+
+func ipNetString(ipNet *net.IPNet) string {
+	if ipNet == nil {
+		return ""
+	}
+	return ipNet.String()
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	portAllocatorDefaultPath = "/var/lib/tiny-docker/network/ipam/ports.json"
+	// 未指定宿主机端口时从这个范围内随机分配
+	dynamicPortStart = 49153
+	dynamicPortEnd   = 65535
+)
+
+var (
+	// ErrPortInUse 宿主机端口已经被其他容器映射
+	ErrPortInUse = errors.New("host port is already allocated")
+	// ErrNoAvailablePort 随机分配的端口范围已经耗尽
+	ErrNoAvailablePort = errors.New("no available host port")
+)
+
+// PortAllocator 记录已经发布到宿主机的端口，保证同一个宿主机端口只会映射给一个容器
+// 和 IPAM 一样在文件锁的保护下完成 读取-修改-写回
+type PortAllocator struct {
+	AllocatorPath string // 分配文件存放位置
+}
+
+// portReservation 一个已经分配的宿主机端口
+type portReservation struct {
+	Endpoint string `json:"endpoint"` // 使用这个端口的网络端点id
+	HostIP   string `json:"hostIp,omitempty"`
+	HostPort int    `json:"hostPort"`
+	Proto    string `json:"proto"`
+}
+
+// conflicts 判断端口是否与 binding 冲突，没有指定宿主机地址的映射与同一端口上的所有映射冲突
+func (r *portReservation) conflicts(binding *PortBinding) bool {
+	if r.Proto != binding.Proto || r.HostPort != binding.HostPort {
+		return false
+	}
+	return r.HostIP == "" || binding.HostIP == "" || r.HostIP == binding.HostIP
+}
+
+var portAllocator = &PortAllocator{
+	AllocatorPath: portAllocatorDefaultPath,
+}
+
+// Reserve 为网络端点登记宿主机端口，HostPort 为 0 的映射会随机分配一个空闲端口并写回 bindings
+// 任意一个端口冲突时返回 ErrPortInUse，此时不会登记任何端口
+func (pa *PortAllocator) Reserve(endpointId string, bindings []PortBinding) error {
+	return pa.update(func(reservations []*portReservation) ([]*portReservation, error) {
+		for i := range bindings {
+			binding := &bindings[i]
+			if binding.HostPort == 0 {
+				port, err := freeDynamicPort(reservations, binding)
+				if err != nil {
+					return nil, err
+				}
+				binding.HostPort = port
+			}
+			for _, r := range reservations {
+				if r.conflicts(binding) {
+					return nil, errors.WithMessagef(ErrPortInUse, "%s/%s is used by endpoint %s",
+						binding.HostAddress(), binding.Proto, r.Endpoint)
+				}
+			}
+			reservations = append(reservations, &portReservation{
+				Endpoint: endpointId,
+				HostIP:   binding.HostIP,
+				HostPort: binding.HostPort,
+				Proto:    binding.Proto,
+			})
+		}
+		return reservations, nil
+	})
+}
+
+// Release 释放网络端点登记的全部宿主机端口
+func (pa *PortAllocator) Release(endpointId string) error {
+	return pa.update(func(reservations []*portReservation) ([]*portReservation, error) {
+		kept := reservations[:0]
+		for _, r := range reservations {
+			if r.Endpoint != endpointId {
+				kept = append(kept, r)
+			}
+		}
+		return kept, nil
+	})
+}
+
+// retain 只保留 endpoints 中的网络端点登记的端口，释放已经不存在的网络端点残留的端口
+func (pa *PortAllocator) retain(endpoints map[string]bool) error {
+	return pa.update(func(reservations []*portReservation) ([]*portReservation, error) {
+		kept := reservations[:0]
+		for _, r := range reservations {
+			if endpoints[r.Endpoint] {
+				kept = append(kept, r)
+			}
+		}
+		return kept, nil
+	})
+}
+
+// freeDynamicPort 从随机位置开始查找一个不与已分配端口冲突的端口
+func freeDynamicPort(reservations []*portReservation, binding *PortBinding) (int, error) {
+	size := dynamicPortEnd - dynamicPortStart + 1
+	offset := rand.Intn(size)
+	for i := 0; i < size; i++ {
+		candidate := *binding
+		candidate.HostPort = dynamicPortStart + (offset+i)%size
+		used := false
+		for _, r := range reservations {
+			if r.conflicts(&candidate) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return candidate.HostPort, nil
+		}
+	}
+	return 0, errors.WithMessagef(ErrNoAvailablePort, "%d-%d/%s", dynamicPortStart, dynamicPortEnd, binding.Proto)
+}
+
+// update 在文件锁的保护下读取分配信息，调用 fn 修改后写回
+func (pa *PortAllocator) update(fn func(reservations []*portReservation) ([]*portReservation, error)) error {
+	var reservations []*portReservation
+	return updateLockedJSON(pa.AllocatorPath, &reservations, func() (err error) {
+		reservations, err = fn(reservations)
+		return err
+	})
+}
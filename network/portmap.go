@@ -0,0 +1,156 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultPortProto = "tcp"
+
+// 支持的端口映射协议
+var portProtos = map[string]bool{"tcp": true, "udp": true, "sctp": true}
+
+// PortBinding 发布到宿主机的一个端口
+type PortBinding struct {
+	HostIP        string `json:"hostIp,omitempty"` // 为空时转发宿主机所有地址上的请求
+	HostPort      int    `json:"hostPort"`         // 为 0 时在连接网络时随机分配
+	ContainerPort int    `json:"containerPort"`
+	Proto         string `json:"proto"`
+}
+
+// String 返回 [hostIP:]hostPort:containerPort/proto 格式的端口映射，记录在网络端点中
+func (b PortBinding) String() string {
+	mapping := fmt.Sprintf("%d:%d/%s", b.HostPort, b.ContainerPort, b.Proto)
+	if b.HostIP == "" {
+		return mapping
+	}
+	if strings.Contains(b.HostIP, ":") {
+		return fmt.Sprintf("[%s]:%s", b.HostIP, mapping)
+	}
+	return b.HostIP + ":" + mapping
+}
+
+// HostAddress 返回宿主机上的监听地址，例如 0.0.0.0:8080
+func (b PortBinding) HostAddress() string {
+	hostIP := b.HostIP
+	if hostIP == "" {
+		hostIP = "0.0.0.0"
+	}
+	return net.JoinHostPort(hostIP, strconv.Itoa(b.HostPort))
+}
+
+// ParsePortMapping 解析 [hostIP:]hostPort[-end]:containerPort[-end][/tcp|udp|sctp] 格式的端口映射
+// 省略宿主机端口时随机分配，端口范围会展开为逐个端口的映射，IPv6 地址需要使用 [] 包裹
+func ParsePortMapping(spec string) ([]PortBinding, error) {
+	rest, proto := spec, defaultPortProto
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		rest, proto = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if !portProtos[proto] {
+		return nil, fmt.Errorf("invalid port mapping %s, unsupported protocol %s", spec, proto)
+	}
+
+	var hostIP, hostPorts, containerPorts string
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]:")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid port mapping %s", spec)
+		}
+		hostIP, rest = rest[1:end], rest[end+2:]
+		var ok bool
+		if hostPorts, containerPorts, ok = strings.Cut(rest, ":"); !ok {
+			return nil, fmt.Errorf("invalid port mapping %s", spec)
+		}
+	} else {
+		parts := strings.Split(rest, ":")
+		switch len(parts) {
+		case 1:
+			containerPorts = parts[0]
+		case 2:
+			hostPorts, containerPorts = parts[0], parts[1]
+		case 3:
+			hostIP, hostPorts, containerPorts = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("invalid port mapping %s, IPv6 host address should be enclosed in []", spec)
+		}
+	}
+	if hostIP != "" {
+		ip := net.ParseIP(hostIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid port mapping %s, invalid host ip %s", spec, hostIP)
+		}
+		// 监听所有地址时与不指定地址相同
+		if ip.IsUnspecified() {
+			hostIP = ""
+		} else {
+			hostIP = ip.String()
+		}
+	}
+
+	containerStart, containerEnd, err := parsePortRange(containerPorts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port mapping %s, %v", spec, err)
+	}
+	hostStart, hostEnd := 0, 0
+	if hostPorts != "" {
+		if hostStart, hostEnd, err = parsePortRange(hostPorts); err != nil {
+			return nil, fmt.Errorf("invalid port mapping %s, %v", spec, err)
+		}
+		if hostEnd-hostStart != containerEnd-containerStart {
+			return nil, fmt.Errorf("invalid port mapping %s, host and container port ranges should have the same size", spec)
+		}
+	}
+
+	bindings := make([]PortBinding, 0, containerEnd-containerStart+1)
+	for port := containerStart; port <= containerEnd; port++ {
+		binding := PortBinding{HostIP: hostIP, ContainerPort: port, Proto: proto}
+		if hostStart != 0 {
+			binding.HostPort = hostStart + port - containerStart
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, nil
+}
+
+// parsePortRange 解析 80 或者 8000-8010 格式的端口范围
+func parsePortRange(ports string) (int, int, error) {
+	startStr, endStr, isRange := strings.Cut(ports, "-")
+	start, err := parsePort(startStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return start, start, nil
+	}
+	end, err := parsePort(endStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid port range %s", ports)
+	}
+	return start, end, nil
+}
+
+func parsePort(port string) (int, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port %s", port)
+	}
+	return p, nil
+}
+
+// parsePortBindings 解析网络端点记录的端口映射
+func parsePortBindings(portMapping []string) ([]PortBinding, error) {
+	var bindings []PortBinding
+	for _, spec := range portMapping {
+		parsed, err := ParsePortMapping(spec)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, parsed...)
+	}
+	return bindings, nil
+}
@@ -0,0 +1,104 @@
+package network
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []string // 展开后每个端口的映射，为空表示解析失败
+	}{
+		{"8080:80", []string{"8080:80/tcp"}},
+		{"5353:53/UDP", []string{"5353:53/udp"}},
+		{"127.0.0.1:8080:80/sctp", []string{"127.0.0.1:8080:80/sctp"}},
+		{"0.0.0.0:8080:80", []string{"8080:80/tcp"}},
+		{"[::1]:8080:80", []string{"[::1]:8080:80/tcp"}},
+		{"8000-8002:9000-9002/udp", []string{"8000:9000/udp", "8001:9001/udp", "8002:9002/udp"}},
+		{"80", []string{"0:80/tcp"}},
+		{"127.0.0.1::80", []string{"127.0.0.1:0:80/tcp"}},
+		{"8080:80/icmp", nil},
+		{"8000-8001:80", nil},
+		{"8002-8000:80-82", nil},
+		{"70000:80", nil},
+		{"0:80", nil},
+		{"::1:8080:80", nil},
+		{"localhost:8080:80", nil},
+		{"[::1]8080:80", nil},
+		{"", nil},
+	}
+	for _, c := range cases {
+		bindings, err := ParsePortMapping(c.spec)
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("parse %q should fail, got %v", c.spec, bindings)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse %q error %v", c.spec, err)
+		}
+		got := make([]string, 0, len(bindings))
+		for _, binding := range bindings {
+			got = append(got, binding.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("parse %q got %v, want %v", c.spec, got, c.want)
+		}
+	}
+}
+
+func TestPortAllocator(t *testing.T) {
+	pa := &PortAllocator{AllocatorPath: path.Join(t.TempDir(), "ports.json")}
+	reserve := func(endpoint string, spec string) ([]PortBinding, error) {
+		bindings, err := ParsePortMapping(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bindings, pa.Reserve(endpoint, bindings)
+	}
+
+	if _, err := reserve("a", "127.0.0.1:8080:80"); err != nil {
+		t.Fatal(err)
+	}
+	// 不同的宿主机地址和协议可以使用同一个端口
+	if _, err := reserve("b", "127.0.0.2:8080:80"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reserve("b", "8080:80/udp"); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range []string{"127.0.0.1:8080:81", "8080:80", "8079-8080:80-81"} {
+		if _, err := reserve("c", spec); !errors.Is(err, ErrPortInUse) {
+			t.Fatalf("reserve %s should conflict, got %v", spec, err)
+		}
+	}
+	// 冲突时不登记任何端口
+	if _, err := reserve("c", "8079:80"); err != nil {
+		t.Fatalf("port 8079 should not be reserved after conflict, got %v", err)
+	}
+
+	bindings, err := reserve("d", "8000-8001/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, binding := range bindings {
+		if binding.HostPort < dynamicPortStart || binding.HostPort > dynamicPortEnd {
+			t.Fatalf("random host port %d is out of range", binding.HostPort)
+		}
+	}
+	if bindings[0].HostPort == bindings[1].HostPort {
+		t.Fatalf("random host ports should not be the same")
+	}
+
+	if err = pa.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = reserve("c", "127.0.0.1:8080:80"); err != nil {
+		t.Fatalf("port should be reusable after release, got %v", err)
+	}
+}
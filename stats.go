@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChenMiaoQiu/tiny-docker/client"
+	"github.com/ChenMiaoQiu/tiny-docker/container"
+	"github.com/ChenMiaoQiu/tiny-docker/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	statsInterval = time.Second
+	formatJson    = "json"
+	formatTable   = "table"
+	// clearScreen 清屏并将光标移动到左上角，用于刷新表格
+	clearScreen = "\033[2J\033[H"
+)
+
+// ContainerStats 容器一次采样的资源使用情况
+type ContainerStats struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name"`
+	CpuPercent    float64 `json:"cpuPercent"`
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	NetRx         uint64  `json:"netRx"`
+	NetTx         uint64  `json:"netTx"`
+	BlockRead     uint64  `json:"blockRead"`
+	BlockWrite    uint64  `json:"blockWrite"`
+	Pids          uint64  `json:"pids"`
+}
+
+// statsContainers 打印容器资源使用情况，noStream 为 false 时每隔 statsInterval 刷新一次
+func statsContainers(containerIds []string, noStream bool, format string) error {
+	if format != formatTable && format != formatJson {
+		return fmt.Errorf("unsupported format %s, must be %s or %s", format, formatTable, formatJson)
+	}
+	memTotal, err := utils.GetMemoryTotal()
+	if err != nil {
+		return errors.WithMessage(err, "get host memory total failed")
+	}
+
+	// cpu使用率需要两次采样计算，先进行第一次采样
+	api := localClient()
+	samples := make(map[string]*client.Stats)
+	infos, err := getStatsTargets(api, containerIds)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if samples[info.Id], err = api.Stats(info.Id); err != nil {
+			return err
+		}
+	}
+
+	for {
+		time.Sleep(statsInterval)
+		infos, err = getStatsTargets(api, containerIds)
+		if err != nil {
+			return err
+		}
+		result := make([]*ContainerStats, 0, len(infos))
+		for _, info := range infos {
+			now, err := api.Stats(info.Id)
+			if err != nil {
+				return err
+			}
+			result = append(result, buildContainerStats(samples[info.Id], now, memTotal))
+			samples[info.Id] = now
+		}
+
+		if format == formatJson {
+			if err = printStatsJson(result); err != nil {
+				return err
+			}
+		} else {
+			if !noStream {
+				fmt.Fprint(os.Stdout, clearScreen)
+			}
+			printStatsTable(result)
+		}
+		if noStream {
+			return nil
+		}
+	}
+}
+
+// getStatsTargets 获取需要统计的容器，未指定容器时统计所有运行中的容器
+func getStatsTargets(api *client.Client, containerIds []string) ([]*container.Info, error) {
+	if len(containerIds) == 0 {
+		infos, err := api.List()
+		if err != nil {
+			return nil, err
+		}
+		running := make([]*container.Info, 0, len(infos))
+		for _, info := range infos {
+			if info.Status == container.RUNNING || info.Status == container.PAUSED {
+				running = append(running, info)
+			}
+		}
+		return running, nil
+	}
+	infos := make([]*container.Info, 0, len(containerIds))
+	for _, containerId := range containerIds {
+		result, err := api.Inspect(containerId)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "get container %s info failed", containerId)
+		}
+		infos = append(infos, result.Info)
+	}
+	return infos, nil
+}
+
+// buildContainerStats 根据两次采样计算容器的资源使用情况，prev 为空时 cpu 使用率为 0
+func buildContainerStats(prev, now *client.Stats, memTotal uint64) *ContainerStats {
+	result := &ContainerStats{
+		Id:          now.Id,
+		Name:        now.Name,
+		MemoryUsage: now.MemoryUsage,
+		MemoryLimit: now.MemoryLimit,
+		NetRx:       now.NetRx,
+		NetTx:       now.NetTx,
+		BlockRead:   now.BlkioRead,
+		BlockWrite:  now.BlkioWrite,
+		Pids:        now.Pids,
+	}
+	// 100% 表示占满一个cpu核心，两次采样之间新启动的容器没有上一次采样
+	if prev != nil {
+		if elapsed := now.Read.Sub(prev.Read); elapsed > 0 && now.CpuUsage >= prev.CpuUsage {
+			result.CpuPercent = float64(now.CpuUsage-prev.CpuUsage) / float64(elapsed.Nanoseconds()) * 100
+		}
+	}
+	// 没有设置内存限制时 limit 是一个极大值，使用宿主机内存总量代替
+	if result.MemoryLimit == 0 || result.MemoryLimit > memTotal {
+		result.MemoryLimit = memTotal
+	}
+	result.MemoryPercent = float64(result.MemoryUsage) / float64(result.MemoryLimit) * 100
+	return result
+}
+
+func printStatsTable(result []*ContainerStats) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "CONTAINER ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	for _, item := range result {
+		fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			container.ShortID(item.Id),
+			item.Name,
+			item.CpuPercent,
+			utils.HumanSize(item.MemoryUsage), utils.HumanSize(item.MemoryLimit),
+			item.MemoryPercent,
+			utils.HumanSize(item.NetRx), utils.HumanSize(item.NetTx),
+			utils.HumanSize(item.BlockRead), utils.HumanSize(item.BlockWrite),
+			item.Pids)
+	}
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Flush error %v", err)
+	}
+}
+
+func printStatsJson(result []*ContainerStats) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "marshal stats failed")
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(content))
+	return err
+}
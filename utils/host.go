@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetMemoryTotal 读取宿主机的物理内存总量，单位字节
+func GetMemoryTotal() (uint64, error) {
+	return readMeminfo("MemTotal")
+}
+
+// GetSwapTotal 读取宿主机的swap总量，单位字节
+func GetSwapTotal() (uint64, error) {
+	return readMeminfo("SwapTotal")
+}
+
+// readMeminfo 读取 /proc/meminfo 中的指定字段
+func readMeminfo(field string) (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16310020 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != field+":" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return value * KiB, nil
+	}
+	return 0, fmt.Errorf("%s not found in /proc/meminfo", field)
+}
+
+// onlineCPUsPath 记录宿主机在线cpu的文件，格式与 cpuset.cpus 相同，e.g. 0-3,5
+const onlineCPUsPath = "/sys/devices/system/cpu/online"
+
+// GetOnlineCPUs 读取宿主机在线的cpu编号
+func GetOnlineCPUs() (map[int]bool, error) {
+	content, err := os.ReadFile(onlineCPUsPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(strings.TrimSpace(string(content)))
+}
+
+// MaxCPUs 内核支持的最大cpu数量，即 NR_CPUS 的上限，cpu编号必须小于这个值
+const MaxCPUs = 8192
+
+// ParseCPUList 解析 cpuset 格式的cpu列表，e.g. 0-3,5 表示 0、1、2、3、5 号cpu
+// 编号不小于 MaxCPUs 时直接返回错误，避免展开范围时分配巨大的 map
+func ParseCPUList(list string) (map[int]bool, error) {
+	cpus := make(map[int]bool)
+	if list == "" {
+		return nil, fmt.Errorf("invalid cpu list: empty")
+	}
+	for _, item := range strings.Split(list, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu list: %s", list)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu list: %s", list)
+			}
+		}
+		if end >= MaxCPUs {
+			return nil, fmt.Errorf("invalid cpu list: %s, cpu must be less than %d", list, MaxCPUs)
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus[cpu] = true
+		}
+	}
+	return cpus, nil
+}
@@ -19,6 +19,11 @@ func GetRoot(containerID string) string { return RootPath + containerID }
 // 获取容器镜像存储位置
 func GetImage(imageName string) string { return fmt.Sprintf("%s%s.tar", ImagePath, imageName) }
 
+// 获取容器镜像元数据存储位置
+func GetImageConfig(imageName string) string {
+	return fmt.Sprintf("%s%s.json", ImagePath, imageName)
+}
+
 // 获取lower文件夹位置
 func GetLower(containerID string) string {
 	return fmt.Sprintf(lowerDirFormat, containerID)
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSignal Linux 支持的最大信号值，即 SIGRTMAX
+const maxSignal = 64
+
+// ParseSignal 解析信号，支持 SIGTERM、TERM、15 三种写法
+func ParseSignal(rawSignal string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(rawSignal); err == nil {
+		if num <= 0 || num > maxSignal {
+			return 0, fmt.Errorf("invalid signal number %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+	name := strings.ToUpper(rawSignal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("invalid signal %s", rawSignal)
+	}
+	return sig, nil
+}
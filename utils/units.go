@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 二进制单位
+const (
+	KiB = 1024
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+)
+
+var binaryAbbrs = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// HumanSize 将字节数转换为易读的形式，e.g. 1.5MiB
+func HumanSize(size uint64) string {
+	value := float64(size)
+	i := 0
+	for value >= KiB && i < len(binaryAbbrs)-1 {
+		value /= KiB
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, binaryAbbrs[i])
+	}
+	return fmt.Sprintf("%.2f%s", value, binaryAbbrs[i])
+}
+
+// unitMultipliers 内存单位与字节数的对应关系，与 docker 一致，k、kb、kib 都按 1024 计算
+var unitMultipliers = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   KiB,
+	"kb":  KiB,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  MiB,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  GiB,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  TiB,
+	"tib": TiB,
+}
+
+// RAMInBytes 将内存大小转换为字节数，支持小数以及 k、m、g、t 等单位，e.g. 100m、1.5g、100MiB
+func RAMInBytes(size string) (int64, error) {
+	raw := size
+	size = strings.TrimSpace(strings.ToLower(size))
+	// 分离数字和单位
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(size)
+	}
+	number, unit := size[:i], strings.TrimSpace(size[i:])
+	if number == "" {
+		return 0, fmt.Errorf("invalid size: %s", raw)
+	}
+	multiplier, ok := unitMultipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size: %s, unknown unit %s", raw, unit)
+	}
+	// 整数直接计算，避免大数转换为浮点数丢失精度
+	if value, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if value > math.MaxInt64/multiplier {
+			return 0, fmt.Errorf("invalid size: %s, value out of range", raw)
+		}
+		return value * multiplier, nil
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", raw)
+	}
+	bytes := value * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size: %s, value out of range", raw)
+	}
+	return int64(bytes), nil
+}
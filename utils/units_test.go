@@ -0,0 +1,61 @@
+package utils
+
+import "testing"
+
+func TestRAMInBytes(t *testing.T) {
+	cases := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "100m", want: 100 * MiB},
+		{size: "100M", want: 100 * MiB},
+		{size: "100MiB", want: 100 * MiB},
+		{size: "100mb", want: 100 * MiB},
+		{size: "1.5g", want: 1536 * MiB},
+		{size: "2t", want: 2 * TiB},
+		{size: "10b", want: 10},
+		{size: "", wantErr: true},
+		{size: "m", wantErr: true},
+		{size: "-1", wantErr: true},
+		{size: "100x", wantErr: true},
+		{size: "1.2.3g", wantErr: true},
+		{size: "99999999999t", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := RAMInBytes(c.size)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("RAMInBytes(%q) expect error, got %d", c.size, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("RAMInBytes(%q) error %v", c.size, err)
+		}
+		if got != c.want {
+			t.Fatalf("RAMInBytes(%q) = %d, want %d", c.size, got, c.want)
+		}
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("0-2,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cpu := range []int{0, 1, 2, 5} {
+		if !cpus[cpu] {
+			t.Fatalf("cpu %d should be in list", cpu)
+		}
+	}
+	if len(cpus) != 4 {
+		t.Fatalf("expect 4 cpus, got %v", cpus)
+	}
+	for _, list := range []string{"", "a", "3-1", "1,", "-1", "0-1000000000", "0-9223372036854775807", "8192"} {
+		if _, err = ParseCPUList(list); err == nil {
+			t.Fatalf("ParseCPUList(%q) expect error", list)
+		}
+	}
+}